@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
-	"github.com/credifranco/stori-utils-go/aws"
 	"github.com/credifranco/stori-utils-go/db"
 	slog "github.com/credifranco/stori-utils-go/log"
 	"github.com/credifranco/stori-utils-go/redis"
@@ -20,7 +20,15 @@ type StoriServicesConfig struct {
 	DBProxy    *db.DBProxies
 	Lambda     bool
 	RedisCache bool // TODO
-	SNS        bool // TODO
+	SNS        bool
+
+	// Lazy lists the dependencies that are not created by NewStoriServices. They are initialized on
+	// the first call to their StoriServices accessor (GetDB, GetLambdaAPI, GetSNSAPI or GetRedis).
+	Lazy []Dependency
+	// Timeout limits how long each dependency can take to initialize. Zero means no limit.
+	Timeout time.Duration
+	// Timeouts overrides Timeout for individual dependencies
+	Timeouts map[Dependency]time.Duration
 }
 
 type StoriServices struct {
@@ -28,7 +36,22 @@ type StoriServices struct {
 	LambdaAPI lambdaiface.LambdaAPI
 	Logger    *zap.SugaredLogger
 	SNSAPI    snsiface.SNSAPI
-	Redis     *redis.RedisConn
+	Redis     redis.Cache
+
+	lazy      *lazyServices
+	lifecycle *lifecycle
+	// margin is set with WithDeadlineMargin
+	margin *time.Duration
+}
+
+// deadlineMargin returns how long before the Lambda deadline the context of the handlers of `s` is
+// done, which is DefaultDeadlineMargin unless the services were created with WithDeadlineMargin
+func (s StoriServices) deadlineMargin() time.Duration {
+	if s.margin == nil {
+		return DefaultDeadlineMargin
+	}
+
+	return *s.margin
 }
 
 type APIGatewayHandlerFunc func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
@@ -46,43 +69,85 @@ type errorResponse struct {
 const invalidJSONError = "could not create JSON response"
 
 // NewStoriServices is a constructor for StoriServices. The Logger field of the StoriServices will
-// always be created. DB, LA & SNS are optional, set based on the values passed in via the StoriServicesConfig.
-func NewStoriServices(ctx context.Context, config StoriServicesConfig) (StoriServices, error) {
-	logger, err := slog.NewLogger()
-	if err != nil {
-		return StoriServices{}, fmt.Errorf("error creating logger: %v", err)
+// always be created. DB, LA, SNS & Redis are optional, set based on the values passed in via the
+// StoriServicesConfig.
+//
+// Options can replace the Logger, or provide pre-built instances or factories for any dependency.
+// A dependency provided through an Option is created even if it is not enabled in `config`.
+//
+// Eager dependencies are initialized concurrently, and if any of them fail an *InitError naming
+// every failed dependency is returned. Lazy dependencies are left nil and are created on first use
+// by their accessor method.
+func NewStoriServices(ctx context.Context, config StoriServicesConfig, opts ...Option) (StoriServices, error) {
+	return newStoriServices(ctx, config, newOptions(config, opts))
+}
+
+// newStoriServices creates the StoriServices of NewStoriServices with the applied options `o`
+func newStoriServices(ctx context.Context, config StoriServicesConfig, o options) (StoriServices, error) {
+	logger := o.logger
+	if logger == nil {
+		var err error
+		if logger, err = slog.NewLogger(); err != nil {
+			return StoriServices{}, fmt.Errorf("error creating logger: %v", err)
+		}
 	}
 
-	out := StoriServices{Logger: logger}
+	out := StoriServices{
+		Logger: logger,
+		lazy: &lazyServices{
+			config: config,
+			inits:  o.inits,
+			values: map[Dependency]*lazyValue{},
+		},
+		lifecycle: newLifecycle(),
+		margin:    &o.deadlineMargin,
+	}
 
-	if config.DBProxy != nil {
-		a := &db.AWSDB{}
-		if err := a.NewConnection(ctx, *config.DBProxy); err != nil {
-			return StoriServices{}, fmt.Errorf("error establishing database connection: %v", err)
+	eager := map[Dependency]initFunc{}
+	for d, f := range o.inits {
+		if config.isLazy(d) {
+			out.lazy.values[d] = &lazyValue{}
+			continue
 		}
-		out.DB = a
+		eager[d] = f
 	}
 
-	if config.Lambda {
-		if out.LambdaAPI, err = aws.NewLambdaClient(); err != nil {
-			return StoriServices{}, fmt.Errorf("error creating lambda client: %v", err)
+	vals, err := initEager(ctx, config, eager)
+	for _, d := range dependencies {
+		if v, ok := vals[d]; ok {
+			// the lifecycle is new, so it can't be closed
+			_ = out.lifecycle.register(d, v)
 		}
 	}
-	// Create SNS service client
-	if config.SNS {
-		if out.SNSAPI, err = aws.NewSNSClient(); err != nil {
-			return StoriServices{}, fmt.Errorf("error creating SNS client: %v", err)
-		}
+	if err != nil {
+		// don't leak the connections that did succeed
+		_ = out.Close(ctx)
+		return StoriServices{}, err
 	}
 
-	if config.RedisCache {
-		r := redis.RedisConn{}
-		if err = r.NewConn(ctx); err != nil {
-			return StoriServices{}, fmt.Errorf("error creating Redis client: %v", err)
+	errs := map[Dependency]error{}
+	for d, v := range vals {
+		if !hasDependencyType(d, v) {
+			errs[d] = fmt.Errorf("unexpected type %T", v)
+			continue
 		}
-		out.Redis = r
 
+		switch d {
+		case DependencyDB:
+			out.DB = v.(db.DBConnector)
+		case DependencyLambda:
+			out.LambdaAPI = v.(lambdaiface.LambdaAPI)
+		case DependencySNS:
+			out.SNSAPI = v.(snsiface.SNSAPI)
+		case DependencyRedis:
+			out.Redis = v.(redis.Cache)
+		}
+	}
+	if len(errs) > 0 {
+		_ = out.Close(ctx)
+		return StoriServices{}, &InitError{Errors: errs}
 	}
+
 	return out, nil
 }
 
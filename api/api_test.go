@@ -2,13 +2,18 @@ package api_test
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/pashagolub/pgxmock"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/credifranco/stori-utils-go/api"
+	"github.com/credifranco/stori-utils-go/db"
 )
 
 func TestNewStoriServices(t *testing.T) {
@@ -22,6 +27,89 @@ func TestNewStoriServices(t *testing.T) {
 	assert.NotNil(t, handler.Logger, "handler with zero config should have a non-nil logger")
 }
 
+// unsetEnv clears the env variable `key` for the duration of the test
+func unsetEnv(t *testing.T, key string) {
+	if val, ok := os.LookupEnv(key); ok {
+		t.Cleanup(func() { os.Setenv(key, val) })
+	}
+	os.Unsetenv(key)
+}
+
+func TestNewStoriServicesInitError(t *testing.T) {
+	a := assert.New(t)
+	unsetEnv(t, "AWS_REGION")
+	unsetEnv(t, "REDIS_HOST")
+
+	_, err := api.NewStoriServices(
+		context.Background(),
+		api.StoriServicesConfig{Lambda: true, RedisCache: true, SNS: true},
+	)
+
+	var initErr *api.InitError
+	a.True(errors.As(err, &initErr), "error should be an *api.InitError")
+	a.Equal(
+		[]api.Dependency{api.DependencyLambda, api.DependencyRedis},
+		initErr.Failed(),
+		"every failed dependency should be reported",
+	)
+}
+
+func TestNewStoriServicesLazy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	unsetEnv(t, "REDIS_HOST")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	s, err := api.NewStoriServices(ctx, api.StoriServicesConfig{
+		Lambda:     true,
+		RedisCache: true,
+		Lazy:       []api.Dependency{api.DependencyLambda, api.DependencyRedis},
+	})
+	a.NoError(err, "lazy dependencies should not be initialized by NewStoriServices")
+	a.Nil(s.LambdaAPI)
+	a.Nil(s.Redis)
+
+	la, err := s.GetLambdaAPI(ctx)
+	a.NoError(err)
+	a.NotNil(la)
+	la2, _ := s.GetLambdaAPI(ctx)
+	a.Same(la, la2, "lazy dependency should only be created once")
+
+	_, err = s.GetRedis(ctx)
+	var initErr *api.InitError
+	a.True(errors.As(err, &initErr), "lazy init failure should be an *api.InitError")
+
+	_, err = s.GetDB(ctx)
+	a.ErrorIs(err, api.ErrDependencyNotConfigured)
+}
+
+func TestNewStoriServicesTimeout(t *testing.T) {
+	a := assert.New(t)
+	pool, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.ExpectClose()
+
+	release := make(chan struct{})
+	_, err = api.NewStoriServices(
+		context.Background(),
+		api.StoriServicesConfig{Timeout: 10 * time.Millisecond},
+		api.WithDBFactory(func(context.Context) (db.DBConnector, error) {
+			// ignores its context, like a slow connection
+			<-release
+			return pool, nil
+		}),
+	)
+	var initErr *api.InitError
+	a.True(errors.As(err, &initErr))
+	a.ErrorIs(initErr.Errors[api.DependencyDB], context.DeadlineExceeded)
+
+	close(release)
+	a.Eventually(func() bool { return pool.ExpectationsWereMet() == nil }, time.Second, time.Millisecond,
+		"a dependency created after the timeout should be closed")
+}
+
 func TestJSONResponseErr(t *testing.T) {
 	// Setup
 	a := assert.New(t)
@@ -0,0 +1,57 @@
+// Package apitest provides in-memory fakes of the StoriServices dependencies, so handlers can be
+// tested without touching AWS, the database or redis.
+package apitest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock"
+	"go.uber.org/zap"
+
+	"github.com/credifranco/stori-utils-go/api"
+)
+
+// Fakes holds the fake dependencies behind a StoriServices created by NewStoriServices. Use them to
+// set expectations and to inspect what a handler did.
+type Fakes struct {
+	DB     pgxmock.PgxPoolIface
+	Lambda *FakeLambda
+	SNS    *FakeSNS
+	Redis  *FakeRedis
+}
+
+// NewStoriServices returns a StoriServices whose dependencies are all fakes, and a no-op Logger.
+// `opts` are applied after the fakes, so they can replace any of them. The services are closed
+// when the test finishes.
+func NewStoriServices(t testing.TB, opts ...api.Option) (api.StoriServices, *Fakes) {
+	t.Helper()
+
+	pool, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("error creating pgxmock pool: %v", err)
+	}
+
+	f := &Fakes{
+		DB:     pool,
+		Lambda: &FakeLambda{},
+		SNS:    &FakeSNS{},
+		Redis:  NewFakeRedis(),
+	}
+
+	opts = append([]api.Option{
+		api.WithLogger(zap.NewNop().Sugar()),
+		api.WithDB(f.DB),
+		api.WithLambdaAPI(f.Lambda),
+		api.WithSNSAPI(f.SNS),
+		api.WithRedis(f.Redis),
+	}, opts...)
+
+	s, err := api.NewStoriServices(context.Background(), api.StoriServicesConfig{}, opts...)
+	if err != nil {
+		t.Fatalf("error creating StoriServices: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close(context.Background()) })
+
+	return s, f
+}
@@ -0,0 +1,75 @@
+package apitest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/credifranco/stori-utils-go/api"
+	"github.com/credifranco/stori-utils-go/api/apitest"
+	"github.com/credifranco/stori-utils-go/aws"
+)
+
+// handler reads a message from the db, caches it, and invokes a lambda with it
+func handler(s api.StoriServices) api.APIGatewayHandlerFunc {
+	return func(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		var msg string
+		if err := s.DB.QueryRow(ctx, "SELECT 'hello world!'").Scan(&msg); err != nil {
+			return api.JSONErrResponse(http.StatusInternalServerError, err.Error())
+		}
+
+		if err := s.Redis.Set(ctx, "msg", msg, time.Minute); err != nil {
+			return api.JSONErrResponse(http.StatusInternalServerError, err.Error())
+		}
+
+		li := aws.LambdaInvocation{FunctionName: "some-lambda", Event: msg, InvocationType: "Event"}
+		if _, err := li.InvokeLambda(s.LambdaAPI); err != nil {
+			return api.JSONErrResponse(http.StatusInternalServerError, err.Error())
+		}
+
+		return api.JSONResponse(http.StatusOK, msg)
+	}
+}
+
+func TestNewStoriServices(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	s, fakes := apitest.NewStoriServices(t)
+
+	fakes.DB.ExpectQuery("SELECT").WillReturnRows(pgxmock.NewRows([]string{"msg"}).AddRow("hello world!"))
+
+	res, err := handler(s)(ctx, events.APIGatewayProxyRequest{})
+	a.NoError(err)
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal(`"hello world!"`, res.Body)
+	a.NoError(fakes.DB.ExpectationsWereMet())
+
+	cached, err := fakes.Redis.Get(ctx, "msg")
+	a.NoError(err)
+	a.Equal("hello world!", cached)
+
+	invocations := fakes.Lambda.Invocations()
+	a.Len(invocations, 1)
+	a.Equal("some-lambda", *invocations[0].FunctionName)
+	a.Equal(`"hello world!"`, string(invocations[0].Payload))
+}
+
+func TestFakeRedisExpiry(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	r := apitest.NewFakeRedis()
+
+	_, err := r.Get(ctx, "missing")
+	a.ErrorIs(err, goredis.Nil)
+
+	a.NoError(r.Set(ctx, "k", "v", time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	_, err = r.Get(ctx, "k")
+	a.ErrorIs(err, goredis.Nil, "expired keys should be missing")
+}
@@ -0,0 +1,52 @@
+package apitest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+)
+
+// FakeLambda implements the Invoke methods of lambdaiface.LambdaAPI. Every input is recorded in
+// Invocations. Calling any other LambdaAPI method panics.
+type FakeLambda struct {
+	lambdaiface.LambdaAPI
+
+	// InvokeFunc returns the result of each invocation. By default a 200 with an empty payload is
+	// returned.
+	InvokeFunc func(*lambda.InvokeInput) (*lambda.InvokeOutput, error)
+
+	mu          sync.Mutex
+	invocations []*lambda.InvokeInput
+}
+
+// Invoke records `in` and returns the result of InvokeFunc
+func (f *FakeLambda) Invoke(in *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	f.mu.Lock()
+	f.invocations = append(f.invocations, in)
+	fn := f.InvokeFunc
+	f.mu.Unlock()
+
+	if fn != nil {
+		return fn(in)
+	}
+
+	return &lambda.InvokeOutput{StatusCode: aws.Int64(http.StatusOK)}, nil
+}
+
+// InvokeWithContext records `in` and returns the result of InvokeFunc
+func (f *FakeLambda) InvokeWithContext(_ context.Context, in *lambda.InvokeInput, _ ...request.Option) (*lambda.InvokeOutput, error) {
+	return f.Invoke(in)
+}
+
+// Invocations returns the inputs of every call to Invoke, in order
+func (f *FakeLambda) Invocations() []*lambda.InvokeInput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]*lambda.InvokeInput{}, f.invocations...)
+}
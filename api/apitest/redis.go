@@ -0,0 +1,105 @@
+package apitest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+
+	"github.com/credifranco/stori-utils-go/redis"
+)
+
+var _ redis.Cache = (*FakeRedis)(nil)
+
+// FakeRedis is an in-memory implementation of redis.Cache. Missing and expired keys return
+// redis.Nil, like the real client.
+type FakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	expiry map[string]time.Time
+}
+
+// NewFakeRedis creates an empty FakeRedis
+func NewFakeRedis() *FakeRedis {
+	return &FakeRedis{
+		values: map[string]string{},
+		expiry: map[string]time.Time{},
+	}
+}
+
+// Set stores `d` under `k`. A zero `e` means the key never expires.
+func (f *FakeRedis) Set(_ context.Context, k string, d string, e time.Duration) error {
+	if k == "" {
+		return errors.New("key parameter missing")
+	}
+
+	if d == "" {
+		return errors.New("value parameter missing")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.values[k] = d
+	delete(f.expiry, k)
+	if e > 0 {
+		f.expiry[k] = time.Now().Add(e)
+	}
+
+	return nil
+}
+
+// Get returns the value of `k`, or redis.Nil if it is missing or expired
+func (f *FakeRedis) Get(_ context.Context, k string) (string, error) {
+	if k == "" {
+		return "", errors.New("key parameter missing")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.exists(k) {
+		return "", goredis.Nil
+	}
+
+	return f.values[k], nil
+}
+
+// Expire sets the time to live of `k`
+func (f *FakeRedis) Expire(_ context.Context, k string, t time.Duration) error {
+	if k == "" {
+		return errors.New("key parameter missing")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.exists(k) {
+		f.expiry[k] = time.Now().Add(t)
+	}
+
+	return nil
+}
+
+// Ping always succeeds
+func (f *FakeRedis) Ping(context.Context) error { return nil }
+
+// Close is a no-op
+func (f *FakeRedis) Close() error { return nil }
+
+// exists reports if `k` is set and not expired, removing it if it expired. f.mu must be held.
+func (f *FakeRedis) exists(k string) bool {
+	if _, ok := f.values[k]; !ok {
+		return false
+	}
+
+	if exp, ok := f.expiry[k]; ok && !time.Now().Before(exp) {
+		delete(f.values, k)
+		delete(f.expiry, k)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,84 @@
+package apitest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+)
+
+// FakeSNS implements the Publish and PublishBatch methods of snsiface.SNSAPI. Every published
+// message is recorded in Published, batch entries are recorded as single messages. Calling any
+// other SNSAPI method panics.
+type FakeSNS struct {
+	snsiface.SNSAPI
+
+	// Err, when set, is returned by every Publish call
+	Err error
+
+	mu        sync.Mutex
+	published []*sns.PublishInput
+}
+
+// Publish records `in` and returns a generated message id
+func (f *FakeSNS) Publish(in *sns.PublishInput) (*sns.PublishOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.published = append(f.published, in)
+
+	return &sns.PublishOutput{MessageId: aws.String(fmt.Sprintf("message-%d", len(f.published)))}, nil
+}
+
+// PublishWithContext records `in` and returns a generated message id
+func (f *FakeSNS) PublishWithContext(_ context.Context, in *sns.PublishInput, _ ...request.Option) (*sns.PublishOutput, error) {
+	return f.Publish(in)
+}
+
+// Published returns the inputs of every successful call to Publish, in order
+func (f *FakeSNS) Published() []*sns.PublishInput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]*sns.PublishInput{}, f.published...)
+}
+
+// PublishBatch records each entry of `in` and returns generated message ids
+func (f *FakeSNS) PublishBatch(in *sns.PublishBatchInput) (*sns.PublishBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	out := &sns.PublishBatchOutput{}
+	for _, e := range in.PublishBatchRequestEntries {
+		f.published = append(f.published, &sns.PublishInput{
+			TopicArn:               in.TopicArn,
+			Message:                e.Message,
+			MessageAttributes:      e.MessageAttributes,
+			Subject:                e.Subject,
+			MessageGroupId:         e.MessageGroupId,
+			MessageDeduplicationId: e.MessageDeduplicationId,
+		})
+		out.Successful = append(out.Successful, &sns.PublishBatchResultEntry{
+			Id:        e.Id,
+			MessageId: aws.String(fmt.Sprintf("message-%d", len(f.published))),
+		})
+	}
+
+	return out, nil
+}
+
+// PublishBatchWithContext records each entry of `in` and returns generated message ids
+func (f *FakeSNS) PublishBatchWithContext(_ context.Context, in *sns.PublishBatchInput, _ ...request.Option) (*sns.PublishBatchOutput, error) {
+	return f.PublishBatch(in)
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/credifranco/stori-utils-go/aws"
+	slog "github.com/credifranco/stori-utils-go/log"
+	"go.uber.org/zap"
+)
+
+// errPreviousRecordFailed fails the records of a DynamoDB stream after the first failed one
+var errPreviousRecordFailed = errors.New("not handled because a previous record failed")
+
+// S3Record is an object notification of an S3 event
+type S3Record struct {
+	Object    aws.S3Object
+	EventName string
+	EventTime time.Time
+	Size      int64
+	ETag      string
+	Record    events.S3EventRecord
+}
+
+// SNSNotification is a message of an SNS event
+type SNSNotification struct {
+	events.SNSEntity
+}
+
+// Decode decodes the JSON message of the notification into `dst`
+func (n SNSNotification) Decode(dst interface{}) error {
+	return decodeRecord("SNS message", n.MessageID, n.Message, dst)
+}
+
+// SQSMessage is a message of an SQS event
+type SQSMessage struct {
+	events.SQSMessage
+}
+
+// Decode decodes the JSON body of the message into `dst`
+func (m SQSMessage) Decode(dst interface{}) error {
+	return decodeRecord("SQS message", m.MessageId, m.Body, dst)
+}
+
+// EventBridgeEvent is an event delivered by an EventBridge rule or schedule
+type EventBridgeEvent struct {
+	events.CloudWatchEvent
+}
+
+// Decode decodes the JSON detail of the event into `dst`
+func (e EventBridgeEvent) Decode(dst interface{}) error {
+	return decodeRecord("EventBridge event", e.ID, string(e.Detail), dst)
+}
+
+type (
+	// S3RecordHandler handles a record of an S3 event
+	S3RecordHandler func(ctx context.Context, s StoriServices, r S3Record) error
+	// SNSNotificationHandler handles a message of an SNS event
+	SNSNotificationHandler func(ctx context.Context, s StoriServices, n SNSNotification) error
+	// SQSMessageHandler handles a message of an SQS event
+	SQSMessageHandler func(ctx context.Context, s StoriServices, m SQSMessage) error
+	// EventBridgeEventHandler handles an EventBridge event
+	EventBridgeEventHandler func(ctx context.Context, s StoriServices, e EventBridgeEvent) error
+	// DynamoDBRecordHandler handles a record of a DynamoDB stream
+	DynamoDBRecordHandler func(ctx context.Context, s StoriServices, r events.DynamoDBEventRecord) error
+)
+
+// BatchResponse reports the records of an SQS or DynamoDB stream event that failed, so only those
+// are retried. The event source mapping must have ReportBatchItemFailures enabled, otherwise the
+// whole batch is considered successful.
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+// BatchItemFailure is a failed record of a BatchResponse
+type BatchItemFailure struct {
+	// ItemIdentifier is the message ID of SQS records, or the sequence number of stream records
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// RecordFailure is a record that could not be handled
+type RecordFailure struct {
+	Index int
+	// ID is the S3 URI of S3 records, the message ID of SNS and SQS records, the sequence number of
+	// DynamoDB records, or the ID of EventBridge events
+	ID  string
+	Err error
+}
+
+// RecordsError is returned by the S3 and SNS handlers when some of the records of the event failed
+type RecordsError struct {
+	Source   string
+	Failures []RecordFailure
+}
+
+func (e *RecordsError) Error() string {
+	ff := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		ff[i] = fmt.Sprintf("%s: %v", f.ID, f.Err)
+	}
+
+	return fmt.Sprintf("%d %s records failed: %s", len(e.Failures), e.Source, strings.Join(ff, "; "))
+}
+
+// S3Handler returns a Lambda handler for S3 notifications that calls `h` for every record, with the
+// bucket and key of the record as an aws.S3Object.
+//
+// Like the handlers of the other event sources, the Logger of the services includes the request
+// ID of the invocation and the ID of the record, the context is done before the Lambda deadline by
+// the margin set with WithDeadlineMargin, DefaultDeadlineMargin by default, and panics are recovered and logged as errors of the record. Records are
+// handled in order, and the records that were not started when the context is done fail with the
+// context error.
+func S3Handler(s StoriServices, h S3RecordHandler) func(context.Context, events.S3Event) error {
+	return func(ctx context.Context, e events.S3Event) error {
+		failures := handleRecords(ctx, s, "S3", len(e.Records), false, func(i int) string {
+			return newS3Record(e.Records[i]).Object.Url
+		}, func(ctx context.Context, s StoriServices, i int) error {
+			return h(ctx, s, newS3Record(e.Records[i]))
+		})
+
+		return recordsError("S3", failures)
+	}
+}
+
+// SNSHandler returns a Lambda handler for SNS events that calls `h` for every message. See
+// S3Handler.
+func SNSHandler(s StoriServices, h SNSNotificationHandler) func(context.Context, events.SNSEvent) error {
+	return func(ctx context.Context, e events.SNSEvent) error {
+		failures := handleRecords(ctx, s, "SNS", len(e.Records), false, func(i int) string {
+			return e.Records[i].SNS.MessageID
+		}, func(ctx context.Context, s StoriServices, i int) error {
+			return h(ctx, s, SNSNotification{e.Records[i].SNS})
+		})
+
+		return recordsError("SNS", failures)
+	}
+}
+
+// SQSHandler returns a Lambda handler for SQS events that calls `h` for every message, and reports
+// the failed messages in a BatchResponse. Messages are handled by aws.SQSEventHandler with up to
+// `concurrency` at the same time, so the messages of a FIFO group are handled in order, and once
+// one of them fails the rest of its group fails without being handled. See S3Handler.
+func SQSHandler(s StoriServices, concurrency int, h SQSMessageHandler) func(context.Context, events.SQSEvent) (BatchResponse, error) {
+	return func(ctx context.Context, e events.SQSEvent) (BatchResponse, error) {
+		ctx, cancel := withDeadlineMargin(ctx, s.deadlineMargin())
+		defer cancel()
+
+		logger := invocationLogger(ctx, s.Logger)
+		ctx = slog.WithContext(ctx, s.Logger)
+
+		msgs := make(map[string]events.SQSMessage, len(e.Records))
+		for _, m := range e.Records {
+			msgs[m.MessageId] = m
+		}
+
+		res, err := aws.SQSEventHandler(concurrency, func(ctx context.Context, r aws.SQSRecord) error {
+			return handleLogged(ctx, s, logger, "SQS", r.MessageID, func(ctx context.Context, s StoriServices) error {
+				return h(ctx, s, SQSMessage{msgs[r.MessageID]})
+			})
+		})(ctx, e)
+		if err != nil {
+			return BatchResponse{}, err
+		}
+
+		out := BatchResponse{BatchItemFailures: []BatchItemFailure{}}
+		for _, f := range res.BatchItemFailures {
+			out.BatchItemFailures = append(out.BatchItemFailures, BatchItemFailure{ItemIdentifier: f.ItemIdentifier})
+		}
+
+		return out, nil
+	}
+}
+
+// DynamoDBHandler returns a Lambda handler for DynamoDB streams that calls `h` for every record,
+// and reports the failed records in a BatchResponse. Lambda retries a stream from its first failed
+// record, so handling stops at the first failure, and the records after it are reported as failed
+// too. See S3Handler.
+func DynamoDBHandler(s StoriServices, h DynamoDBRecordHandler) func(context.Context, events.DynamoDBEvent) (BatchResponse, error) {
+	return func(ctx context.Context, e events.DynamoDBEvent) (BatchResponse, error) {
+		failures := handleRecords(ctx, s, "DynamoDB", len(e.Records), true, func(i int) string {
+			return e.Records[i].Change.SequenceNumber
+		}, func(ctx context.Context, s StoriServices, i int) error {
+			return h(ctx, s, e.Records[i])
+		})
+
+		return batchResponse(failures), nil
+	}
+}
+
+// EventBridgeHandler returns a Lambda handler for EventBridge rules and schedules that calls `h`
+// with the event. See S3Handler.
+func EventBridgeHandler(s StoriServices, h EventBridgeEventHandler) func(context.Context, events.CloudWatchEvent) error {
+	return func(ctx context.Context, e events.CloudWatchEvent) error {
+		failures := handleRecords(ctx, s, "EventBridge", 1, false, func(int) string {
+			return e.ID
+		}, func(ctx context.Context, s StoriServices, _ int) error {
+			return h(ctx, s, EventBridgeEvent{e})
+		})
+
+		if len(failures) > 0 {
+			return failures[0].Err
+		}
+
+		return nil
+	}
+}
+
+// handleRecords calls `handle` for each of the `n` records of an event in order, and returns the
+// ones that failed. With `stopOnFailure` the records after the first failure are not handled, and
+// fail with errPreviousRecordFailed.
+func handleRecords(
+	ctx context.Context,
+	s StoriServices,
+	source string,
+	n int,
+	stopOnFailure bool,
+	id func(i int) string,
+	handle func(ctx context.Context, s StoriServices, i int) error,
+) []RecordFailure {
+	ctx, cancel := withDeadlineMargin(ctx, s.deadlineMargin())
+	defer cancel()
+
+	logger := invocationLogger(ctx, s.Logger)
+	ctx = slog.WithContext(ctx, s.Logger)
+
+	var failures []RecordFailure
+	for i := 0; i < n; i++ {
+		if stopOnFailure && len(failures) > 0 {
+			failures = append(failures, RecordFailure{Index: i, ID: id(i), Err: errPreviousRecordFailed})
+			continue
+		}
+
+		i := i
+		err := handleLogged(ctx, s, logger, source, id(i), func(ctx context.Context, s StoriServices) error {
+			return handle(ctx, s, i)
+		})
+		if err != nil {
+			failures = append(failures, RecordFailure{Index: i, ID: id(i), Err: err})
+		}
+	}
+
+	return failures
+}
+
+// handleLogged calls `handle` for the record `id` unless `ctx` is done, with a copy of `s` whose
+// Logger is `logger` with the fields of the record. The error of the record is logged.
+func handleLogged(ctx context.Context, s StoriServices, logger *zap.SugaredLogger, source, id string, handle func(context.Context, StoriServices) error) error {
+	s.Logger = logger.With("event_source", source, "record_id", id)
+
+	err := ctx.Err()
+	if err == nil {
+		err = handleRecord(ctx, s, handle)
+	}
+
+	if err != nil {
+		s.Logger.Errorw("error handling record", "err", err)
+	}
+
+	return err
+}
+
+// handleRecord calls `handle` for a record, recovering panics as errors
+func handleRecord(ctx context.Context, s StoriServices, handle func(context.Context, StoriServices) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.Logger.Errorw("panic handling record", "panic", r, "stacktrace", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return handle(ctx, s)
+}
+
+// newS3Record creates the S3Record of an S3 event record
+func newS3Record(r events.S3EventRecord) S3Record {
+	obj := aws.S3Object{
+		BucketName: r.S3.Bucket.Name,
+		Key:        r.S3.Object.URLDecodedKey,
+		Region:     r.AWSRegion,
+		VersionID:  r.S3.Object.VersionID,
+	}
+	obj.Url = obj.S3URI()
+
+	return S3Record{
+		Object:    obj,
+		EventName: r.EventName,
+		EventTime: r.EventTime,
+		Size:      r.S3.Object.Size,
+		ETag:      r.S3.Object.ETag,
+		Record:    r,
+	}
+}
+
+// recordsError returns a *RecordsError if there are failures
+func recordsError(source string, failures []RecordFailure) error {
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return &RecordsError{Source: source, Failures: failures}
+}
+
+// batchResponse reports `failures` as batch item failures
+func batchResponse(failures []RecordFailure) BatchResponse {
+	res := BatchResponse{BatchItemFailures: []BatchItemFailure{}}
+	for _, f := range failures {
+		res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{ItemIdentifier: f.ID})
+	}
+
+	return res
+}
+
+// decodeRecord decodes the JSON `data` of a record into `dst`
+func decodeRecord(kind, id, data string, dst interface{}) error {
+	if err := json.Unmarshal([]byte(data), dst); err != nil {
+		return fmt.Errorf("error decoding %s %s: %w", kind, id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/credifranco/stori-utils-go/aws"
+)
+
+type payment struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func newObservedServices() (StoriServices, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.InfoLevel)
+	return StoriServices{Logger: zap.New(core).Sugar()}, logs
+}
+
+func TestS3Handler(t *testing.T) {
+	a := assert.New(t)
+	s, logs := newObservedServices()
+
+	var e events.S3Event
+	a.NoError(json.Unmarshal([]byte(`{"Records":[{
+		"awsRegion":"us-east-1",
+		"eventName":"ObjectCreated:Put",
+		"s3":{"bucket":{"name":"stori-statements"},"object":{"key":"2022/statement+1.pdf","size":10,"versionId":"v1"}}
+	}]}`), &e))
+
+	var got S3Record
+	err := S3Handler(s, func(ctx context.Context, s StoriServices, r S3Record) error {
+		got = r
+		return nil
+	})(context.Background(), e)
+
+	a.NoError(err)
+	a.Equal(aws.S3Object{
+		BucketName: "stori-statements",
+		Key:        "2022/statement 1.pdf",
+		Region:     "us-east-1",
+		VersionID:  "v1",
+		Url:        "s3://stori-statements/2022/statement 1.pdf",
+	}, got.Object)
+	a.Equal("ObjectCreated:Put", got.EventName)
+	a.Equal(int64(10), got.Size)
+	a.Zero(logs.Len())
+}
+
+func TestSNSHandler(t *testing.T) {
+	a := assert.New(t)
+	s, logs := newObservedServices()
+
+	e := events.SNSEvent{Records: []events.SNSEventRecord{
+		{SNS: events.SNSEntity{MessageID: "1", Message: `{"id":"p1","amount":10}`}},
+		{SNS: events.SNSEntity{MessageID: "2", Message: `not json`}},
+		{SNS: events.SNSEntity{MessageID: "3", Message: `{"id":"p3","amount":30}`}},
+	}}
+
+	var got []payment
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "request-1"})
+	err := SNSHandler(s, func(ctx context.Context, s StoriServices, n SNSNotification) error {
+		var p payment
+		if err := n.Decode(&p); err != nil {
+			return err
+		}
+		if p.ID == "p3" {
+			panic("boom")
+		}
+		got = append(got, p)
+		return nil
+	})(ctx, e)
+
+	a.Equal([]payment{{"p1", 10}}, got)
+
+	var rerr *RecordsError
+	if a.ErrorAs(err, &rerr) {
+		a.Equal("SNS", rerr.Source)
+		if a.Len(rerr.Failures, 2) {
+			a.Equal(1, rerr.Failures[0].Index)
+			a.Equal("3", rerr.Failures[1].ID)
+			a.EqualError(rerr.Failures[1].Err, "panic: boom")
+		}
+	}
+
+	panics := logs.FilterMessage("panic handling record").All()
+	if a.Len(panics, 1) {
+		fields := panics[0].ContextMap()
+		a.Equal("request-1", fields["request_id"])
+		a.Equal("3", fields["record_id"])
+		a.Contains(fields["stacktrace"], "runtime/debug.Stack")
+	}
+	a.Equal(2, logs.FilterMessage("error handling record").Len())
+}
+
+func TestSQSHandler(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newObservedServices()
+
+	e := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "1", Body: `{"id":"p1"}`},
+		{MessageId: "2", Body: `{"id":"p2"}`},
+		{MessageId: "3", Body: `{"id":"p3"}`},
+	}}
+
+	// the records that are not started before the deadline also fail
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDeadlineMargin+50*time.Millisecond)
+	defer cancel()
+
+	res, err := SQSHandler(s, 1, func(ctx context.Context, s StoriServices, m SQSMessage) error {
+		var p payment
+		if err := m.Decode(&p); err != nil {
+			return err
+		}
+		if p.ID == "p1" {
+			return errors.New("declined")
+		}
+		<-ctx.Done()
+		return nil
+	})(ctx, e)
+
+	a.NoError(err)
+	a.Equal(BatchResponse{BatchItemFailures: []BatchItemFailure{{"1"}, {"3"}}}, res)
+
+	bb, _ := json.Marshal(BatchResponse{BatchItemFailures: []BatchItemFailure{}})
+	a.JSONEq(`{"batchItemFailures":[]}`, string(bb))
+}
+
+func TestSQSHandlerFIFO(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newObservedServices()
+	group := func(g string) map[string]string { return map[string]string{"MessageGroupId": g} }
+
+	e := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "1", Body: `{"id":"p1"}`, Attributes: group("a")},
+		{MessageId: "2", Body: `{"id":"p2"}`, Attributes: group("b")},
+		{MessageId: "3", Body: `{"id":"p3"}`, Attributes: group("a")},
+	}}
+
+	var mu sync.Mutex
+	var handled []string
+	res, err := SQSHandler(s, 2, func(ctx context.Context, s StoriServices, m SQSMessage) error {
+		mu.Lock()
+		handled = append(handled, m.MessageId)
+		mu.Unlock()
+
+		if m.MessageId == "1" {
+			return errors.New("declined")
+		}
+		return nil
+	})(context.Background(), e)
+
+	a.NoError(err)
+	a.Equal(BatchResponse{BatchItemFailures: []BatchItemFailure{{"1"}, {"3"}}}, res)
+	a.ElementsMatch([]string{"1", "2"}, handled, "a FIFO group should stop after its first failure")
+}
+
+func TestDynamoDBHandler(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newObservedServices()
+
+	e := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+		{EventName: "INSERT", Change: events.DynamoDBStreamRecord{SequenceNumber: "100"}},
+		{EventName: "REMOVE", Change: events.DynamoDBStreamRecord{SequenceNumber: "200"}},
+		{EventName: "INSERT", Change: events.DynamoDBStreamRecord{SequenceNumber: "300"}},
+	}}
+
+	var handled []string
+	res, err := DynamoDBHandler(s, func(ctx context.Context, s StoriServices, r events.DynamoDBEventRecord) error {
+		handled = append(handled, r.Change.SequenceNumber)
+		if r.EventName == "REMOVE" {
+			return errors.New("not supported")
+		}
+		return nil
+	})(context.Background(), e)
+
+	a.NoError(err)
+	a.Equal(BatchResponse{BatchItemFailures: []BatchItemFailure{{"200"}, {"300"}}}, res,
+		"the records after a failure should be reported as failed")
+	a.Equal([]string{"100", "200"}, handled, "the records after a failure should not be handled")
+}
+
+func TestEventBridgeHandler(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newObservedServices()
+
+	e := events.CloudWatchEvent{ID: "event-1", DetailType: "Scheduled Event", Detail: json.RawMessage(`{"id":"p1","amount":10}`)}
+
+	var got payment
+	err := EventBridgeHandler(s, func(ctx context.Context, s StoriServices, e EventBridgeEvent) error {
+		return e.Decode(&got)
+	})(context.Background(), e)
+
+	a.NoError(err)
+	a.Equal(payment{"p1", 10}, got)
+
+	e.Detail = json.RawMessage(`[]`)
+	err = EventBridgeHandler(s, func(ctx context.Context, s StoriServices, e EventBridgeEvent) error {
+		return e.Decode(&got)
+	})(context.Background(), e)
+	if a.Error(err) {
+		a.Contains(err.Error(), "error decoding EventBridge event event-1")
+	}
+}
+
+func TestEventHandlersDeadlineMargin(t *testing.T) {
+	a := assert.New(t)
+	s, err := NewStoriServices(context.Background(), StoriServicesConfig{},
+		WithLogger(zap.NewNop().Sugar()), WithDeadlineMargin(time.Second))
+	a.NoError(err)
+
+	lambdaDeadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), lambdaDeadline)
+	defer cancel()
+
+	var deadlines []time.Time
+	record := func(ctx context.Context) error {
+		d, _ := ctx.Deadline()
+		deadlines = append(deadlines, d)
+		return nil
+	}
+
+	a.NoError(EventBridgeHandler(s, func(ctx context.Context, _ StoriServices, _ EventBridgeEvent) error {
+		return record(ctx)
+	})(ctx, events.CloudWatchEvent{ID: "event-1"}))
+	_, err = SQSHandler(s, 1, func(ctx context.Context, _ StoriServices, _ SQSMessage) error {
+		return record(ctx)
+	})(ctx, events.SQSEvent{Records: []events.SQSMessage{{MessageId: "m1"}}})
+	a.NoError(err)
+
+	a.Equal([]time.Time{lambdaDeadline.Add(-time.Second), lambdaDeadline.Add(-time.Second)}, deadlines,
+		"the margin of the options should be used")
+}
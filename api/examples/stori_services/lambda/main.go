@@ -2,18 +2,16 @@ package main
 
 import (
 	"context"
-	"log"
 	"net/http"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
 
 	"github.com/credifranco/stori-utils-go/api"
 	"github.com/credifranco/stori-utils-go/aws"
 	"github.com/credifranco/stori-utils-go/db"
 )
 
-// handler wraps an api.APIGatewayHandlerFunc, allowing access to passed in StoriServices
+// handler is an api.HandlerFactory, allowing access to passed in StoriServices
 func handler(s api.StoriServices) api.APIGatewayHandlerFunc {
 	return func(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 		if val := e.QueryStringParameters["error"]; val == "true" {
@@ -36,11 +34,13 @@ func handler(s api.StoriServices) api.APIGatewayHandlerFunc {
 		li := aws.LambdaInvocation{
 			FunctionName:   "some-lambda",
 			Event:          lambdaEvent{map[string]string{"key": "value"}},
-			InvocationType: "RequestResponse",
+			InvocationType: aws.InvocationRequestResponse,
 		}
-		if res, err := li.InvokeLambda(s.LambdaAPI); err != nil {
-			// do nothing for this example, this isn't calling a real lambda
-			s.Logger.Errorw("Lambda error", "err", err, "resposne", res)
+		var out map[string]string
+		if _, err := li.Invoke(ctx, s.LambdaAPI, &out); err != nil {
+			// do nothing for this example, this isn't calling a real lambda. Failures of the
+			// function itself are returned as an *aws.FunctionError
+			s.Logger.Errorw("Lambda error", "err", err)
 		}
 
 		return api.JSONResponse(
@@ -53,16 +53,9 @@ func handler(s api.StoriServices) api.APIGatewayHandlerFunc {
 }
 
 func main() {
-	// get a StoriServices struct with a DB reader proxy
+	// create a StoriServices struct with a DB reader proxy once per container, and start the lambda.
+	// The logger of each invocation includes its request id, and if the services can not be
+	// created the invocation responds with a 500 and the next one tries again.
 	proxy := db.Read
-	s, err := api.NewStoriServices(
-		context.Background(),
-		api.StoriServicesConfig{DBProxy: &proxy, Lambda: true},
-	)
-	if err != nil {
-		log.Fatalf("error creating StoriServices: %v", err)
-	}
-
-	// call the lambda
-	lambda.Start(handler(s))
+	api.Start(api.StoriServicesConfig{DBProxy: &proxy, Lambda: true}, handler)
 }
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/credifranco/stori-utils-go/db"
+)
+
+// HealthCheckTimeout is the deadline for all the checks run by HealthHandler
+const HealthCheckTimeout = 3 * time.Second
+
+const (
+	HealthStatusOK             = "ok"
+	HealthStatusError          = "error"
+	HealthStatusNotInitialized = "not initialized"
+)
+
+// errNotInitialized is returned by the checks of lazy dependencies that have not been created
+var errNotInitialized = errors.New(HealthStatusNotInitialized)
+
+// HealthCheck is a single named check run by HealthHandler
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context, s StoriServices) error
+}
+
+// ComponentHealth is the result of a single HealthCheck
+type ComponentHealth struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthReport is the body returned by HealthHandler
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// proxyPinger is implemented by db.DBConnectors that can ping each db proxy separately, such as
+// db.AWSDB
+type proxyPinger interface {
+	Proxies() []db.DBProxies
+	PingProxy(ctx context.Context, dp db.DBProxies) error
+}
+
+// LambdaDryRunCheck returns a HealthCheck that validates access to the Lambda control plane by
+// invoking `functionName` with the DryRun invocation type. The function itself is not run.
+func LambdaDryRunCheck(functionName string) HealthCheck {
+	return HealthCheck{
+		Name: string(DependencyLambda),
+		Check: func(ctx context.Context, s StoriServices) error {
+			la, err := s.GetLambdaAPI(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = la.InvokeWithContext(ctx, &lambda.InvokeInput{
+				FunctionName:   aws.String(functionName),
+				InvocationType: aws.String(lambda.InvocationTypeDryRun),
+			})
+			return err
+		},
+	}
+}
+
+// SNSTopicCheck returns a HealthCheck that validates access to the SNS control plane by reading
+// the attributes of `topicARN`. Nothing is published.
+func SNSTopicCheck(topicARN string) HealthCheck {
+	return HealthCheck{
+		Name: string(DependencySNS),
+		Check: func(ctx context.Context, s StoriServices) error {
+			sa, err := s.GetSNSAPI(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = sa.GetTopicAttributesWithContext(ctx, &sns.GetTopicAttributesInput{
+				TopicArn: aws.String(topicARN),
+			})
+			return err
+		},
+	}
+}
+
+// healthChecks returns a HealthCheck for every configured dependency. A proxied DB gets one check
+// per proxy, named "db.read" and "db.write", and dependencies that can't be pinged (Lambda and SNS)
+// are reported as ok once created. Lazy dependencies that have not been used yet are reported as
+// not initialized, without creating them.
+func (s StoriServices) healthChecks() []HealthCheck {
+	if s.lifecycle == nil {
+		return nil
+	}
+
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+
+	var out []HealthCheck
+	for _, d := range dependencies {
+		v, ok := s.lifecycle.values[d]
+		if !ok {
+			if s.lazy != nil && s.lazy.values[d] != nil {
+				out = append(out, HealthCheck{
+					Name:  string(d),
+					Check: func(context.Context, StoriServices) error { return errNotInitialized },
+				})
+			}
+			continue
+		}
+
+		if pp, ok := v.(proxyPinger); ok {
+			for _, dp := range pp.Proxies() {
+				dp := dp
+				out = append(out, HealthCheck{
+					Name: fmt.Sprintf("%v.%v", d, dp),
+					Check: func(ctx context.Context, _ StoriServices) error {
+						return pp.PingProxy(ctx, dp)
+					},
+				})
+			}
+			continue
+		}
+
+		check := func(context.Context, StoriServices) error { return nil }
+		if p, ok := s.lifecycle.pingers[d]; ok {
+			check = func(ctx context.Context, _ StoriServices) error { return p(ctx) }
+		}
+		out = append(out, HealthCheck{Name: string(d), Check: check})
+	}
+
+	return out
+}
+
+// HealthReport runs a check for every configured dependency plus `extra` checks, in parallel. An
+// extra check replaces the dependency check with the same name. Checks that don't finish before
+// `ctx` is done are reported as errors, and lazy dependencies that have not been used yet as not
+// initialized.
+func (s StoriServices) HealthReport(ctx context.Context, extra ...HealthCheck) HealthReport {
+	checks := mergeHealthChecks(s.healthChecks(), extra)
+	out := HealthReport{Status: HealthStatusOK, Components: map[string]ComponentHealth{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c HealthCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			_, err := runWithTimeout(ctx, 0, func(ctx context.Context) (interface{}, error) {
+				return nil, c.Check(ctx, s)
+			})
+			ch := ComponentHealth{
+				Status:    HealthStatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if errors.Is(err, errNotInitialized) {
+				ch.Status, err = HealthStatusNotInitialized, nil
+			} else if err != nil {
+				ch.Status = HealthStatusError
+				ch.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			out.Components[c.Name] = ch
+			if err != nil {
+				out.Status = HealthStatusError
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return out
+}
+
+// mergeHealthChecks returns `checks` followed by `extra`, dropping the checks replaced by an extra
+// check with the same name
+func mergeHealthChecks(checks, extra []HealthCheck) []HealthCheck {
+	names := make(map[string]bool, len(extra))
+	for _, c := range extra {
+		names[c.Name] = true
+	}
+
+	out := make([]HealthCheck, 0, len(checks)+len(extra))
+	for _, c := range checks {
+		if !names[c.Name] {
+			out = append(out, c)
+		}
+	}
+
+	return append(out, extra...)
+}
+
+// HealthHandler returns an APIGatewayHandlerFunc for a `/health` endpoint. It checks every
+// configured dependency of `s` plus the `extra` checks (see LambdaDryRunCheck and SNSTopicCheck)
+// within HealthCheckTimeout, and responds with a HealthReport. The status code is 200 when every
+// check passed and 503 otherwise.
+func HealthHandler(s StoriServices, extra ...HealthCheck) APIGatewayHandlerFunc {
+	return func(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+		defer cancel()
+
+		report := s.HealthReport(ctx, extra...)
+
+		code := http.StatusOK
+		if report.Status != HealthStatusOK {
+			code = http.StatusServiceUnavailable
+		}
+
+		return JSONResponse(code, report)
+	}
+}
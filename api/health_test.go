@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/credifranco/stori-utils-go/db"
+)
+
+// fakeProxiedDB is a db.DBConnector whose write proxy is unreachable
+type fakeProxiedDB struct {
+	db.DBConnector
+}
+
+func (fakeProxiedDB) Proxies() []db.DBProxies { return []db.DBProxies{db.Read, db.Write} }
+
+func (fakeProxiedDB) PingProxy(_ context.Context, dp db.DBProxies) error {
+	if dp == db.Write {
+		return errors.New("write proxy down")
+	}
+	return nil
+}
+
+type fakeLambdaClient struct {
+	lambdaiface.LambdaAPI
+	input *lambda.InvokeInput
+}
+
+func (f *fakeLambdaClient) InvokeWithContext(_ context.Context, in *lambda.InvokeInput, _ ...request.Option) (*lambda.InvokeOutput, error) {
+	f.input = in
+	return &lambda.InvokeOutput{}, nil
+}
+
+func TestHealthHandler(t *testing.T) {
+	a := assert.New(t)
+	var closed []string
+	la := &fakeLambdaClient{}
+
+	s := StoriServices{LambdaAPI: la, lifecycle: newLifecycle()}
+	s.lifecycle.register(DependencyRedis, fakeDependency{closed: &closed})
+
+	h := HealthHandler(s, LambdaDryRunCheck("some-lambda"))
+	res, err := h(context.Background(), events.APIGatewayProxyRequest{})
+	a.NoError(err)
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal(lambda.InvocationTypeDryRun, *la.input.InvocationType)
+
+	var report HealthReport
+	a.NoError(json.Unmarshal([]byte(res.Body), &report))
+	a.Equal(HealthStatusOK, report.Status)
+	a.Contains(report.Components, "redis")
+	a.Contains(report.Components, "lambda")
+
+	s.lifecycle.register(DependencyDB, fakeProxiedDB{})
+	res, _ = HealthHandler(s)(context.Background(), events.APIGatewayProxyRequest{})
+	a.Equal(http.StatusServiceUnavailable, res.StatusCode)
+
+	report = HealthReport{}
+	a.NoError(json.Unmarshal([]byte(res.Body), &report))
+	a.Equal(HealthStatusError, report.Status)
+	a.Equal(HealthStatusOK, report.Components["db.read"].Status)
+	a.Equal(HealthStatusError, report.Components["db.write"].Status)
+	a.Equal("write proxy down", report.Components["db.write"].Error)
+}
+
+func TestHealthHandlerLazy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	var created int
+
+	s, err := NewStoriServices(ctx, StoriServicesConfig{Lambda: true, Lazy: []Dependency{DependencyDB, DependencyLambda}},
+		WithDBFactory(func(context.Context) (db.DBConnector, error) {
+			created++
+			return fakeProxiedDB{}, nil
+		}),
+		WithLambdaAPI(&fakeLambdaClient{}),
+	)
+	a.NoError(err)
+
+	res, err := HealthHandler(s)(ctx, events.APIGatewayProxyRequest{})
+	a.NoError(err)
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal(0, created, "lazy dependencies should not be created by the health check")
+
+	var report HealthReport
+	a.NoError(json.Unmarshal([]byte(res.Body), &report))
+	a.Equal(HealthStatusNotInitialized, report.Components["db"].Status)
+	a.Equal(HealthStatusNotInitialized, report.Components["lambda"].Status)
+
+	_, err = s.GetDB(ctx)
+	a.NoError(err)
+	_, err = s.GetLambdaAPI(ctx)
+	a.NoError(err)
+
+	res, _ = HealthHandler(s)(ctx, events.APIGatewayProxyRequest{})
+	a.Equal(http.StatusServiceUnavailable, res.StatusCode, "created lazy dependencies should be checked")
+	report = HealthReport{}
+	a.NoError(json.Unmarshal([]byte(res.Body), &report))
+	a.Equal("write proxy down", report.Components["db.write"].Error)
+	a.Equal(HealthStatusOK, report.Components["lambda"].Status)
+	a.Equal(1, created)
+
+	// eager clients are reported the same way
+	s, err = NewStoriServices(ctx, StoriServicesConfig{Lambda: true}, WithLambdaAPI(&fakeLambdaClient{}))
+	a.NoError(err)
+
+	res, _ = HealthHandler(s)(ctx, events.APIGatewayProxyRequest{})
+	report = HealthReport{}
+	a.NoError(json.Unmarshal([]byte(res.Body), &report))
+	a.Equal(HealthStatusOK, report.Components["lambda"].Status)
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/credifranco/stori-utils-go/db"
+	"github.com/credifranco/stori-utils-go/redis"
+)
+
+// Dependency names one of the optional services in StoriServices
+type Dependency string
+
+const (
+	DependencyDB     = Dependency("db")
+	DependencyLambda = Dependency("lambda")
+	DependencySNS    = Dependency("sns")
+	DependencyRedis  = Dependency("redis")
+)
+
+var ErrDependencyNotConfigured = errors.New("dependency not configured")
+
+// dependencies lists every Dependency in declaration order, which is the order they are registered
+// and the reverse of the order they are closed
+var dependencies = []Dependency{DependencyDB, DependencyLambda, DependencySNS, DependencyRedis}
+
+// InitError is returned when one or more dependencies fail to initialize. Errors holds the error of
+// each failed dependency.
+type InitError struct {
+	Errors map[Dependency]error
+}
+
+func (e *InitError) Error() string {
+	return "error initializing StoriServices: " + formatDependencyErrors(e.Errors)
+}
+
+// Failed returns the names of the dependencies that failed to initialize, in alphabetical order
+func (e *InitError) Failed() []Dependency {
+	return sortedDependencies(e.Errors)
+}
+
+// sortedDependencies returns the keys of `errs` in alphabetical order
+func sortedDependencies(errs map[Dependency]error) []Dependency {
+	out := make([]Dependency, 0, len(errs))
+	for d := range errs {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+
+	return out
+}
+
+// formatDependencyErrors renders `errs` as "dep: err; dep: err"
+func formatDependencyErrors(errs map[Dependency]error) string {
+	msgs := make([]string, 0, len(errs))
+	for _, d := range sortedDependencies(errs) {
+		msgs = append(msgs, fmt.Sprintf("%v: %v", d, errs[d]))
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// initFunc creates a single dependency
+type initFunc func(ctx context.Context) (interface{}, error)
+
+// lazyValue holds a dependency that is created on first use. Unlike sync.Once, a failed
+// initialization is retried on the next call, so a transient error doesn't break a warm container.
+type lazyValue struct {
+	mu   sync.Mutex
+	val  interface{}
+	done bool
+}
+
+// get returns the value of `l`, calling `f` to create it if needed. `onInit` is called with the
+// value when it is created, and if it fails the value is not kept.
+func (l *lazyValue) get(ctx context.Context, timeout time.Duration, f initFunc, onInit func(interface{}) error) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.done {
+		return l.val, nil
+	}
+
+	v, err := runWithTimeout(ctx, timeout, f)
+	if err != nil {
+		return nil, err
+	}
+	if err := onInit(v); err != nil {
+		return nil, err
+	}
+	l.val, l.done = v, true
+
+	return v, nil
+}
+
+// lazyServices is shared by all copies of a StoriServices, and holds its lazy dependencies
+type lazyServices struct {
+	config StoriServicesConfig
+	inits  map[Dependency]initFunc
+	values map[Dependency]*lazyValue
+}
+
+// initializers returns the initFuncs of the dependencies requested in `c`
+func (c StoriServicesConfig) initializers() map[Dependency]initFunc {
+	out := map[Dependency]initFunc{}
+
+	if c.DBProxy != nil {
+		proxy := *c.DBProxy
+		out[DependencyDB] = func(ctx context.Context) (interface{}, error) {
+			a := &db.AWSDB{}
+			if err := a.NewConnection(ctx, proxy); err != nil {
+				return nil, fmt.Errorf("error establishing database connection: %v", err)
+			}
+			return a, nil
+		}
+	}
+
+	if c.Lambda {
+		out[DependencyLambda] = func(context.Context) (interface{}, error) {
+			la, err := aws.NewLambdaClient()
+			if err != nil {
+				return nil, fmt.Errorf("error creating lambda client: %v", err)
+			}
+			return la, nil
+		}
+	}
+
+	if c.SNS {
+		out[DependencySNS] = func(context.Context) (interface{}, error) {
+			sa, err := aws.NewSNSClient()
+			if err != nil {
+				return nil, fmt.Errorf("error creating SNS client: %v", err)
+			}
+			return sa, nil
+		}
+	}
+
+	if c.RedisCache {
+		out[DependencyRedis] = func(ctx context.Context) (interface{}, error) {
+			r := &redis.RedisConn{}
+			if err := r.NewConn(ctx); err != nil {
+				return nil, fmt.Errorf("error creating Redis client: %v", err)
+			}
+			return r, nil
+		}
+	}
+
+	return out
+}
+
+// isLazy reports if `d` should be initialized on first use
+func (c StoriServicesConfig) isLazy(d Dependency) bool {
+	for _, l := range c.Lazy {
+		if l == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timeout returns the initialization timeout of `d`
+func (c StoriServicesConfig) timeout(d Dependency) time.Duration {
+	if t, ok := c.Timeouts[d]; ok {
+		return t
+	}
+
+	return c.Timeout
+}
+
+// runWithTimeout calls `f`, giving up when `timeout` is reached even if `f` doesn't respect its
+// context. A zero timeout waits for `f` or for `ctx` to be done. A value returned by `f` after
+// giving up is closed, so late connections are not leaked.
+func runWithTimeout(ctx context.Context, timeout time.Duration, f initFunc) (interface{}, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		val interface{}
+		err error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		v, err := f(ctx)
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.val, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				if c := closeFunc(r.val); c != nil {
+					_ = c()
+				}
+			}
+		}()
+		return nil, fmt.Errorf("aborted: %w", ctx.Err())
+	}
+}
+
+// initEager concurrently initializes every dependency in `inits`. The returned map only holds
+// the dependencies that were created successfully.
+func initEager(ctx context.Context, config StoriServicesConfig, inits map[Dependency]initFunc) (map[Dependency]interface{}, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	vals := map[Dependency]interface{}{}
+	errs := map[Dependency]error{}
+
+	for d, f := range inits {
+		wg.Add(1)
+		go func(d Dependency, f initFunc) {
+			defer wg.Done()
+
+			v, err := runWithTimeout(ctx, config.timeout(d), f)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[d] = err
+				return
+			}
+			vals[d] = v
+		}(d, f)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return vals, &InitError{Errors: errs}
+	}
+
+	return vals, nil
+}
+
+// hasDependencyType reports if `v` implements the interface of the dependency `d`
+func hasDependencyType(d Dependency, v interface{}) bool {
+	var ok bool
+	switch d {
+	case DependencyDB:
+		_, ok = v.(db.DBConnector)
+	case DependencyLambda:
+		_, ok = v.(lambdaiface.LambdaAPI)
+	case DependencySNS:
+		_, ok = v.(snsiface.SNSAPI)
+	case DependencyRedis:
+		_, ok = v.(redis.Cache)
+	}
+
+	return ok
+}
+
+// lazyGet returns the lazy dependency `d`, creating it if this is the first call. A value of the
+// wrong type is closed instead of being kept, so the next call tries to create it again.
+func (s StoriServices) lazyGet(ctx context.Context, d Dependency) (interface{}, error) {
+	if s.lazy == nil {
+		return nil, fmt.Errorf("%v: %w", d, ErrDependencyNotConfigured)
+	}
+
+	lv, ok := s.lazy.values[d]
+	if !ok {
+		return nil, fmt.Errorf("%v: %w", d, ErrDependencyNotConfigured)
+	}
+
+	v, err := lv.get(
+		ctx,
+		s.lazy.config.timeout(d),
+		s.lazy.inits[d],
+		func(v interface{}) error {
+			if !hasDependencyType(d, v) {
+				if c := closeFunc(v); c != nil {
+					_ = c()
+				}
+				return fmt.Errorf("unexpected type %T", v)
+			}
+			return s.lifecycle.register(d, v)
+		},
+	)
+	if errors.Is(err, ErrClosed) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &InitError{Errors: map[Dependency]error{d: err}}
+	}
+
+	return v, nil
+}
+
+// GetDB returns the DB dependency. If it was configured as lazy, the database connection is
+// established on the first call.
+func (s StoriServices) GetDB(ctx context.Context) (db.DBConnector, error) {
+	if s.DB != nil {
+		return s.DB, nil
+	}
+
+	v, err := s.lazyGet(ctx, DependencyDB)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(db.DBConnector), nil
+}
+
+// GetLambdaAPI returns the LambdaAPI dependency. If it was configured as lazy, the client is
+// created on the first call.
+func (s StoriServices) GetLambdaAPI(ctx context.Context) (lambdaiface.LambdaAPI, error) {
+	if s.LambdaAPI != nil {
+		return s.LambdaAPI, nil
+	}
+
+	v, err := s.lazyGet(ctx, DependencyLambda)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(lambdaiface.LambdaAPI), nil
+}
+
+// GetSNSAPI returns the SNSAPI dependency. If it was configured as lazy, the client is created on
+// the first call.
+func (s StoriServices) GetSNSAPI(ctx context.Context) (snsiface.SNSAPI, error) {
+	if s.SNSAPI != nil {
+		return s.SNSAPI, nil
+	}
+
+	v, err := s.lazyGet(ctx, DependencySNS)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(snsiface.SNSAPI), nil
+}
+
+// GetRedis returns the Redis dependency. If it was configured as lazy, the connection is
+// established on the first call.
+func (s StoriServices) GetRedis(ctx context.Context) (redis.Cache, error) {
+	if s.Redis != nil {
+		return s.Redis, nil
+	}
+
+	v, err := s.lazyGet(ctx, DependencyRedis)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(redis.Cache), nil
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HealthError is returned by StoriServices.Health when one or more dependencies are unreachable.
+// Errors holds the error of each failed dependency.
+type HealthError struct {
+	Errors map[Dependency]error
+}
+
+func (e *HealthError) Error() string {
+	return "unhealthy StoriServices dependencies: " + formatDependencyErrors(e.Errors)
+}
+
+// Failed returns the names of the unhealthy dependencies, in alphabetical order
+func (e *HealthError) Failed() []Dependency {
+	return sortedDependencies(e.Errors)
+}
+
+// ErrClosed is returned when a lazy dependency is requested after StoriServices.Close
+var ErrClosed = errors.New("StoriServices is closed")
+
+type closer struct {
+	name  Dependency
+	close func() error
+}
+
+// lifecycle keeps track of the initialized dependencies of a StoriServices, so they can be health
+// checked and closed. It is shared by all copies of a StoriServices.
+type lifecycle struct {
+	mu      sync.Mutex
+	closers []closer
+	pingers map[Dependency]func(context.Context) error
+	values  map[Dependency]interface{}
+	closed  bool
+}
+
+// exit is replaced in tests
+var exit = os.Exit
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		pingers: map[Dependency]func(context.Context) error{},
+		values:  map[Dependency]interface{}{},
+	}
+}
+
+// register adds the Close and Ping methods of the dependency `v`, if it has them. If the lifecycle
+// was already closed, `v` is closed right away and ErrClosed is returned.
+func (l *lifecycle) register(d Dependency, v interface{}) error {
+	c := closeFunc(v)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		if c != nil {
+			_ = c()
+		}
+		return fmt.Errorf("%v: %w", d, ErrClosed)
+	}
+
+	l.values[d] = v
+
+	if c != nil {
+		l.closers = append(l.closers, closer{d, c})
+	}
+
+	if p, ok := v.(interface{ Ping(context.Context) error }); ok {
+		l.pingers[d] = p.Ping
+	}
+
+	return nil
+}
+
+// closeFunc returns the Close method of `v`, or nil if it doesn't have one
+func closeFunc(v interface{}) func() error {
+	switch c := v.(type) {
+	case interface{ Close() error }:
+		return c.Close
+	case interface{ Close() }:
+		return func() error { c.Close(); return nil }
+	}
+
+	return nil
+}
+
+// Health pings every initialized dependency that supports it (DB and Redis) in parallel. Lazy
+// dependencies that have not been used yet are skipped. A *HealthError is returned if any
+// dependency failed to respond before `ctx` is done.
+func (s StoriServices) Health(ctx context.Context) error {
+	if s.lifecycle == nil {
+		return nil
+	}
+
+	s.lifecycle.mu.Lock()
+	pingers := make(map[Dependency]func(context.Context) error, len(s.lifecycle.pingers))
+	for d, p := range s.lifecycle.pingers {
+		pingers[d] = p
+	}
+	s.lifecycle.mu.Unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := map[Dependency]error{}
+
+	for d, p := range pingers {
+		wg.Add(1)
+		go func(d Dependency, p func(context.Context) error) {
+			defer wg.Done()
+
+			_, err := runWithTimeout(ctx, 0, func(ctx context.Context) (interface{}, error) {
+				return nil, p(ctx)
+			})
+			if err != nil {
+				mu.Lock()
+				errs[d] = err
+				mu.Unlock()
+			}
+		}(d, p)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &HealthError{Errors: errs}
+	}
+
+	return nil
+}
+
+// Close releases every initialized dependency in reverse order, and flushes the Logger. Eager
+// dependencies are ordered as they are declared (DB, Lambda, SNS, Redis), followed by the lazy ones
+// in the order they were created. Closing stops waiting on a dependency when `ctx` is done.
+// Calling Close more than once is a no-op, and lazy dependencies can't be created after it.
+func (s StoriServices) Close(ctx context.Context) error {
+	errs := map[Dependency]error{}
+
+	if s.lifecycle != nil {
+		s.lifecycle.mu.Lock()
+		closers := s.lifecycle.closers
+		alreadyClosed := s.lifecycle.closed
+		s.lifecycle.closers, s.lifecycle.closed = nil, true
+		s.lifecycle.mu.Unlock()
+
+		if alreadyClosed {
+			return nil
+		}
+
+		for i := len(closers) - 1; i >= 0; i-- {
+			c := closers[i]
+			_, err := runWithTimeout(ctx, 0, func(context.Context) (interface{}, error) {
+				return nil, c.close()
+			})
+			if err != nil {
+				errs[c.name] = err
+			}
+		}
+	}
+
+	if s.Logger != nil {
+		// Sync returns an error for stdout on most platforms, which is not actionable
+		_ = s.Logger.Sync()
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("error closing StoriServices: %v", formatDependencyErrors(errs))
+	}
+
+	return nil
+}
+
+// CloseOnSignal closes `s` and exits the process when it receives SIGTERM or SIGINT, for ECS
+// tasks, local runs and Lambda functions with extensions. `timeout` limits how long Close can take.
+// The returned function stops listening for the signals.
+func (s StoriServices) CloseOnSignal(timeout time.Duration) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			if s.Logger != nil {
+				s.Logger.Infow("shutting down", "signal", sig.String())
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			code := 0
+			if err := s.Close(ctx); err != nil {
+				if s.Logger != nil {
+					s.Logger.Errorw("error during shutdown", "err", err)
+					_ = s.Logger.Sync()
+				}
+				code = 1
+			}
+			exit(code)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigs)
+			close(done)
+		})
+	}
+}
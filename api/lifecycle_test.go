@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/credifranco/stori-utils-go/db"
+	"github.com/credifranco/stori-utils-go/redis"
+)
+
+// fakeDependency records calls to its Close and Ping methods
+type fakeDependency struct {
+	closed  *[]string
+	name    string
+	pingErr error
+}
+
+func (f fakeDependency) Close() error {
+	*f.closed = append(*f.closed, f.name)
+	return nil
+}
+
+func (f fakeDependency) Ping(context.Context) error { return f.pingErr }
+
+func TestClose(t *testing.T) {
+	a := assert.New(t)
+	var closed []string
+
+	s := StoriServices{Logger: zap.NewNop().Sugar(), lifecycle: newLifecycle()}
+	s.lifecycle.register(DependencyDB, fakeDependency{closed: &closed, name: "db"})
+	s.lifecycle.register(DependencyRedis, fakeDependency{closed: &closed, name: "redis"})
+
+	a.NoError(s.Close(context.Background()))
+	a.Equal([]string{"redis", "db"}, closed, "dependencies should be closed in reverse order")
+
+	a.NoError(s.Close(context.Background()))
+	a.Len(closed, 2, "closing twice should be a no-op")
+
+	a.NoError(StoriServices{}.Close(context.Background()), "zero value should close cleanly")
+}
+
+// fakeDB and fakeRedis are fakeDependencies of the DB and Redis types
+type fakeDB struct {
+	fakeDependency
+	db.DBConnector
+}
+
+func (f fakeDB) Close() { _ = f.fakeDependency.Close() }
+
+func (f fakeDB) Ping(ctx context.Context) error { return f.fakeDependency.Ping(ctx) }
+
+type fakeRedis struct {
+	fakeDependency
+	redis.Cache
+}
+
+func (f fakeRedis) Close() error { return f.fakeDependency.Close() }
+
+func (f fakeRedis) Ping(ctx context.Context) error { return f.fakeDependency.Ping(ctx) }
+
+// withFakeDependency creates `d` as a fakeDependency of its type
+func withFakeDependency(d Dependency, closed *[]string) Option {
+	return func(o *options) {
+		o.inits[d] = func(context.Context) (interface{}, error) {
+			f := fakeDependency{closed: closed, name: string(d)}
+			switch d {
+			case DependencyDB:
+				return fakeDB{fakeDependency: f}, nil
+			case DependencyLambda:
+				return struct {
+					fakeDependency
+					lambdaiface.LambdaAPI
+				}{fakeDependency: f}, nil
+			case DependencySNS:
+				return struct {
+					fakeDependency
+					snsiface.SNSAPI
+				}{fakeDependency: f}, nil
+			}
+			return fakeRedis{fakeDependency: f}, nil
+		}
+	}
+}
+
+func TestCloseOrder(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	// the eager dependencies are created concurrently, so check the order several times
+	for i := 0; i < 10; i++ {
+		var closed []string
+		s, err := NewStoriServices(ctx, StoriServicesConfig{},
+			WithLogger(zap.NewNop().Sugar()),
+			withFakeDependency(DependencyRedis, &closed),
+			withFakeDependency(DependencySNS, &closed),
+			withFakeDependency(DependencyLambda, &closed),
+			withFakeDependency(DependencyDB, &closed),
+		)
+		a.NoError(err)
+		a.NoError(s.Close(ctx))
+		a.Equal([]string{"redis", "sns", "lambda", "db"}, closed)
+	}
+}
+
+func TestLazyAfterClose(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	var closed []string
+
+	s, err := NewStoriServices(ctx, StoriServicesConfig{Lazy: []Dependency{DependencyDB}},
+		WithLogger(zap.NewNop().Sugar()),
+		withFakeDependency(DependencyDB, &closed),
+	)
+	a.NoError(err)
+	a.NoError(s.Close(ctx))
+
+	_, err = s.lazyGet(ctx, DependencyDB)
+	a.ErrorIs(err, ErrClosed)
+	a.Equal([]string{"db"}, closed, "a dependency created after Close should be closed")
+}
+
+func TestHealth(t *testing.T) {
+	a := assert.New(t)
+	var closed []string
+
+	s := StoriServices{lifecycle: newLifecycle()}
+	s.lifecycle.register(DependencyDB, fakeDependency{closed: &closed})
+	a.NoError(s.Health(context.Background()))
+
+	s.lifecycle.register(DependencyRedis, fakeDependency{closed: &closed, pingErr: errors.New("down")})
+	err := s.Health(context.Background())
+
+	var healthErr *HealthError
+	a.True(errors.As(err, &healthErr))
+	a.Equal([]Dependency{DependencyRedis}, healthErr.Failed())
+}
+
+func TestCloseOnSignal(t *testing.T) {
+	a := assert.New(t)
+	var closed []string
+
+	exited := make(chan int, 1)
+	exit = func(code int) { exited <- code }
+	t.Cleanup(func() { exit = os.Exit })
+
+	s := StoriServices{Logger: zap.NewNop().Sugar(), lifecycle: newLifecycle()}
+	s.lifecycle.register(DependencyDB, fakeDependency{closed: &closed, name: "db"})
+
+	stop := s.CloseOnSignal(time.Second)
+	defer stop()
+
+	a.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+	select {
+	case code := <-exited:
+		a.Equal(0, code)
+		a.Equal([]string{"db"}, closed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("services were not closed on SIGTERM")
+	}
+}
+
+func TestDependencyTypeError(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	wrongType := func(o *options) {
+		o.inits[DependencyDB] = func(context.Context) (interface{}, error) { return "not a db", nil }
+	}
+
+	_, err := NewStoriServices(ctx, StoriServicesConfig{}, WithLogger(zap.NewNop().Sugar()), wrongType)
+	var initErr *InitError
+	if a.True(errors.As(err, &initErr)) {
+		a.Equal("unexpected type string", initErr.Errors[DependencyDB].Error())
+	}
+
+	var closed []string
+	created := 0
+	wrongLazyType := func(o *options) {
+		o.inits[DependencyDB] = func(context.Context) (interface{}, error) {
+			created++
+			return fakeDependency{closed: &closed, name: "db"}, nil
+		}
+	}
+
+	s, err := NewStoriServices(ctx, StoriServicesConfig{Lazy: []Dependency{DependencyDB}},
+		WithLogger(zap.NewNop().Sugar()), wrongLazyType)
+	a.NoError(err)
+	for i := 0; i < 2; i++ {
+		conn, err := s.GetDB(ctx)
+		a.Nil(conn)
+		a.True(errors.As(err, &initErr), "a lazy dependency of the wrong type should be an error")
+	}
+	a.Equal(2, created, "a lazy dependency of the wrong type should not be cached")
+	a.Equal([]string{"db", "db"}, closed, "a lazy dependency of the wrong type should be closed")
+
+	a.NoError(s.Close(ctx))
+	a.Len(closed, 2, "a lazy dependency of the wrong type should not be registered")
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/credifranco/stori-utils-go/db"
+	"github.com/credifranco/stori-utils-go/redis"
+	"go.uber.org/zap"
+)
+
+// Option customizes how NewStoriServices creates its dependencies
+type Option func(*options)
+
+type options struct {
+	logger         *zap.SugaredLogger
+	inits          map[Dependency]initFunc
+	deadlineMargin time.Duration
+}
+
+// newOptions applies `opts` over the defaults, which create the dependencies enabled in `config`
+func newOptions(config StoriServicesConfig, opts []Option) options {
+	o := options{inits: config.initializers(), deadlineMargin: DefaultDeadlineMargin}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithLogger uses `l` as the Logger instead of creating one with log.NewLogger
+func WithLogger(l *zap.SugaredLogger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithDeadlineMargin sets how long before the Lambda deadline the context of the handlers started
+// with Start, and of the event handlers of the services like S3Handler, is done. Defaults to
+// DefaultDeadlineMargin.
+func WithDeadlineMargin(d time.Duration) Option {
+	return func(o *options) { o.deadlineMargin = d }
+}
+
+// WithDB uses `d` as the DB dependency instead of connecting to the AWS databases
+func WithDB(d db.DBConnector) Option {
+	return WithDBFactory(func(context.Context) (db.DBConnector, error) { return d, nil })
+}
+
+// WithDBFactory uses `f` to create the DB dependency
+func WithDBFactory(f func(ctx context.Context) (db.DBConnector, error)) Option {
+	return func(o *options) {
+		o.inits[DependencyDB] = func(ctx context.Context) (interface{}, error) { return f(ctx) }
+	}
+}
+
+// WithLambdaAPI uses `la` as the LambdaAPI dependency
+func WithLambdaAPI(la lambdaiface.LambdaAPI) Option {
+	return WithLambdaAPIFactory(func(context.Context) (lambdaiface.LambdaAPI, error) { return la, nil })
+}
+
+// WithLambdaAPIFactory uses `f` to create the LambdaAPI dependency
+func WithLambdaAPIFactory(f func(ctx context.Context) (lambdaiface.LambdaAPI, error)) Option {
+	return func(o *options) {
+		o.inits[DependencyLambda] = func(ctx context.Context) (interface{}, error) { return f(ctx) }
+	}
+}
+
+// WithSNSAPI uses `sa` as the SNSAPI dependency
+func WithSNSAPI(sa snsiface.SNSAPI) Option {
+	return WithSNSAPIFactory(func(context.Context) (snsiface.SNSAPI, error) { return sa, nil })
+}
+
+// WithSNSAPIFactory uses `f` to create the SNSAPI dependency
+func WithSNSAPIFactory(f func(ctx context.Context) (snsiface.SNSAPI, error)) Option {
+	return func(o *options) {
+		o.inits[DependencySNS] = func(ctx context.Context) (interface{}, error) { return f(ctx) }
+	}
+}
+
+// WithRedis uses `r` as the Redis dependency
+func WithRedis(r redis.Cache) Option {
+	return WithRedisFactory(func(context.Context) (redis.Cache, error) { return r, nil })
+}
+
+// WithRedisFactory uses `f` to create the Redis dependency
+func WithRedisFactory(f func(ctx context.Context) (redis.Cache, error)) Option {
+	return func(o *options) {
+		o.inits[DependencyRedis] = func(ctx context.Context) (interface{}, error) { return f(ctx) }
+	}
+}
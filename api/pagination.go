@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/credifranco/stori-utils-go/db"
+)
+
+const (
+	// DefaultPageLimit is the page size used when the `limit` query param is not set
+	DefaultPageLimit = 20
+	// MaxPageLimit is the largest page size a client can request
+	MaxPageLimit = 100
+)
+
+// Page is the standard JSON envelope for paginated list responses. NextCursor is null when there
+// are no more results.
+type Page struct {
+	Data       interface{} `json:"data"`
+	NextCursor *string     `json:"next_cursor"`
+}
+
+// ParsePage reads the `cursor` and `limit` query string parameters of `e` into a copy of `page`.
+// `page` should have the Column, IDColumn and Desc fields set by the caller; Limit and After are
+// overwritten. The cursor is verified with `s`, so a tampered cursor, or a cursor of a listing
+// sorted by another column or in another direction, returns db.ErrInvalidCursor.
+func ParsePage(e events.APIGatewayProxyRequest, s db.CursorSigner, page db.KeysetPage) (db.KeysetPage, error) {
+	page.Limit = DefaultPageLimit
+	page.After = nil
+
+	if l, ok := e.QueryStringParameters["limit"]; ok && l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > MaxPageLimit {
+			return page, fmt.Errorf("limit must be a number between 1 and %d", MaxPageLimit)
+		}
+		page.Limit = n
+	}
+
+	if token, ok := e.QueryStringParameters["cursor"]; ok && token != "" {
+		c, err := s.Decode(token)
+		if err != nil {
+			return page, err
+		}
+		if page, err = page.WithCursor(c); err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
+
+// PageResponse creates a 200 APIGatewayProxyResponse with a Page body. `next` is the cursor of the
+// last row in `data`, created with the KeysetPage.Cursor of the page, or nil if this is the last
+// page.
+func PageResponse(data interface{}, next *db.Cursor, s db.CursorSigner) (events.APIGatewayProxyResponse, error) {
+	out := Page{Data: data}
+
+	if next != nil {
+		token, err := s.Encode(*next)
+		if err != nil {
+			return JSONErrResponse(http.StatusInternalServerError, invalidJSONError)
+		}
+		out.NextCursor = &token
+	}
+
+	return JSONResponse(http.StatusOK, out)
+}
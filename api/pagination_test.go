@@ -0,0 +1,73 @@
+package api_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/credifranco/stori-utils-go/api"
+	"github.com/credifranco/stori-utils-go/db"
+)
+
+func TestParsePage(t *testing.T) {
+	a := assert.New(t)
+	s, _ := db.NewCursorSigner([]byte(strings.Repeat("k", 32)))
+	base := db.KeysetPage{Column: "created_at"}
+
+	page, err := api.ParsePage(events.APIGatewayProxyRequest{}, s, base)
+	a.NoError(err)
+	a.Equal(api.DefaultPageLimit, page.Limit)
+	a.Nil(page.After)
+
+	token, _ := s.Encode(base.Cursor("a", "b"))
+	page, err = api.ParsePage(
+		events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"cursor": token, "limit": "5"}},
+		s,
+		base,
+	)
+	a.NoError(err)
+	a.Equal(5, page.Limit)
+	a.Equal(&db.Cursor{Value: "a", ID: "b", Column: "created_at"}, page.After)
+	a.Equal("created_at", page.Column)
+
+	_, err = api.ParsePage(
+		events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"limit": "1000"}},
+		s,
+		base,
+	)
+	a.Error(err, "limit above the max should be rejected")
+
+	_, err = api.ParsePage(
+		events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"cursor": "x" + token}},
+		s,
+		base,
+	)
+	a.ErrorIs(err, db.ErrInvalidCursor)
+
+	// cursors of other listings
+	for _, other := range []db.KeysetPage{{Column: "amount"}, {Column: "created_at", Desc: true}} {
+		_, err = api.ParsePage(
+			events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"cursor": token}},
+			s,
+			other,
+		)
+		a.ErrorIs(err, db.ErrInvalidCursor, "a cursor sorted by %s desc=%v should be rejected", other.Column, other.Desc)
+	}
+}
+
+func TestPageResponse(t *testing.T) {
+	a := assert.New(t)
+	s, _ := db.NewCursorSigner([]byte(strings.Repeat("k", 32)))
+
+	res, err := api.PageResponse([]int{1, 2}, nil, s)
+	a.NoError(err)
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal(`{"data":[1,2],"next_cursor":null}`, res.Body)
+
+	res, _ = api.PageResponse([]int{1, 2}, &db.Cursor{Value: 2, ID: 2}, s)
+	token, _ := s.Encode(db.Cursor{Value: 2, ID: 2})
+	a.Equal(`{"data":[1,2],"next_cursor":"`+token+`"}`, res.Body)
+}
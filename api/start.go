@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	slog "github.com/credifranco/stori-utils-go/log"
+	"go.uber.org/zap"
+)
+
+// DefaultDeadlineMargin is how long before the Lambda deadline the context of a handler started
+// with Start is done, leaving time to log and respond before the function times out
+const DefaultDeadlineMargin = 500 * time.Millisecond
+
+// shutdownTimeout limits how long the services are closed for when the runtime shuts down
+const shutdownTimeout = 5 * time.Second
+
+const initFailedError = "service unavailable"
+
+// HandlerFactory creates the handler of a Lambda from its StoriServices. It is called for every
+// invocation, so it should only build the handler and not create dependencies.
+type HandlerFactory func(s StoriServices) APIGatewayHandlerFunc
+
+// Start creates the StoriServices once per container and starts the Lambda with the handler built
+// by `factory`. See NewHandler.
+func Start(config StoriServicesConfig, factory HandlerFactory, opts ...Option) {
+	lambda.Start(NewHandler(context.Background(), config, factory, opts...))
+}
+
+// NewHandler creates the StoriServices and returns a handler that, for every invocation, calls the
+// handler built by `factory` where:
+//   - the Logger of the services includes the request fields of the invocation, like its
+//     request_id, function_arn and the user_sub of the request. The context also carries the
+//     logger, for log.FromContext.
+//   - the context is done DefaultDeadlineMargin before the Lambda deadline
+//
+// If the services can not be created the error is logged, and the invocations respond with a 500
+// instead of crashing the container. Each invocation tries to create them again, until they are
+// created once. Then the services are closed on SIGTERM.
+func NewHandler(ctx context.Context, config StoriServicesConfig, factory HandlerFactory, opts ...Option) APIGatewayHandlerFunc {
+	h := newInitHandler(config, factory, newOptions(config, opts))
+	if _, err := h.init(ctx); err != nil {
+		h.logger.Errorw("error creating StoriServices", "err", err)
+	}
+
+	return h.handle
+}
+
+// initHandler creates the StoriServices of NewHandler. Like lazyValue, a failed initialization is
+// retried on the next invocation, so a transient error at cold start doesn't break a warm
+// container.
+type initHandler struct {
+	config  StoriServicesConfig
+	factory HandlerFactory
+	o       options
+	// logger reports the init errors, as the services may not have one
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	handler APIGatewayHandlerFunc
+	// stop stops closing the services on SIGTERM
+	stop func()
+}
+
+func newInitHandler(config StoriServicesConfig, factory HandlerFactory, o options) *initHandler {
+	return &initHandler{config: config, factory: factory, o: o, logger: fallbackLogger(o.logger)}
+}
+
+// init returns the handler of the services, creating them if needed
+func (h *initHandler) init(ctx context.Context) (APIGatewayHandlerFunc, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.handler != nil {
+		return h.handler, nil
+	}
+
+	s, err := newStoriServices(ctx, h.config, h.o)
+	if err != nil {
+		return nil, err
+	}
+
+	h.stop = s.CloseOnSignal(shutdownTimeout)
+	h.handler = wrapHandler(s, h.factory, h.o.deadlineMargin)
+
+	return h.handler, nil
+}
+
+// handle calls the handler of the services, or responds with a 500 if they can't be created
+func (h *initHandler) handle(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	initCtx, cancel := withDeadlineMargin(ctx, h.o.deadlineMargin)
+	handler, err := h.init(initCtx)
+	cancel()
+	if err != nil {
+		invocationLogger(ctx, h.logger).Errorw("StoriServices not available", "err", err)
+		return JSONErrResponse(http.StatusInternalServerError, initFailedError)
+	}
+
+	return handler(ctx, e)
+}
+
+// wrapHandler returns a handler that calls the handler of `factory` with the invocation logger and
+// deadline. The factory is called for every invocation with a copy of `s`, which is cheap as the
+// dependencies are shared.
+func wrapHandler(s StoriServices, factory HandlerFactory, margin time.Duration) APIGatewayHandlerFunc {
+	return func(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx = slog.WithAPIGatewayRequest(ctx, e)
+		is := s
+		is.Logger = invocationLogger(ctx, s.Logger)
+		ctx = slog.WithContext(ctx, s.Logger)
+
+		ctx, cancel := withDeadlineMargin(ctx, margin)
+		defer cancel()
+
+		return factory(is)(ctx, e)
+	}
+}
+
+// invocationLogger returns `logger` with the request fields of `ctx`, such as the request ID and
+// function ARN of the invocation
+func invocationLogger(ctx context.Context, logger *zap.SugaredLogger) *zap.SugaredLogger {
+	return slog.FromContext(slog.WithContext(ctx, logger))
+}
+
+// withDeadlineMargin returns a context that is done `margin` before the deadline of `ctx`, if it
+// has one
+func withDeadlineMargin(ctx context.Context, margin time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || margin <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, deadline.Add(-margin))
+}
+
+// fallbackLogger returns a logger to report init errors, which could come from the logger itself
+func fallbackLogger(logger *zap.SugaredLogger) *zap.SugaredLogger {
+	if logger != nil {
+		return logger
+	}
+
+	if l, err := slog.NewLogger(); err == nil {
+		return l
+	}
+
+	return zap.NewNop().Sugar()
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/credifranco/stori-utils-go/db"
+)
+
+func TestWrapHandler(t *testing.T) {
+	a := assert.New(t)
+	core, logs := observer.New(zap.InfoLevel)
+	s := StoriServices{Logger: zap.New(core).Sugar()}
+
+	var deadline time.Time
+	handler := wrapHandler(s, func(s StoriServices) APIGatewayHandlerFunc {
+		return func(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			deadline, _ = ctx.Deadline()
+			s.Logger.Infow("handled", "path", e.Path)
+			return JSONResponse(http.StatusOK, "ok")
+		}
+	}, time.Second)
+
+	lambdaDeadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), lambdaDeadline)
+	defer cancel()
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{
+		AwsRequestID:       "request-1",
+		InvokedFunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:stori-fn",
+	})
+
+	res, err := handler(ctx, events.APIGatewayProxyRequest{
+		Path:           "/accounts",
+		RequestContext: events.APIGatewayProxyRequestContext{RequestID: "api-request-1"},
+	})
+	a.NoError(err)
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal(lambdaDeadline.Add(-time.Second), deadline, "the deadline should leave the margin")
+
+	if a.Equal(1, logs.Len()) {
+		fields := logs.All()[0].ContextMap()
+		a.Equal("request-1", fields["request_id"])
+		a.Equal("arn:aws:lambda:us-east-1:123456789012:function:stori-fn", fields["function_arn"])
+		a.Equal("api-request-1", fields["api_request_id"])
+		a.Equal("/accounts", fields["path"])
+	}
+
+	// the fields of an invocation should not leak into the next one
+	_, _ = handler(context.Background(), events.APIGatewayProxyRequest{Path: "/cards"})
+	a.NotContains(logs.All()[1].ContextMap(), "request_id")
+}
+
+func TestNewHandlerInitError(t *testing.T) {
+	a := assert.New(t)
+	core, logs := observer.New(zap.InfoLevel)
+	called := false
+
+	handler := NewHandler(
+		context.Background(),
+		StoriServicesConfig{},
+		func(StoriServices) APIGatewayHandlerFunc {
+			called = true
+			return nil
+		},
+		WithLogger(zap.New(core).Sugar()),
+		WithDBFactory(func(context.Context) (db.DBConnector, error) { return nil, errors.New("connection refused") }),
+	)
+
+	res, err := handler(context.Background(), events.APIGatewayProxyRequest{})
+	a.NoError(err, "init errors should be a response, not a Lambda error")
+	a.Equal(http.StatusInternalServerError, res.StatusCode)
+	a.False(called, "the factory should not be called without services")
+
+	var body errorResponse
+	a.NoError(json.Unmarshal([]byte(res.Body), &body))
+	a.Equal(initFailedError, body.Error.Message)
+	a.Equal(2, logs.FilterMessage("error creating StoriServices").Len()+logs.FilterMessage("StoriServices not available").Len())
+}
+
+func TestNewHandlerInitRetry(t *testing.T) {
+	a := assert.New(t)
+	calls := 0
+	config := StoriServicesConfig{}
+	h := newInitHandler(config,
+		func(s StoriServices) APIGatewayHandlerFunc {
+			return func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return JSONResponse(http.StatusOK, "ok")
+			}
+		},
+		newOptions(config, []Option{
+			WithLogger(zap.NewNop().Sugar()),
+			WithDBFactory(func(context.Context) (db.DBConnector, error) {
+				if calls++; calls == 1 {
+					return nil, errors.New("connection refused")
+				}
+				return fakeDB{fakeDependency: fakeDependency{closed: &[]string{}, name: "db"}}, nil
+			}),
+		}),
+	)
+
+	_, err := h.init(context.Background())
+	a.Error(err)
+
+	res, err := h.handle(context.Background(), events.APIGatewayProxyRequest{})
+	a.NoError(err)
+	a.Equal(http.StatusOK, res.StatusCode, "the services should be created again after failing")
+	if a.NotNil(h.stop) {
+		h.stop()
+	}
+
+	res, err = h.handle(context.Background(), events.APIGatewayProxyRequest{})
+	a.NoError(err)
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal(2, calls, "the services should be created once")
+}
+
+func TestNewHandlerOptions(t *testing.T) {
+	a := assert.New(t)
+	applied := 0
+	countOption := func(*options) { applied++ }
+
+	// failing to init doesn't listen for SIGTERM
+	NewHandler(
+		context.Background(),
+		StoriServicesConfig{},
+		func(StoriServices) APIGatewayHandlerFunc { return nil },
+		WithLogger(zap.NewNop().Sugar()),
+		WithDBFactory(func(context.Context) (db.DBConnector, error) { return nil, errors.New("connection refused") }),
+		countOption,
+	)
+	a.Equal(1, applied, "options should be applied once")
+}
@@ -0,0 +1,480 @@
+// Package audit records a tamper-evident trail of sensitive operations, like a user changing their
+// account data or a Lambda moving money. Events are hash-chained, and the head of every chain is
+// kept in an Anchor, so altering, removing or reordering a recorded event is detected by Verify.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/credifranco/stori-utils-go/user"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofrs/uuid"
+)
+
+// Outcome is the result of an audited operation
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	// OutcomeDenied is an operation rejected by an authorization check
+	OutcomeDenied Outcome = "denied"
+)
+
+// Actor types
+const (
+	ActorUser    = "user"
+	ActorService = "service"
+)
+
+// Actor is who performed an operation
+type Actor struct {
+	Type string `json:"type"`
+	// ID is the Cognito sub of users, or the name of services
+	ID    string `json:"id"`
+	Email string `json:"email,omitempty"`
+}
+
+// UserActor returns the Actor of a Cognito user
+func UserActor(u user.CognitoUser) Actor {
+	return Actor{Type: ActorUser, ID: u.Sub, Email: u.Email}
+}
+
+// ServiceActor returns the Actor of a service, like the name of a Lambda function
+func ServiceActor(name string) Actor {
+	return Actor{Type: ActorService, ID: name}
+}
+
+// ActorFromRequest returns the Actor of the Cognito user authenticated in an API Gateway request
+func ActorFromRequest(e events.APIGatewayProxyRequestContext) (Actor, error) {
+	u, err := user.GetCognitoUser(e)
+	if err != nil {
+		return Actor{}, err
+	}
+
+	return UserActor(u), nil
+}
+
+func (a Actor) Validate() error {
+	return v.ValidateStruct(&a,
+		v.Field(&a.Type, v.Required),
+		v.Field(&a.ID, v.Required),
+	)
+}
+
+// Resource is what an operation was performed on
+type Resource struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// Change is the before and after JSON values of a field changed by an operation. Before is null
+// for added fields and After is null for removed fields.
+type Change struct {
+	// Field is the dotted path of the field, like address.zip_code
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Event is an audited operation
+type Event struct {
+	// ID is set by Recorder.Record if empty
+	ID string `json:"id"`
+	// Time is set to the current time by Recorder.Record if zero, and is always stored in UTC
+	Time     time.Time         `json:"time"`
+	Actor    Actor             `json:"actor"`
+	Action   string            `json:"action"`
+	Resource Resource          `json:"resource"`
+	Changes  []Change          `json:"changes,omitempty"`
+	Outcome  Outcome           `json:"outcome"`
+	Reason   string            `json:"reason,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// The chain fields are set by Recorder.Record
+	ChainID  string `json:"chain_id"`
+	Sequence uint64 `json:"sequence"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// ComputeHash returns the hex encoded SHA-256 of the JSON of the event without its Hash. The
+// PrevHash is included, which chains the event to the previous one.
+func (e Event) ComputeHash() (string, error) {
+	e.Hash = ""
+	bb, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(bb)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Diff returns the fields that differ between the JSON encodings of `before` and `after`, sorted by
+// field. Nested objects are compared field by field, and any other values as a whole. Either can be
+// nil, for created or deleted resources.
+func Diff(before, after interface{}) ([]Change, error) {
+	b, err := jsonValue(before)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding before: %w", err)
+	}
+	a, err := jsonValue(after)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding after: %w", err)
+	}
+
+	var changes []Change
+	if err := diff("", b, a, &changes); err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	return changes, nil
+}
+
+func diff(field string, before, after interface{}, changes *[]Change) error {
+	bm, bok := before.(map[string]interface{})
+	am, aok := after.(map[string]interface{})
+	if bok && aok || bok && after == nil || aok && before == nil {
+		for k, x := range bm {
+			if err := diff(join(field, k), x, am[k], changes); err != nil {
+				return err
+			}
+		}
+		for k, x := range am {
+			if _, ok := bm[k]; !ok {
+				if err := diff(join(field, k), nil, x, changes); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	bb, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	ab, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	if string(bb) != string(ab) {
+		*changes = append(*changes, Change{Field: field, Before: bb, After: ab})
+	}
+
+	return nil
+}
+
+func join(field, key string) string {
+	if field == "" {
+		return key
+	}
+
+	return field + "." + key
+}
+
+// jsonValue returns `v` encoded and decoded as JSON, keeping the precision of numbers
+func jsonValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var jv interface{}
+	return jv, unmarshal(bb, &jv)
+}
+
+// Sink stores audit events. Sinks are durable unless they implement a Durable method that returns
+// false, like LoggerSink, whose events can't be read back to be verified.
+type Sink interface {
+	Write(ctx context.Context, e Event) error
+}
+
+// durable reports if the events written to `s` can be verified
+func durable(s Sink) bool {
+	d, ok := s.(interface{ Durable() bool })
+	return !ok || d.Durable()
+}
+
+// ChainHead is the last event of a chain that was written to a durable sink. A chain without
+// events has a zero Sequence.
+type ChainHead struct {
+	ChainID   string    `json:"chain_id"`
+	StartedAt time.Time `json:"started_at"`
+	Sequence  uint64    `json:"sequence"`
+	Hash      string    `json:"hash"`
+}
+
+// Anchor keeps the head of every chain, so that Verify detects the removal of the newest events of
+// a chain or of a whole chain. It must be stored where the sinks can't be used to rewrite it, like
+// a table that the role writing the events can't update, or an S3 bucket with Object Lock.
+type Anchor interface {
+	// Save stores `head`, unless the stored head of its chain has a higher Sequence
+	Save(ctx context.Context, head ChainHead) error
+	// Heads returns the heads of every chain
+	Heads(ctx context.Context) ([]ChainHead, error)
+}
+
+// Recorder records events to its sinks, chaining each event to the previous one. Each Recorder
+// starts its own chain, so it should be created once per process and shared.
+type Recorder struct {
+	anchor Anchor
+	sinks  []Sink
+
+	mu   sync.Mutex
+	head ChainHead
+}
+
+// NewRecorder creates a Recorder that writes to `sinks`, starting a chain saved in `anchor`
+func NewRecorder(ctx context.Context, anchor Anchor, sinks ...Sink) (*Recorder, error) {
+	r := &Recorder{anchor: anchor, sinks: sinks}
+	if err := r.start(ctx); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// start saves a new chain in the anchor and makes it the chain of the recorder
+func (r *Recorder) start(ctx context.Context) error {
+	chainID, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	head := ChainHead{ChainID: chainID.String(), StartedAt: time.Now().UTC()}
+	if err := r.anchor.Save(ctx, head); err != nil {
+		return err
+	}
+	r.head = head
+
+	return nil
+}
+
+// ChainID returns the id of the current chain of the recorder
+func (r *Recorder) ChainID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.head.ChainID
+}
+
+// Record chains `e` and writes it to every sink, returning the recorded event. The events are
+// written in order, one at a time. The chain advances, and its head is saved in the anchor, when
+// at least one durable sink writes the event, so an event missing from the other sinks is reported
+// by Verify. If every durable sink fails, the event is not part of the chain, and the next event
+// starts a new chain, so it doesn't collide with an event that a failed sink partially wrote.
+func (r *Recorder) Record(ctx context.Context, e Event) (Event, error) {
+	if e.Outcome == "" {
+		e.Outcome = OutcomeSuccess
+	}
+	if err := v.ValidateStruct(&e,
+		v.Field(&e.Actor),
+		v.Field(&e.Action, v.Required),
+		v.Field(&e.Outcome, v.In(OutcomeSuccess, OutcomeFailure, OutcomeDenied)),
+	); err != nil {
+		return e, err
+	}
+
+	if e.ID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return e, err
+		}
+		e.ID = id.String()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.head.ChainID == "" {
+		if err := r.start(ctx); err != nil {
+			return e, err
+		}
+	}
+
+	e.ChainID = r.head.ChainID
+	e.Sequence = r.head.Sequence + 1
+	e.PrevHash = r.head.Hash
+	hash, err := e.ComputeHash()
+	if err != nil {
+		return e, err
+	}
+	e.Hash = hash
+
+	var errs []error
+	written := false
+	for _, s := range r.sinks {
+		if err := s.Write(ctx, e); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		written = written || durable(s)
+	}
+
+	if !written {
+		r.head = ChainHead{}
+		return e, &SinkError{Errs: append(errs, ErrNotRecorded)}
+	}
+
+	r.head.Sequence, r.head.Hash = e.Sequence, e.Hash
+	if err := r.anchor.Save(ctx, r.head); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return e, &SinkError{Errs: errs}
+	}
+
+	return e, nil
+}
+
+// ErrNotRecorded is wrapped by the SinkError of Record when no durable sink wrote the event
+var ErrNotRecorded = errors.New("audit event not recorded by any durable sink")
+
+// SinkError is returned by Record when sinks or the anchor fail to write an event
+type SinkError struct {
+	Errs []error
+}
+
+func (e *SinkError) Error() string {
+	msg := fmt.Sprintf("error writing audit event to %d sink(s)", len(e.Errs))
+	for _, err := range e.Errs {
+		msg += ": " + err.Error()
+	}
+
+	return msg
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Errs[0]
+}
+
+// Is reports if any of the errors of the sinks is `target`
+func (e *SinkError) Is(target error) bool {
+	for _, err := range e.Errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrTampered is wrapped by the errors of Verify
+var ErrTampered = errors.New("audit events were tampered with")
+
+// TamperError is the first inconsistency found by Verify
+type TamperError struct {
+	ChainID  string
+	Sequence uint64
+	Reason   string
+}
+
+func (e *TamperError) Error() string {
+	return fmt.Sprintf("%s: chain %s, sequence %d: %s", ErrTampered, e.ChainID, e.Sequence, e.Reason)
+}
+
+func (e *TamperError) Unwrap() error {
+	return ErrTampered
+}
+
+// Verify checks the hash chains of `events`, which can be in any order and from several chains,
+// against the `heads` saved in the Anchor. Every chain of the events must have a head, and every
+// head must have its events, from sequence 1 to the event of the head. Events after the head are
+// accepted, as the anchor is saved after the sinks. A *TamperError is returned for the first
+// modified, missing, duplicated or reordered event. To verify some of the chains, pass only their
+// heads and events.
+func Verify(events []Event, heads []ChainHead) error {
+	chains := map[string][]Event{}
+	for _, e := range events {
+		chains[e.ChainID] = append(chains[e.ChainID], e)
+	}
+
+	anchored := map[string]ChainHead{}
+	for _, h := range heads {
+		anchored[h.ChainID] = h
+	}
+
+	var ids []string
+	for id := range chains {
+		ids = append(ids, id)
+	}
+	for id := range anchored {
+		if _, ok := chains[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		chain := chains[id]
+		sort.SliceStable(chain, func(i, j int) bool { return chain[i].Sequence < chain[j].Sequence })
+
+		head, ok := anchored[id]
+		if !ok {
+			return &TamperError{ChainID: id, Sequence: chain[0].Sequence, Reason: "chain not anchored"}
+		}
+
+		if err := verifyChain(id, chain); err != nil {
+			return err
+		}
+
+		if uint64(len(chain)) < head.Sequence {
+			return &TamperError{ChainID: id, Sequence: uint64(len(chain) + 1), Reason: "missing event"}
+		}
+		if head.Sequence > 0 && chain[head.Sequence-1].Hash != head.Hash {
+			return &TamperError{ChainID: id, Sequence: head.Sequence, Reason: "hash doesn't match the anchor"}
+		}
+	}
+
+	return nil
+}
+
+// verifyChain checks the hashes of the events of a chain, sorted by sequence
+func verifyChain(id string, chain []Event) error {
+	prevHash := ""
+	for i, e := range chain {
+		tamperErr := func(reason string) error {
+			return &TamperError{ChainID: id, Sequence: e.Sequence, Reason: reason}
+		}
+
+		if e.Sequence != uint64(i+1) {
+			if e.Sequence == uint64(i) {
+				return tamperErr("duplicated sequence")
+			}
+			return &TamperError{ChainID: id, Sequence: uint64(i + 1), Reason: "missing event"}
+		}
+		if e.PrevHash != prevHash {
+			return tamperErr("previous hash doesn't match")
+		}
+		hash, err := e.ComputeHash()
+		if err != nil {
+			return err
+		}
+		if e.Hash != hash {
+			return tamperErr("hash doesn't match")
+		}
+		prevHash = e.Hash
+	}
+
+	return nil
+}
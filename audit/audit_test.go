@@ -0,0 +1,314 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/credifranco/stori-utils-go/audit"
+	"github.com/credifranco/stori-utils-go/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// audit.Sink keeping the events in memory
+type memorySink struct {
+	events []audit.Event
+	err    error
+}
+
+func (s *memorySink) Write(_ context.Context, e audit.Event) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+// audit.Anchor keeping the heads in memory
+type memoryAnchor struct {
+	heads map[string]audit.ChainHead
+	err   error
+}
+
+func newMemoryAnchor() *memoryAnchor {
+	return &memoryAnchor{heads: map[string]audit.ChainHead{}}
+}
+
+func (a *memoryAnchor) Save(_ context.Context, h audit.ChainHead) error {
+	if a.err != nil {
+		return a.err
+	}
+	if old, ok := a.heads[h.ChainID]; !ok || old.Sequence < h.Sequence {
+		a.heads[h.ChainID] = h
+	}
+	return nil
+}
+
+func (a *memoryAnchor) Heads(context.Context) ([]audit.ChainHead, error) {
+	var heads []audit.ChainHead
+	for _, h := range a.heads {
+		heads = append(heads, h)
+	}
+	return heads, nil
+}
+
+type account struct {
+	Name    string            `json:"name"`
+	Limit   int64             `json:"limit"`
+	Address map[string]string `json:"address,omitempty"`
+}
+
+func TestDiff(t *testing.T) {
+	a := assert.New(t)
+
+	changes, err := audit.Diff(
+		account{Name: "Jane", Limit: 1000, Address: map[string]string{"zip": "01000", "city": "CDMX"}},
+		account{Name: "Jane", Limit: 2000, Address: map[string]string{"zip": "03100", "state": "CDMX"}},
+	)
+	a.NoError(err)
+	a.Equal([]audit.Change{
+		{Field: "address.city", Before: json.RawMessage(`"CDMX"`), After: json.RawMessage(`null`)},
+		{Field: "address.state", Before: json.RawMessage(`null`), After: json.RawMessage(`"CDMX"`)},
+		{Field: "address.zip", Before: json.RawMessage(`"01000"`), After: json.RawMessage(`"03100"`)},
+		{Field: "limit", Before: json.RawMessage(`1000`), After: json.RawMessage(`2000`)},
+	}, changes)
+
+	changes, err = audit.Diff(nil, account{Name: "Jane"})
+	a.NoError(err)
+	a.Len(changes, 2, "every field should be added")
+
+	changes, err = audit.Diff(account{Name: "Jane"}, account{Name: "Jane"})
+	a.NoError(err)
+	a.Empty(changes)
+
+	_, err = audit.Diff(nil, func() {})
+	a.Error(err)
+}
+
+func TestActorFromRequest(t *testing.T) {
+	a := assert.New(t)
+
+	actor, err := audit.ActorFromRequest(events.APIGatewayProxyRequestContext{
+		Authorizer: map[string]interface{}{"claims": map[string]interface{}{
+			"sub":   "0b9e5e4f-4c9c-4f0e-9d3c-5a4f3f6b2a10",
+			"email": "jane@stori.mx",
+		}},
+	})
+	a.NoError(err)
+	a.Equal(audit.Actor{Type: audit.ActorUser, ID: "0b9e5e4f-4c9c-4f0e-9d3c-5a4f3f6b2a10", Email: "jane@stori.mx"}, actor)
+	a.Equal(actor, audit.UserActor(user.CognitoUser{Sub: actor.ID, Email: actor.Email}))
+
+	_, err = audit.ActorFromRequest(events.APIGatewayProxyRequestContext{})
+	a.Error(err)
+}
+
+func TestRecorder(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	sink := &memorySink{}
+	anchor := newMemoryAnchor()
+
+	r, err := audit.NewRecorder(ctx, anchor, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Equal(uint64(0), anchor.heads[r.ChainID()].Sequence, "the chain should be anchored when created")
+
+	first, err := r.Record(ctx, audit.Event{
+		Actor:    audit.ServiceActor("stori-transfers"),
+		Action:   "transfer.create",
+		Resource: audit.Resource{Type: "account", ID: "1"},
+		Time:     time.Date(2022, 3, 1, 12, 0, 0, 0, time.FixedZone("CST", -6*3600)),
+		Metadata: map[string]string{"amount": "100.50"},
+	})
+	a.NoError(err)
+	a.NotEmpty(first.ID)
+	a.Equal(time.UTC, first.Time.Location())
+	a.Equal(audit.OutcomeSuccess, first.Outcome)
+	a.Equal(r.ChainID(), first.ChainID)
+	a.Equal(uint64(1), first.Sequence)
+	a.Empty(first.PrevHash)
+	a.Len(first.Hash, 64)
+
+	second, err := r.Record(ctx, audit.Event{
+		Actor:   audit.ServiceActor("stori-transfers"),
+		Action:  "transfer.create",
+		Outcome: audit.OutcomeDenied,
+		Reason:  "insufficient funds",
+	})
+	a.NoError(err)
+	a.Equal(uint64(2), second.Sequence)
+	a.Equal(first.Hash, second.PrevHash)
+	a.Len(sink.events, 2)
+	a.Equal(audit.ChainHead{ChainID: second.ChainID, StartedAt: anchor.heads[second.ChainID].StartedAt, Sequence: 2, Hash: second.Hash},
+		anchor.heads[second.ChainID])
+
+	_, err = r.Record(ctx, audit.Event{Action: "transfer.create"})
+	a.Error(err, "the actor should be required")
+	_, err = r.Record(ctx, audit.Event{Actor: audit.ServiceActor("stori-transfers"), Action: "x", Outcome: "ok"})
+	a.Error(err, "the outcome should be validated")
+	a.Len(sink.events, 2, "invalid events should not be written")
+
+	// the memory sink keeps the event even if it fails, like a partial write
+	sink.err = errors.New("sink down")
+	_, err = r.Record(ctx, audit.Event{Actor: audit.ServiceActor("stori-transfers"), Action: "transfer.create"})
+	var sinkErr *audit.SinkError
+	a.True(errors.As(err, &sinkErr))
+	a.True(errors.Is(err, audit.ErrNotRecorded))
+	a.Equal(uint64(2), anchor.heads[second.ChainID].Sequence, "the chain should not advance when every sink fails")
+
+	sink.err = nil
+	next, err := r.Record(ctx, audit.Event{Actor: audit.ServiceActor("stori-transfers"), Action: "transfer.create"})
+	a.NoError(err)
+	a.NotEqual(second.ChainID, next.ChainID, "a new chain should be started after a failure")
+	a.Equal(uint64(1), next.Sequence)
+
+	heads, _ := anchor.Heads(ctx)
+	a.NoError(audit.Verify(sink.events, heads), "an outage should not be reported as tampering")
+
+	// a durable sink is needed to advance the chain
+	logger := &memorySink{}
+	r, err = audit.NewRecorder(ctx, anchor, loggerSink{logger}, sink)
+	a.NoError(err)
+	sink.err = errors.New("sink down")
+	_, err = r.Record(ctx, audit.Event{Actor: audit.ServiceActor("stori-transfers"), Action: "transfer.create"})
+	a.True(errors.Is(err, audit.ErrNotRecorded))
+	a.Len(logger.events, 1)
+
+	sink.err = nil
+	anchor.err = errors.New("anchor down")
+	_, err = r.Record(ctx, audit.Event{Actor: audit.ServiceActor("stori-transfers"), Action: "transfer.create"})
+	a.Error(err, "the new chain should not be started if it can't be anchored")
+	_, err = audit.NewRecorder(ctx, anchor, sink)
+	a.Error(err)
+}
+
+// loggerSink is a memorySink that is not durable
+type loggerSink struct {
+	*memorySink
+}
+
+func (loggerSink) Durable() bool {
+	return false
+}
+
+func TestVerify(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	sink := &memorySink{}
+	anchor := newMemoryAnchor()
+
+	// two chains
+	for i := 0; i < 2; i++ {
+		r, err := audit.NewRecorder(ctx, anchor, sink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 3; j++ {
+			_, err := r.Record(ctx, audit.Event{Actor: audit.ServiceActor("stori-transfers"), Action: "transfer.create"})
+			a.NoError(err)
+		}
+	}
+	// a chain without events
+	_, err := audit.NewRecorder(ctx, anchor, sink)
+	a.NoError(err)
+
+	valid := sink.events
+	heads, _ := anchor.Heads(ctx)
+	a.Len(heads, 3)
+	a.NoError(audit.Verify(valid, heads))
+
+	// events stored as JSON still verify
+	bb, err := json.Marshal(valid)
+	a.NoError(err)
+	var decoded []audit.Event
+	a.NoError(json.Unmarshal(bb, &decoded))
+	a.NoError(audit.Verify(decoded, heads))
+
+	// in any order
+	reversed := make([]audit.Event, len(valid))
+	for i, e := range valid {
+		reversed[len(valid)-1-i] = e
+	}
+	a.NoError(audit.Verify(reversed, heads))
+
+	tampered := func(f func(ee []audit.Event) []audit.Event) error {
+		return audit.Verify(f(append([]audit.Event(nil), valid...)), heads)
+	}
+
+	err = tampered(func(ee []audit.Event) []audit.Event {
+		ee[1].Outcome = audit.OutcomeFailure
+		return ee
+	})
+	var tamperErr *audit.TamperError
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal(valid[1].ChainID, tamperErr.ChainID)
+		a.Equal(uint64(2), tamperErr.Sequence)
+		a.Equal("hash doesn't match", tamperErr.Reason)
+	}
+	a.True(errors.Is(err, audit.ErrTampered))
+
+	// recomputing the hash of the modified event breaks the link to the next one
+	err = tampered(func(ee []audit.Event) []audit.Event {
+		ee[1].Outcome = audit.OutcomeFailure
+		ee[1].Hash, _ = ee[1].ComputeHash()
+		return ee
+	})
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal(uint64(3), tamperErr.Sequence)
+		a.Equal("previous hash doesn't match", tamperErr.Reason)
+	}
+
+	err = tampered(func(ee []audit.Event) []audit.Event {
+		return append(ee[:1], ee[2:]...)
+	})
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal(uint64(2), tamperErr.Sequence)
+		a.Equal("missing event", tamperErr.Reason)
+	}
+
+	err = tampered(func(ee []audit.Event) []audit.Event {
+		return append(ee, ee[1])
+	})
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal("duplicated sequence", tamperErr.Reason)
+	}
+
+	// removing the newest events of a chain
+	err = tampered(func(ee []audit.Event) []audit.Event {
+		return append(ee[:1], ee[3:]...)
+	})
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal(valid[0].ChainID, tamperErr.ChainID)
+		a.Equal(uint64(2), tamperErr.Sequence)
+		a.Equal("missing event", tamperErr.Reason)
+	}
+
+	// removing a whole chain
+	err = tampered(func(ee []audit.Event) []audit.Event {
+		return ee[3:]
+	})
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal(valid[0].ChainID, tamperErr.ChainID)
+		a.Equal(uint64(1), tamperErr.Sequence)
+		a.Equal("missing event", tamperErr.Reason)
+	}
+
+	// replacing the newest event with a valid chain of other events
+	err = tampered(func(ee []audit.Event) []audit.Event {
+		forged := ee[2]
+		forged.Outcome = audit.OutcomeFailure
+		forged.Hash, _ = forged.ComputeHash()
+		return append(ee[:2], append([]audit.Event{forged}, ee[3:]...)...)
+	})
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal(uint64(3), tamperErr.Sequence)
+		a.Equal("hash doesn't match the anchor", tamperErr.Reason)
+	}
+
+	// a chain that is not in the anchor
+	err = audit.Verify(valid, heads[:0])
+	if a.True(errors.As(err, &tamperErr)) {
+		a.Equal("chain not anchored", tamperErr.Reason)
+	}
+}
@@ -0,0 +1,241 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/db"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// DefaultTable is the table of PostgresSink if none is given
+const DefaultTable = "audit_events"
+
+// DefaultChainsTable is the table of PostgresAnchor if none is given
+const DefaultChainsTable = "audit_chains"
+
+// sanitizeTable quotes `table`, which may be qualified with a schema
+func sanitizeTable(table string) string {
+	return pgx.Identifier(strings.Split(table, ".")).Sanitize()
+}
+
+// PostgresSink is a Sink that inserts the events in a table created with its Schema. The whole
+// event is kept in the payload column as JSON, not JSONB, so the hashed bytes are kept as is.
+type PostgresSink struct {
+	conn  db.DBConnector
+	table string
+}
+
+// NewPostgresSink creates a PostgresSink writing to `table`, which may be qualified with a schema,
+// like audit.events. An empty `table` uses DefaultTable.
+func NewPostgresSink(conn db.DBConnector, table string) *PostgresSink {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	return &PostgresSink{conn: conn, table: sanitizeTable(table)}
+}
+
+// Schema returns the statement that creates the table of the sink
+func (s *PostgresSink) Schema() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id uuid PRIMARY KEY,
+	chain_id uuid NOT NULL,
+	sequence bigint NOT NULL,
+	time timestamptz NOT NULL,
+	actor_id text NOT NULL,
+	action text NOT NULL,
+	resource_type text NOT NULL,
+	resource_id text NOT NULL,
+	outcome text NOT NULL,
+	hash text NOT NULL,
+	payload json NOT NULL,
+	UNIQUE (chain_id, sequence)
+)`, s.table)
+}
+
+func (s *PostgresSink) Write(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s
+	(id, chain_id, sequence, time, actor_id, action, resource_type, resource_id, outcome, hash, payload)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, s.table),
+		e.ID, e.ChainID, e.Sequence, e.Time, e.Actor.ID, e.Action, e.Resource.Type, e.Resource.ID,
+		e.Outcome, e.Hash, string(payload),
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting audit event: %w", err)
+	}
+
+	return nil
+}
+
+// Events returns the events of a chain in order, to be checked with Verify
+func (s *PostgresSink) Events(ctx context.Context, chainID string) ([]Event, error) {
+	rows, err := s.conn.Query(ctx,
+		fmt.Sprintf("SELECT payload FROM %s WHERE chain_id = $1 ORDER BY sequence", s.table), chainID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+
+		var e Event
+		if err := unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// PostgresAnchor is an Anchor that keeps the heads in a table created with its Schema. The heads
+// only move forward, and the table should be writable by a role that can't modify the events, or
+// be in another database than the PostgresSink.
+type PostgresAnchor struct {
+	conn  db.DBConnector
+	table string
+}
+
+// NewPostgresAnchor creates a PostgresAnchor keeping the heads in `table`, which may be qualified
+// with a schema. An empty `table` uses DefaultChainsTable.
+func NewPostgresAnchor(conn db.DBConnector, table string) *PostgresAnchor {
+	if table == "" {
+		table = DefaultChainsTable
+	}
+
+	return &PostgresAnchor{conn: conn, table: sanitizeTable(table)}
+}
+
+// Schema returns the statement that creates the table of the anchor
+func (a *PostgresAnchor) Schema() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	chain_id uuid PRIMARY KEY,
+	started_at timestamptz NOT NULL,
+	sequence bigint NOT NULL,
+	hash text NOT NULL,
+	updated_at timestamptz NOT NULL DEFAULT now()
+)`, a.table)
+}
+
+func (a *PostgresAnchor) Save(ctx context.Context, head ChainHead) error {
+	_, err := a.conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %[1]s AS c (chain_id, started_at, sequence, hash)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (chain_id) DO UPDATE SET sequence = excluded.sequence, hash = excluded.hash, updated_at = now()
+	WHERE c.sequence < excluded.sequence`, a.table),
+		head.ChainID, head.StartedAt, head.Sequence, head.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving audit chain head: %w", err)
+	}
+
+	return nil
+}
+
+func (a *PostgresAnchor) Heads(ctx context.Context) ([]ChainHead, error) {
+	rows, err := a.conn.Query(ctx,
+		fmt.Sprintf("SELECT chain_id, started_at, sequence, hash FROM %s ORDER BY started_at", a.table))
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit chain heads: %w", err)
+	}
+	defer rows.Close()
+
+	var heads []ChainHead
+	for rows.Next() {
+		var h ChainHead
+		if err := rows.Scan(&h.ChainID, &h.StartedAt, &h.Sequence, &h.Hash); err != nil {
+			return nil, err
+		}
+		heads = append(heads, h)
+	}
+
+	return heads, rows.Err()
+}
+
+// S3Sink is a Sink that uploads each event as a JSON object, with the key
+// [prefix]/[chain id]/[sequence].json. The bucket should have versioning or Object Lock enabled so
+// that the objects cannot be overwritten.
+type S3Sink struct {
+	store  awsclient.ObjectStore
+	bucket string
+	prefix string
+	opts   awsclient.S3UploadOptions
+}
+
+// NewS3Sink creates an S3Sink uploading to `bucket` with `store`, such as the S3 of
+// aws.Config.Clients. `opts` can set the KMSKeyID or StorageClass of the objects.
+func NewS3Sink(store awsclient.ObjectStore, bucket, prefix string, opts awsclient.S3UploadOptions) *S3Sink {
+	return &S3Sink{store: store, bucket: bucket, prefix: prefix, opts: opts}
+}
+
+// Key returns the key of the object of `e`
+func (s *S3Sink) Key(e Event) string {
+	return path.Join(s.prefix, e.ChainID, fmt.Sprintf("%020d.json", e.Sequence))
+}
+
+func (s *S3Sink) Write(ctx context.Context, e Event) error {
+	bb, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	opts := s.opts
+	opts.ContentType = "application/json"
+	opts.Checksum = true
+	opts.Metadata = map[string]string{"hash": e.Hash}
+	for k, v := range s.opts.Metadata {
+		opts.Metadata[k] = v
+	}
+
+	obj := awsclient.S3Object{BucketName: s.bucket, Key: s.Key(e)}
+	if _, err := s.store.Upload(ctx, obj, bytes.NewReader(bb), opts); err != nil {
+		return fmt.Errorf("error uploading audit event: %w", err)
+	}
+
+	return nil
+}
+
+// LoggerSink is a Sink that logs the events with the message "audit event". Loggers created with
+// log.NewLogger redact the events, so they cannot be verified from the logs.
+type LoggerSink struct {
+	logger *zap.SugaredLogger
+}
+
+// NewLoggerSink creates a LoggerSink logging with `logger`
+func NewLoggerSink(logger *zap.SugaredLogger) *LoggerSink {
+	return &LoggerSink{logger: logger}
+}
+
+func (s *LoggerSink) Write(_ context.Context, e Event) error {
+	s.logger.Infow("audit event", "audit", e)
+	return nil
+}
+
+// Durable returns false, as the logged events can't be verified. Record doesn't advance the chain
+// for events that were only logged.
+func (s *LoggerSink) Durable() bool {
+	return false
+}
+
+// unmarshal decodes JSON keeping the precision of numbers
+func unmarshal(bb []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(bb))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,168 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/credifranco/stori-utils-go/audit"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// awsclient.ObjectStore recording the uploaded objects
+type mockObjectStore struct {
+	awsclient.ObjectStore
+	objects map[string][]byte
+	opts    awsclient.S3UploadOptions
+	err     error
+}
+
+func (m *mockObjectStore) Upload(_ context.Context, s awsclient.S3Object, r io.Reader, opts awsclient.S3UploadOptions) (awsclient.S3UploadResult, error) {
+	if m.err != nil {
+		return awsclient.S3UploadResult{}, m.err
+	}
+
+	bb, err := ioutil.ReadAll(r)
+	if err != nil {
+		return awsclient.S3UploadResult{}, err
+	}
+	m.objects[s.BucketName+"/"+s.Key] = bb
+	m.opts = opts
+
+	return awsclient.S3UploadResult{}, nil
+}
+
+// recordEvent records an event with a new Recorder writing to `sink`, anchored in `anchor`
+func recordEvent(t *testing.T, anchor audit.Anchor, sink audit.Sink) (audit.Event, error) {
+	r, err := audit.NewRecorder(context.Background(), anchor, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r.Record(context.Background(), audit.Event{
+		Actor:    audit.ServiceActor("stori-transfers"),
+		Action:   "transfer.create",
+		Resource: audit.Resource{Type: "account", ID: "1"},
+	})
+}
+
+func TestPostgresSink(t *testing.T) {
+	a := assert.New(t)
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	sink := audit.NewPostgresSink(mock, "audit.events")
+	a.Contains(sink.Schema(), `CREATE TABLE IF NOT EXISTS "audit"."events"`)
+
+	var payload string
+	mock.ExpectExec(`INSERT INTO "audit"."events"`).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), uint64(1), pgxmock.AnyArg(), "stori-transfers",
+			"transfer.create", "account", "1", audit.OutcomeSuccess, pgxmock.AnyArg(),
+			argFunc(func(v interface{}) bool { payload, _ = v.(string); return true })).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	anchor := newMemoryAnchor()
+	e, err := recordEvent(t, anchor, sink)
+	a.NoError(err)
+
+	mock.ExpectQuery(`SELECT payload FROM "audit"."events" WHERE chain_id = \$1 ORDER BY sequence`).
+		WithArgs(e.ChainID).
+		WillReturnRows(pgxmock.NewRows([]string{"payload"}).AddRow([]byte(payload)))
+
+	events, err := sink.Events(context.Background(), e.ChainID)
+	a.NoError(err)
+	a.Equal([]audit.Event{e}, events)
+	heads, _ := anchor.Heads(context.Background())
+	a.NoError(audit.Verify(events, heads))
+
+	mock.ExpectExec("INSERT").WillReturnError(errors.New("connection refused"))
+	_, err = recordEvent(t, anchor, sink)
+	a.Error(err)
+	a.Contains(err.Error(), "error inserting audit event")
+
+	a.NoError(mock.ExpectationsWereMet())
+}
+
+// argFunc is a pgxmock.Argument matching the values accepted by the function
+type argFunc func(v interface{}) bool
+
+func (f argFunc) Match(v interface{}) bool {
+	return f(v)
+}
+
+func TestPostgresAnchor(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	anchor := audit.NewPostgresAnchor(mock, "")
+	a.Contains(anchor.Schema(), `CREATE TABLE IF NOT EXISTS "audit_chains"`)
+
+	started := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	head := audit.ChainHead{ChainID: "6f1c2b8e-7d3a-4e5f-9a0b-1c2d3e4f5a6b", StartedAt: started, Sequence: 2, Hash: "abc"}
+	mock.ExpectExec(`INSERT INTO "audit_chains" AS c .* WHERE c.sequence < excluded.sequence`).
+		WithArgs(head.ChainID, started, uint64(2), "abc").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	a.NoError(anchor.Save(ctx, head))
+
+	mock.ExpectQuery(`SELECT chain_id, started_at, sequence, hash FROM "audit_chains" ORDER BY started_at`).
+		WillReturnRows(pgxmock.NewRows([]string{"chain_id", "started_at", "sequence", "hash"}).
+			AddRow(head.ChainID, started, uint64(2), "abc"))
+	heads, err := anchor.Heads(ctx)
+	a.NoError(err)
+	a.Equal([]audit.ChainHead{head}, heads)
+
+	mock.ExpectExec("INSERT").WillReturnError(errors.New("connection refused"))
+	_, err = audit.NewRecorder(ctx, anchor, &memorySink{})
+	a.Error(err, "the recorder should not be created if its chain can't be anchored")
+
+	a.NoError(mock.ExpectationsWereMet())
+}
+
+func TestS3Sink(t *testing.T) {
+	a := assert.New(t)
+	store := &mockObjectStore{objects: map[string][]byte{}}
+
+	sink := audit.NewS3Sink(store, "stori-audit", "transfers", awsclient.S3UploadOptions{KMSKeyID: "alias/audit"})
+	e, err := recordEvent(t, newMemoryAnchor(), sink)
+	a.NoError(err)
+
+	key := "transfers/" + e.ChainID + "/00000000000000000001.json"
+	a.Equal(key, sink.Key(e))
+	a.Contains(string(store.objects["stori-audit/"+key]), `"hash":"`+e.Hash+`"`)
+	a.Equal("application/json", store.opts.ContentType)
+	a.Equal("alias/audit", store.opts.KMSKeyID)
+	a.True(store.opts.Checksum)
+	a.Equal(map[string]string{"hash": e.Hash}, store.opts.Metadata)
+
+	store.err = errors.New("access denied")
+	_, err = recordEvent(t, newMemoryAnchor(), sink)
+	a.Error(err)
+}
+
+func TestLoggerSink(t *testing.T) {
+	a := assert.New(t)
+	core, logs := observer.New(zap.InfoLevel)
+
+	e, err := recordEvent(t, newMemoryAnchor(), audit.NewLoggerSink(zap.New(core).Sugar()))
+	a.True(errors.Is(err, audit.ErrNotRecorded), "logged events should not advance the chain")
+
+	entries := logs.FilterMessage("audit event").All()
+	if a.Len(entries, 1) {
+		a.Equal(e, entries[0].ContextMap()["audit"])
+	}
+}
@@ -5,15 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
-	"net/url"
 	"os"
-	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -22,6 +19,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
 	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
 	"github.com/joho/godotenv"
 )
 
@@ -31,119 +30,91 @@ type S3Interface interface {
 	NewConn() error
 }
 
-// S3Object represents the components of an S3 URL
-type S3Object struct {
-	BucketName string
-	Key        string
-	Url        string
-	LocalPath  string
-}
+// S3Object represents the components of an S3 URL. It is the awsclient.S3Object with the methods
+// implemented with SDK v1.
+type S3Object awsclient.S3Object
 
 // Secret contains information about a secret stored in AWS Secret Manager.
 type secret struct {
-	id string
+	id    string
+	stage VersionStage
 }
 
-// LambdaInvocation contains information needed to create a Lambda invocation.
-type LambdaInvocation struct {
-	FunctionName   string
-	Event          interface{}
-	InvocationType string
-}
+// LambdaInvocation contains information needed to create a Lambda invocation. It is the
+// awsclient.LambdaInvocation with the methods implemented with SDK v1.
+type LambdaInvocation awsclient.LambdaInvocation
 
-var awsConfig aws.Config
 var ErrRegionNotSet = errors.New("aws region is not set")
 
 func init() {
 	// godotenv.Load sets values found in .env file, but does not override existing env values
 	_ = godotenv.Load()
 
-	if region, ok := os.LookupEnv("AWS_REGION"); !ok {
+	if _, ok := os.LookupEnv("AWS_REGION"); !ok {
 		log.Println(ErrRegionNotSet)
-	} else {
-		awsConfig = aws.Config{Region: aws.String(region)}
-	}
-}
-
-// ParseS3URL parses an S3 url and returns the bucket name, path to the object and the url in an S3Object struct.
-// The following types of S3 urls can be parsed:
-// - https://s3.amazonaws.com/[bucket_name]/[path_to_object]
-// - https://[bucket_name].s3.amazonaws.com/[path_to_object]
-// - s3://[bucket_name]/[path_to_object]
-// If the url doesn't match any of these pattern then a nil along with an error is returned.
-func ParseS3URL(s3URL string) (S3Object, error) {
-
-	u, err := url.Parse(s3URL)
-	if err != nil {
-		return S3Object{}, errors.New("couldn't parse the url")
-	}
-
-	if u.Scheme != "s3" && u.Scheme != "https" {
-		return S3Object{}, errors.New("invalid protocol")
-	}
-
-	parsedObject := S3Object{
-		BucketName: u.Host,
-		Key:        u.Path[1:],
-		Url:        s3URL,
-	}
-
-	if strings.Contains(s3URL, "https://s3") {
-		stringMap := strings.Split(u.Path, "/")
-		parsedObject.BucketName = stringMap[1]
-		parsedObject.Key = strings.Join(stringMap[2:], "/")
-	} else {
-		parsedObject.BucketName = strings.Split(u.Host, ".s3")[0]
 	}
-
-	return parsedObject, nil
 }
 
 // GetRDSAuthToken uses the given RDS credentials to create an IAM authentication token
 func GetRDSAuthToken(ctx context.Context, host, user string, port int) (string, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+	cfg, err := LoadConfig().V2(ctx)
 	if err != nil {
 		return "", err
 	}
 
+	if cfg.Region == "" {
+		return "", ErrRegionNotSet
+	}
+
 	return auth.BuildAuthToken(
 		ctx,
 		fmt.Sprintf("%s:%d", host, port),
-		*awsConfig.Region,
+		cfg.Region,
 		user,
 		cfg.Credentials,
 	)
 }
 
-// GetSecret returns the secret from AWS Secrets Manager as a JSON-encoded string.
-// If the secret does not exist, an error is returned.
+// GetSecret returns the AWSCURRENT version of the secret from AWS Secrets Manager as a
+// JSON-encoded string. If the secret does not exist, an error is returned. Values are cached for
+// DefaultSecretTTL, so warm Lambdas don't call Secrets Manager every time.
 func GetSecret(id string) (string, error) {
-	s := secret{id: id}
-
-	sess := session.Must(session.NewSession(&awsConfig))
-	svc := secretsmanager.New(sess)
+	c, err := defaultSecretCache()
+	if err != nil {
+		return "", err
+	}
 
-	return s.getSecretString(svc)
+	return c.Get(context.Background(), id)
 }
 
 // getSecretString fetches the secret from AWS Secrets Manager using a
 // secretsmanageriface.SecretsManagerAPI interface
-func (s secret) getSecretString(sma secretsmanageriface.SecretsManagerAPI) (string, error) {
+func (s secret) getSecretString(ctx context.Context, sma secretsmanageriface.SecretsManagerAPI) (string, error) {
+	stage := s.stage
+	if stage == "" {
+		stage = StageCurrent
+	}
+
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId:     aws.String(s.id),
-		VersionStage: aws.String("AWSCURRENT"),
+		VersionStage: aws.String(string(stage)),
 	}
 
-	result, err := sma.GetSecretValue(input)
+	var result *secretsmanager.GetSecretValueOutput
+	err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		var err error
+		result, err = sma.GetSecretValueWithContext(ctx, input, noSDKRetries)
+		return wrapError("GetSecretValue", err)
+	})
 	if err != nil {
-		return "", errors.New("secret not found")
+		return "", fmt.Errorf("error getting secret %s: %w", s.id, err)
 	}
 
-	return *result.SecretString, nil
+	return aws.StringValue(result.SecretString), nil
 }
 
 // InvokeLambda invokes a lambda with an event defined in the LambdaInvocation struct. This event
-// can be any arbitray struct.
+// can be any arbitray struct. Use Invoke to decode the response and function errors.
 func (li LambdaInvocation) InvokeLambda(la lambdaiface.LambdaAPI) (*lambda.InvokeOutput, error) {
 
 	payload, err := json.Marshal(li.Event)
@@ -151,39 +122,41 @@ func (li LambdaInvocation) InvokeLambda(la lambdaiface.LambdaAPI) (*lambda.Invok
 		return &lambda.InvokeOutput{}, errors.New("error parsing json from lambda event")
 	}
 
-	return la.Invoke(
+	clientContext, err := shared.EncodeClientContext(awsclient.LambdaInvocation(li))
+	if err != nil {
+		return &lambda.InvokeOutput{}, err
+	}
+
+	// Invoke doesn't take request options to disable the retries of the SDK, so throttled
+	// invocations are only retried by the SDK
+	out, err := la.Invoke(
 		&lambda.InvokeInput{
 			FunctionName:   &li.FunctionName,
 			Payload:        payload,
-			InvocationType: &li.InvocationType,
+			InvocationType: aws.String(li.InvocationType),
+			Qualifier:      optionalString(li.Qualifier),
+			ClientContext:  optionalString(clientContext),
+			LogType:        optionalString(shared.LogType(awsclient.LambdaInvocation(li))),
 		},
 	)
+
+	return out, wrapError("Invoke", err)
 }
 
-// NewLambdaClient is a helper function to create a new lambda client with default config
+// NewLambdaClient is a helper function to create a new lambda client with the config from
+// LoadConfig
 func NewLambdaClient() (*lambda.Lambda, error) {
-	region, ok := os.LookupEnv("AWS_REGION")
-	if !ok {
+	c := LoadConfig()
+	if c.Region == "" {
 		return nil, ErrRegionNotSet
 	}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: &region,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return lambda.New(sess), nil
+	return c.Lambda()
 }
 
-// NewSNSClient is a helper function to create a new SNS client with default config
+// NewSNSClient is a helper function to create a new SNS client with the config from LoadConfig
 func NewSNSClient() (*sns.SNS, error) {
-	sess, err := session.NewSession()
-	if err != nil {
-		return nil, err
-	}
-	return sns.New(sess), nil
+	return LoadConfig().SNS()
 }
 
 // Upload will upload a single file to S3,
@@ -195,17 +168,22 @@ func (s S3Object) Upload(u s3manageriface.UploaderAPI) (*s3manager.UploadOutput,
 	file, err := os.Open(s.LocalPath)
 
 	if err != nil {
-		return &s3manager.UploadOutput{}, errors.New("error opening file")
+		return &s3manager.UploadOutput{}, fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
-	uploadOutput, err := u.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(s.BucketName),
-		Key:    aws.String(s.Key),
-		Body:   file,
-	})
 
+	var uploadOutput *s3manager.UploadOutput
+	err = awsclient.DefaultRetryPolicy.Do(context.Background(), func() error {
+		// start over from the beginning of the file on retries
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		uploadOutput, err = u.Upload(s.uploadInput(file, S3UploadOptions{}), noUploaderRetries)
+		return wrapError("Upload", err)
+	})
 	if err != nil {
-		return &s3manager.UploadOutput{}, errors.New("error in uploading file")
+		return &s3manager.UploadOutput{}, fmt.Errorf("error in uploading file: %w", err)
 	}
 	return uploadOutput, nil
 }
@@ -219,17 +197,24 @@ func (s S3Object) Download(d s3manageriface.DownloaderAPI) (int64, error) {
 	file, err := os.Create(s.LocalPath)
 
 	if err != nil {
-		return 0, errors.New("error opening file")
-
+		return 0, fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
-	downloadOutput, err := d.Download(file,
-		&s3.GetObjectInput{
-			Bucket: aws.String(s.BucketName),
-			Key:    aws.String(s.Key),
-		})
+
+	var downloadOutput int64
+	err = awsclient.DefaultRetryPolicy.Do(context.Background(), func() error {
+		downloadOutput, err = d.Download(file,
+			&s3.GetObjectInput{
+				Bucket:    aws.String(s.BucketName),
+				Key:       aws.String(s.Key),
+				VersionId: optionalString(s.VersionID),
+			},
+			noDownloaderRetries,
+		)
+		return wrapError("Download", err)
+	})
 	if err != nil {
-		return 0, errors.New("error in download file")
+		return 0, fmt.Errorf("error in download file: %w", err)
 	}
 	return downloadOutput, nil
 }
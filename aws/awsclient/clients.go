@@ -0,0 +1,41 @@
+// Package awsclient has the interfaces implemented with both AWS SDK versions, along with the
+// types and helpers built on them. It doesn't import either SDK: the SDK v1 implementations are in
+// the aws package and the SDK v2 ones in aws/sdkv2, so services that only use SDK v2 don't link v1.
+package awsclient
+
+import (
+	"context"
+	"io"
+)
+
+// SecretGetter gets secret values from AWS Secrets Manager
+type SecretGetter interface {
+	GetSecretString(ctx context.Context, id string, stage VersionStage) (string, error)
+}
+
+// LambdaInvoker invokes Lambda functions
+type LambdaInvoker interface {
+	Invoke(ctx context.Context, li LambdaInvocation) (LambdaResponse, error)
+}
+
+// ObjectStore uploads and downloads S3 objects
+type ObjectStore interface {
+	Upload(ctx context.Context, s S3Object, r io.Reader, opts S3UploadOptions) (S3UploadResult, error)
+	Download(ctx context.Context, s S3Object, w io.WriterAt, opts S3DownloadOptions) (int64, error)
+}
+
+// Publisher publishes messages to SNS topics. Throttled and transient failures are retried, so a
+// message whose response was lost can be published twice.
+type Publisher interface {
+	Publish(ctx context.Context, m SNSMessage) (messageID string, err error)
+	PublishBatch(ctx context.Context, topicARN string, msgs []SNSMessage) ([]string, error)
+}
+
+// Clients groups the implementations of the interfaces of this package for one SDK version, as
+// returned by aws.Config.Clients and sdkv2.NewClients
+type Clients struct {
+	Secrets SecretGetter
+	Lambda  LambdaInvoker
+	S3      ObjectStore
+	SNS     Publisher
+}
@@ -0,0 +1,133 @@
+package awsclient
+
+import (
+	"os"
+	"strconv"
+)
+
+// Service is an AWS service whose endpoint can be overridden in Config
+type Service string
+
+// Services used by the aws helpers. The values are the SDK v1 endpoint ids.
+const (
+	ServiceS3             Service = "s3"
+	ServiceSNS            Service = "sns"
+	ServiceSQS            Service = "sqs"
+	ServiceLambda         Service = "lambda"
+	ServiceSecretsManager Service = "secretsmanager"
+	ServiceSTS            Service = "sts"
+)
+
+// serviceEnv is the suffix of the AWS_ENDPOINT_URL_* variable of each service
+var serviceEnv = map[Service]string{
+	ServiceS3:             "S3",
+	ServiceSNS:            "SNS",
+	ServiceSQS:            "SQS",
+	ServiceLambda:         "LAMBDA",
+	ServiceSecretsManager: "SECRETS_MANAGER",
+	ServiceSTS:            "STS",
+}
+
+// Config holds the settings used to create the AWS clients of both SDK versions, with aws.Config
+// for SDK v1 and sdkv2.NewConfig for SDK v2. Use LoadConfig to read it from the environment.
+type Config struct {
+	Region string
+	// Profile of the shared config files to use, instead of the default credential chain
+	Profile string
+	// RoleARN is a role assumed with the base credentials
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+	// Endpoint overrides the endpoint of every service, e.g. http://localhost:4566 for LocalStack
+	Endpoint string
+	// Endpoints overrides the endpoint of a single service, taking precedence over Endpoint
+	Endpoints map[Service]string
+	// S3ForcePathStyle uses path-style S3 urls, which most emulators need. It is enabled when the
+	// S3 endpoint is overridden, unless AWS_S3_FORCE_PATH_STYLE is false.
+	S3ForcePathStyle bool
+}
+
+// ConfigOption overrides a setting of the Config returned by LoadConfig
+type ConfigOption func(*Config)
+
+// WithRegion sets the region of the clients
+func WithRegion(region string) ConfigOption {
+	return func(c *Config) { c.Region = region }
+}
+
+// WithProfile uses a profile of the shared config files
+func WithProfile(profile string) ConfigOption {
+	return func(c *Config) { c.Profile = profile }
+}
+
+// WithRole assumes the role `arn`, with an optional `externalID`
+func WithRole(arn, externalID string) ConfigOption {
+	return func(c *Config) {
+		c.RoleARN = arn
+		c.ExternalID = externalID
+	}
+}
+
+// WithEndpoint sends the requests of every service to `url`
+func WithEndpoint(url string) ConfigOption {
+	return func(c *Config) { c.Endpoint = url }
+}
+
+// WithServiceEndpoint sends the requests of `svc` to `url`
+func WithServiceEndpoint(svc Service, url string) ConfigOption {
+	return func(c *Config) {
+		if c.Endpoints == nil {
+			c.Endpoints = map[Service]string{}
+		}
+		c.Endpoints[svc] = url
+	}
+}
+
+// LoadConfig reads the Config from the environment and then applies `opts`. The following
+// variables are used:
+// - AWS_REGION, or AWS_DEFAULT_REGION
+// - AWS_PROFILE
+// - AWS_ASSUME_ROLE_ARN, AWS_ASSUME_ROLE_SESSION_NAME and AWS_ASSUME_ROLE_EXTERNAL_ID
+// - AWS_ENDPOINT_URL for every service
+// - AWS_ENDPOINT_URL_S3, _SNS, _SQS, _LAMBDA, _SECRETS_MANAGER and _STS for a single service
+// - AWS_S3_FORCE_PATH_STYLE
+func LoadConfig(opts ...ConfigOption) Config {
+	c := Config{
+		Region:          os.Getenv("AWS_REGION"),
+		Profile:         os.Getenv("AWS_PROFILE"),
+		RoleARN:         os.Getenv("AWS_ASSUME_ROLE_ARN"),
+		RoleSessionName: os.Getenv("AWS_ASSUME_ROLE_SESSION_NAME"),
+		ExternalID:      os.Getenv("AWS_ASSUME_ROLE_EXTERNAL_ID"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+	}
+	if c.Region == "" {
+		c.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	for svc, env := range serviceEnv {
+		if url := os.Getenv("AWS_ENDPOINT_URL_" + env); url != "" {
+			WithServiceEndpoint(svc, url)(&c)
+		}
+	}
+
+	for _, o := range opts {
+		o(&c)
+	}
+
+	// after the options, so the endpoints they set enable it too
+	c.S3ForcePathStyle = c.EndpointFor(ServiceS3) != ""
+	if v, err := strconv.ParseBool(os.Getenv("AWS_S3_FORCE_PATH_STYLE")); err == nil {
+		c.S3ForcePathStyle = v
+	}
+
+	return c
+}
+
+// EndpointFor returns the endpoint override of `svc`, or an empty string to use the AWS endpoint
+func (c Config) EndpointFor(svc Service) string {
+	if url, ok := c.Endpoints[svc]; ok {
+		return url
+	}
+
+	return c.Endpoint
+}
@@ -0,0 +1,124 @@
+package awsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Kinds of AWS failures. Errors returned by the implementations of the interfaces of this package
+// match one of these with errors.Is, and still wrap the original SDK error for errors.As.
+var (
+	ErrNotFound       = errors.New("aws resource not found")
+	ErrAccessDenied   = errors.New("aws access denied")
+	ErrThrottled      = errors.New("aws request throttled")
+	ErrInvalidRequest = errors.New("invalid aws request")
+	ErrTransient      = errors.New("transient aws failure")
+)
+
+// Error is an error from the AWS SDK, classified by Kind
+type Error struct {
+	// Op is the AWS operation that failed, such as GetSecretValue
+	Op string
+	// Kind is one of ErrNotFound, ErrAccessDenied, ErrThrottled, ErrInvalidRequest or
+	// ErrTransient, or nil if the failure could not be classified
+	Kind error
+	// Err is the original error, an awserr.Error of SDK v1 or a smithy.APIError of SDK v2
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("aws %s: %v", e.Op, e.Err)
+	}
+
+	return fmt.Sprintf("aws %s: %v: %v", e.Op, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether `target` is the Kind of the error
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// RetryPolicy retries AWS calls that failed because of throttling or transient failures, with
+// exponential backoff and full jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// RetryTransient retries ErrTransient failures as well as ErrThrottled. Only enable it for
+	// idempotent operations.
+	RetryTransient bool
+}
+
+// DefaultRetryPolicy is used by the implementations of both SDK versions, which disable the retries
+// of the SDK for the calls it wraps so one call isn't retried by both. Invoking a Lambda, which is
+// not idempotent, only retries throttling errors. Publishing to SNS retries transient failures too,
+// as the SDK did, at the risk of publishing a message twice.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	BaseDelay:      100 * time.Millisecond,
+	MaxDelay:       2 * time.Second,
+	RetryTransient: true,
+}
+
+// ThrottleOnly returns a copy of `p` that doesn't retry transient failures
+func (p RetryPolicy) ThrottleOnly() RetryPolicy {
+	p.RetryTransient = false
+	return p
+}
+
+// Do calls `f` until it succeeds, returns an error that should not be retried, MaxAttempts is
+// reached or `ctx` is done. The last error of `f` is returned. `f` is called once if `ctx` was
+// returned by SingleAttempt.
+func (p RetryPolicy) Do(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = f(); err == nil || !p.retryable(err) || attempt+1 >= p.MaxAttempts || IsSingleAttempt(ctx) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(p.backoff(attempt)):
+		}
+	}
+}
+
+type singleAttemptKey struct{}
+
+// SingleAttempt returns a context for which RetryPolicy.Do makes a single attempt. Callers that
+// retry on their own, like InvokeAll, use it so the retries of each layer don't multiply.
+func SingleAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, singleAttemptKey{}, true)
+}
+
+// IsSingleAttempt reports whether `ctx` was returned by SingleAttempt
+func IsSingleAttempt(ctx context.Context) bool {
+	v, _ := ctx.Value(singleAttemptKey{}).(bool)
+	return v
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	return errors.Is(err, ErrThrottled) || (p.RetryTransient && errors.Is(err, ErrTransient))
+}
+
+// backoff returns a random delay between 0 and BaseDelay * 2^attempt, capped at MaxDelay
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d)))
+}
@@ -0,0 +1,97 @@
+package awsclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultFanOutConcurrency is the number of concurrent invocations of InvokeAll when
+// FanOutOptions.Concurrency is not set
+const DefaultFanOutConcurrency = 10
+
+// fanOutRetryPolicy retries throttled invocations of InvokeAll. Fan-outs are likely to hit the
+// concurrency limit of the function, so it waits longer than DefaultRetryPolicy.
+var fanOutRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// FanOutOptions configures InvokeAll
+type FanOutOptions struct {
+	// Concurrency is the max number of invocations running at once. Defaults to
+	// DefaultFanOutConcurrency.
+	Concurrency int
+	// Retry is used for throttled invocations. Only ErrThrottled errors are retried. Defaults to 5
+	// attempts with up to 5s of backoff.
+	Retry *RetryPolicy
+}
+
+// FanOutResult is the outcome of one invocation of InvokeAll
+type FanOutResult struct {
+	Response LambdaResponse
+	// Err is a *FunctionError if the function failed, or the context error if the invocation was
+	// not started before the context was done
+	Err error
+}
+
+// InvokeAll invokes every one of `invocations` with at most opts.Concurrency running at once, and
+// returns their results in the same order. Throttled invocations, which fail with a 429
+// TooManyRequestsException, are retried with backoff. Invocations are not started once `ctx` is
+// done.
+//
+// The invoker is called with a SingleAttempt context, so the invokers of both SDK versions don't
+// retry on their own, and an invocation makes at most Retry.MaxAttempts calls. Other invokers
+// should check IsSingleAttempt for the same.
+func InvokeAll(ctx context.Context, invoker LambdaInvoker, invocations []LambdaInvocation, opts FanOutOptions) []FanOutResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultFanOutConcurrency
+	}
+
+	policy := fanOutRetryPolicy
+	if opts.Retry != nil {
+		policy = opts.Retry.ThrottleOnly()
+	}
+
+	results := make([]FanOutResult, len(invocations))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := range invocations {
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+
+		// the context could be done while waiting for a slot
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			<-sem
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			r := &results[i]
+			single := SingleAttempt(ctx)
+			r.Err = policy.Do(ctx, func() error {
+				var err error
+				r.Response, err = InvokeInto(single, invoker, invocations[i], nil)
+				return err
+			})
+		}(i)
+	}
+
+	wg.Wait()
+
+	return results
+}
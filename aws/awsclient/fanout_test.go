@@ -0,0 +1,138 @@
+package awsclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// LambdaInvoker echoing the event, that throttles the first calls of some events
+type mockInvoker struct {
+	mu       sync.Mutex
+	running  int
+	max      int
+	calls    map[string]int
+	throttle map[string]int
+	delay    time.Duration
+	// started receives the event of each call, and calls wait for release if it is set
+	started chan string
+	release chan struct{}
+	// retried counts the calls whose context allows the invoker to retry
+	retried int
+}
+
+func (m *mockInvoker) Invoke(ctx context.Context, li awsclient.LambdaInvocation) (awsclient.LambdaResponse, error) {
+	event := fmt.Sprint(li.Event)
+
+	m.mu.Lock()
+	m.running++
+	if m.running > m.max {
+		m.max = m.running
+	}
+	m.calls[event]++
+	throttled := m.calls[event] <= m.throttle[event]
+	if !awsclient.IsSingleAttempt(ctx) {
+		m.retried++
+	}
+	m.mu.Unlock()
+
+	time.Sleep(m.delay)
+	if m.release != nil {
+		m.started <- event
+		<-m.release
+	}
+
+	m.mu.Lock()
+	m.running--
+	m.mu.Unlock()
+
+	switch {
+	case throttled:
+		return awsclient.LambdaResponse{}, &awsclient.Error{Op: "Invoke", Kind: awsclient.ErrThrottled, Err: errors.New("TooManyRequestsException: Rate Exceeded")}
+	case event == "fail":
+		return awsclient.LambdaResponse{StatusCode: 200, FunctionError: "Unhandled", Payload: []byte(`{"errorMessage":"boom"}`)}, nil
+	default:
+		return awsclient.LambdaResponse{StatusCode: 200, Payload: []byte(`"` + event + `"`)}, nil
+	}
+}
+
+func newMockInvoker() *mockInvoker {
+	return &mockInvoker{calls: map[string]int{}, throttle: map[string]int{}, delay: 5 * time.Millisecond}
+}
+
+func TestInvokeAll(t *testing.T) {
+	a := assert.New(t)
+	mock := newMockInvoker()
+	mock.throttle["3"] = 2
+
+	invocations := make([]awsclient.LambdaInvocation, 20)
+	for i := range invocations {
+		invocations[i] = awsclient.LambdaInvocation{FunctionName: "stori-fn", Event: i}
+	}
+	invocations[7].Event = "fail"
+
+	retry := awsclient.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	results := awsclient.InvokeAll(context.Background(), mock, invocations, awsclient.FanOutOptions{Concurrency: 4, Retry: &retry})
+
+	a.Len(results, 20)
+	a.LessOrEqual(mock.max, 4, "should not run more than Concurrency invocations at once")
+	for i, r := range results {
+		if i == 7 {
+			var fe *awsclient.FunctionError
+			a.ErrorAs(r.Err, &fe)
+			continue
+		}
+		a.NoError(r.Err)
+		a.Equal(fmt.Sprintf(`"%d"`, i), string(r.Response.Payload), "results should be in order")
+	}
+	a.Equal(3, mock.calls["3"], "throttled invocations should be retried")
+	a.Equal(1, mock.calls["fail"], "function errors should not be retried")
+	a.Zero(mock.retried, "the invoker should not retry on top of InvokeAll")
+
+	// throttled until the retries run out
+	mock = newMockInvoker()
+	mock.throttle["0"] = 10
+	results = awsclient.InvokeAll(context.Background(), mock, invocations[:1], awsclient.FanOutOptions{Retry: &retry})
+	a.ErrorIs(results[0].Err, awsclient.ErrThrottled)
+}
+
+func TestInvokeAllCancel(t *testing.T) {
+	a := assert.New(t)
+	mock := newMockInvoker()
+	mock.delay = 0
+	mock.started = make(chan string, 10)
+	mock.release = make(chan struct{})
+
+	invocations := make([]awsclient.LambdaInvocation, 10)
+	for i := range invocations {
+		invocations[i] = awsclient.LambdaInvocation{FunctionName: "stori-fn", Event: i}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan []awsclient.FanOutResult)
+	go func() {
+		done <- awsclient.InvokeAll(ctx, mock, invocations, awsclient.FanOutOptions{Concurrency: 2})
+	}()
+
+	// cancel while the first two invocations are running
+	<-mock.started
+	<-mock.started
+	cancel()
+	close(mock.release)
+
+	results := <-done
+	a.NoError(results[0].Err)
+	a.NoError(results[1].Err)
+	for _, r := range results[2:] {
+		a.ErrorIs(r.Err, context.Canceled, "invocations should not start after the context is done")
+	}
+	a.Len(mock.started, 0, "only the first two invocations should start")
+}
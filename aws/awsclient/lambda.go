@@ -0,0 +1,140 @@
+package awsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LambdaInvocation contains information needed to create a Lambda invocation.
+type LambdaInvocation struct {
+	FunctionName string
+	Event        interface{}
+	// InvocationType is one of the Invocation constants. Defaults to InvocationRequestResponse
+	InvocationType string
+	// Qualifier is the version or alias to invoke. The unqualified function runs $LATEST.
+	Qualifier string
+	// ClientContext is passed to the function as JSON, up to 3583 bytes once base64 encoded
+	ClientContext interface{}
+	// LogTail returns the last 4 KB of the function logs in LambdaResponse.Logs. It is only
+	// supported by RequestResponse invocations.
+	LogTail bool
+}
+
+// LambdaResponse is the response of a Lambda invocation
+type LambdaResponse struct {
+	StatusCode int
+	Payload    []byte
+	// FunctionError is set if the function failed, in which case Payload has the error details
+	FunctionError   string
+	ExecutedVersion string
+	// Logs are the last 4 KB of the function logs, if LogTail was set
+	Logs string
+}
+
+// The values of LambdaInvocation.InvocationType
+const (
+	// InvocationRequestResponse waits for the function and returns its response. It is the
+	// default.
+	InvocationRequestResponse = "RequestResponse"
+	// InvocationEvent queues the event and returns without waiting for the function
+	InvocationEvent = "Event"
+	// InvocationDryRun only validates the parameters and permissions
+	InvocationDryRun = "DryRun"
+)
+
+var ErrClientContextTooLarge = errors.New("lambda client context is larger than 3583 bytes")
+
+// FunctionError is returned when the invoked function fails. The fields are decoded from the error
+// payload written by the Lambda runtime.
+type FunctionError struct {
+	FunctionName string
+	// Kind is the X-Amz-Function-Error header, Unhandled or Handled
+	Kind       string
+	Type       string
+	Message    string
+	StackTrace []string
+	// Logs are the last 4 KB of the function logs, if LogTail was set
+	Logs string
+}
+
+func (e *FunctionError) Error() string {
+	return fmt.Sprintf("lambda %s failed: %s: %s", e.FunctionName, e.Type, e.Message)
+}
+
+// InvokeInto invokes the function with `invoker` and decodes its response into `dst`, which can be
+// nil to ignore the response. A *FunctionError is returned if the function failed.
+func InvokeInto(ctx context.Context, invoker LambdaInvoker, li LambdaInvocation, dst interface{}) (LambdaResponse, error) {
+	res, err := invoker.Invoke(ctx, li)
+	if err != nil {
+		return res, err
+	}
+
+	if res.FunctionError != "" {
+		return res, functionError(res, li.FunctionName)
+	}
+
+	// Event and DryRun invocations have no payload
+	if dst == nil || len(res.Payload) == 0 {
+		return res, nil
+	}
+
+	if err := json.Unmarshal(res.Payload, dst); err != nil {
+		return res, fmt.Errorf("error decoding response of lambda %s: %w", li.FunctionName, err)
+	}
+
+	return res, nil
+}
+
+// functionError decodes the error payload of a failed invocation
+func functionError(r LambdaResponse, functionName string) *FunctionError {
+	fe := &FunctionError{FunctionName: functionName, Kind: r.FunctionError, Logs: r.Logs}
+
+	var payload struct {
+		Type       string          `json:"errorType"`
+		Message    string          `json:"errorMessage"`
+		StackTrace json.RawMessage `json:"stackTrace"`
+	}
+	if err := json.Unmarshal(r.Payload, &payload); err != nil {
+		// not the standard error shape, keep the raw payload as the message
+		fe.Message = strings.TrimSpace(string(r.Payload))
+		return fe
+	}
+
+	fe.Type = payload.Type
+	fe.Message = payload.Message
+	fe.StackTrace = decodeStackTrace(payload.StackTrace)
+
+	return fe
+}
+
+// decodeStackTrace decodes the stack trace of an error payload. Most runtimes send a list of
+// strings, while the Go runtime sends a list of frames.
+func decodeStackTrace(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err == nil {
+		return lines
+	}
+	lines = nil
+
+	var frames []struct {
+		Path  string `json:"path"`
+		Line  int    `json:"line"`
+		Label string `json:"label"`
+	}
+	if err := json.Unmarshal(raw, &frames); err != nil {
+		return nil
+	}
+
+	for _, f := range frames {
+		lines = append(lines, fmt.Sprintf("%s (%s:%d)", f.Label, f.Path, f.Line))
+	}
+
+	return lines
+}
@@ -0,0 +1,52 @@
+package awsclient
+
+import "errors"
+
+// S3Object represents the components of an S3 URL
+type S3Object struct {
+	// BucketName is the name of the bucket, or the ARN of an access point
+	BucketName string
+	Key        string
+	// Region of the bucket, if known from the URL
+	Region string
+	// VersionID selects a specific version of the object. It is empty for the latest version.
+	VersionID string
+	Url       string
+	LocalPath string
+}
+
+// S3UploadOptions configures the object created by ObjectStore.Upload
+type S3UploadOptions struct {
+	ContentType string
+	// KMSKeyID enables SSE-KMS encryption with the given key id, ARN or alias. Use "alias/aws/s3"
+	// for the AWS managed key.
+	KMSKeyID string
+	Metadata map[string]string
+	Tags     map[string]string
+	// StorageClass such as STANDARD_IA or GLACIER_IR. Defaults to STANDARD
+	StorageClass string
+	// Checksum sends a SHA-256 checksum of each part, which S3 verifies before storing it
+	Checksum bool
+	// PartSize of multipart uploads in bytes. Defaults to the part size of the SDK uploader
+	PartSize int64
+	// Progress is called with the total number of bytes read from the body so far
+	Progress func(bytes int64)
+}
+
+// S3DownloadOptions configures ObjectStore.Download
+type S3DownloadOptions struct {
+	// ExpectedSHA256 is the hex encoded SHA-256 of the object. When set the object is downloaded
+	// sequentially and ErrChecksumMismatch is returned if the content doesn't match.
+	ExpectedSHA256 string
+	// Progress is called with the total number of bytes written so far
+	Progress func(bytes int64)
+}
+
+// S3UploadResult describes an uploaded object
+type S3UploadResult struct {
+	Location  string
+	VersionID string
+	ETag      string
+}
+
+var ErrChecksumMismatch = errors.New("s3 object checksum mismatch")
@@ -0,0 +1,182 @@
+package awsclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// VersionStage is the staging label of a secret version
+type VersionStage string
+
+const (
+	StageCurrent  = VersionStage("AWSCURRENT")
+	StagePrevious = VersionStage("AWSPREVIOUS")
+	StagePending  = VersionStage("AWSPENDING")
+)
+
+// DefaultSecretTTL is how long a SecretCache keeps a secret value by default
+const DefaultSecretTTL = 5 * time.Minute
+
+// SecretCache caches secret values from AWS Secrets Manager for a TTL. It is safe for concurrent
+// use.
+type SecretCache struct {
+	secrets SecretGetter
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	entries map[secretKey]secretEntry
+}
+
+// secretKey identifies a cached version of a secret
+type secretKey struct {
+	id    string
+	stage VersionStage
+}
+
+type secretEntry struct {
+	value   string
+	expires time.Time
+}
+
+// NewSecretCache creates a SecretCache that gets values from `secrets` and keeps them for `ttl`. A
+// ttl of 0 or less uses DefaultSecretTTL.
+func NewSecretCache(secrets SecretGetter, ttl time.Duration) *SecretCache {
+	if ttl <= 0 {
+		ttl = DefaultSecretTTL
+	}
+
+	return &SecretCache{secrets: secrets, ttl: ttl, entries: map[secretKey]secretEntry{}}
+}
+
+// Get returns the AWSCURRENT version of the secret `id`
+func (c *SecretCache) Get(ctx context.Context, id string) (string, error) {
+	return c.GetVersion(ctx, id, StageCurrent)
+}
+
+// GetVersion returns the version of the secret `id` with the staging label `stage`
+func (c *SecretCache) GetVersion(ctx context.Context, id string, stage VersionStage) (string, error) {
+	key := secretKey{id: id, stage: stage}
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	return c.fetch(ctx, key)
+}
+
+// GetJSON unmarshals the AWSCURRENT version of the secret `id` into `dst`
+func (c *SecretCache) GetJSON(ctx context.Context, id string, dst interface{}) error {
+	v, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(v), dst); err != nil {
+		return fmt.Errorf("error decoding secret %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// Invalidate removes every cached version of the secret `id`
+func (c *SecretCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if k.id == id {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// WithSecret calls `use` with the AWSCURRENT version of the secret `id`, and handles rotation when
+// `use` fails, for example because authenticating with the value was rejected:
+//   - the secret is fetched again, bypassing the cache, and `use` is retried if it changed
+//   - `use` is retried with the AWSPREVIOUS version, for the window where the secret has been
+//     rotated but the resource it protects has not been updated yet
+//
+// The error of the last attempt is returned if every attempt fails.
+func (c *SecretCache) WithSecret(ctx context.Context, id string, use func(value string) error) error {
+	v, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	useErr := use(v)
+	if useErr == nil {
+		return nil
+	}
+
+	fresh, err := c.fetch(ctx, secretKey{id: id, stage: StageCurrent})
+	if err == nil && fresh != v {
+		if useErr = use(fresh); useErr == nil {
+			return nil
+		}
+	}
+
+	prev, err := c.GetVersion(ctx, id, StagePrevious)
+	if err != nil {
+		return useErr
+	}
+
+	return use(prev)
+}
+
+// StartRefresh refreshes every cached secret in the background every `interval`, so requests
+// don't wait on Secrets Manager when an entry expires. A failed refresh keeps the cached value.
+// The returned function stops the refresh.
+func (c *SecretCache) StartRefresh(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	t := time.NewTicker(interval)
+
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				c.refresh()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// refresh fetches every cached secret again
+func (c *SecretCache) refresh() {
+	c.mu.Lock()
+	keys := make([]secretKey, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	c.mu.Unlock()
+
+	for _, k := range keys {
+		_, _ = c.fetch(context.Background(), k)
+	}
+}
+
+// fetch gets the secret from Secrets Manager and caches it
+func (c *SecretCache) fetch(ctx context.Context, key secretKey) (string, error) {
+	v, err := c.secrets.GetSecretString(ctx, key.id, key.stage)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = secretEntry{value: v, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return v, nil
+}
@@ -0,0 +1,75 @@
+package awsclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/credifranco/stori-utils-go/aws/internal/batcherr"
+)
+
+// SNSMessage contains the information needed to publish a message to an SNS topic.
+type SNSMessage struct {
+	TopicARN string
+	// Message is marshalled to JSON and used as the message body
+	Message interface{}
+	// Attributes are sent as message attributes. It can be a map with string keys or a struct, in
+	// which case the `json` tags are used as attribute names. Strings and bools are sent as String
+	// attributes, numbers as Number attributes and slices as String.Array attributes.
+	Attributes interface{}
+	Subject    string
+	// GroupID is the MessageGroupId, required for FIFO topics
+	GroupID string
+	// DeduplicationID is the MessageDeduplicationId for FIFO topics without content-based
+	// deduplication
+	DeduplicationID string
+}
+
+// SNSBatchFailure describes a single message that could not be published by
+// Publisher.PublishBatch
+type SNSBatchFailure struct {
+	// Index is the position of the message in the slice passed to PublishBatch
+	Index       int
+	Code        string
+	Message     string
+	SenderFault bool
+	// Err is the *Error of the failure, which matches ErrThrottled, ErrTransient, etc. with
+	// errors.Is
+	Err error
+}
+
+// SNSBatchError is returned by Publisher.PublishBatch when one or more messages were not published
+type SNSBatchError struct {
+	Failures []SNSBatchFailure
+}
+
+func (e *SNSBatchError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("message %d: %s: %s", f.Index, f.Code, f.Message))
+	}
+
+	return fmt.Sprintf("%d SNS messages failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any failure matches `target`, like errors.Is(err, ErrThrottled) to check if
+// the batch should be retried
+func (e *SNSBatchError) Is(target error) bool {
+	return batcherr.Is(target, e.errs())
+}
+
+// As finds the first failure that matches `target`, like an *Error
+func (e *SNSBatchError) As(target interface{}) bool {
+	return batcherr.As(target, e.errs())
+}
+
+func (e *SNSBatchError) errs() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+
+	return errs
+}
+
+var ErrSNSTopicMismatch = errors.New("all messages in a batch must use the same topic")
@@ -0,0 +1,157 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
+)
+
+// The interfaces below are defined in awsclient, which doesn't import either SDK, and implemented
+// with SDK v1 in this package and with SDK v2 in aws/sdkv2. Code that depends on them can move to
+// the v2 implementations by only changing how they are created, and then stop importing this
+// package to drop SDK v1.
+type (
+	SecretGetter  = awsclient.SecretGetter
+	LambdaInvoker = awsclient.LambdaInvoker
+	ObjectStore   = awsclient.ObjectStore
+	Publisher     = awsclient.Publisher
+	Clients       = awsclient.Clients
+)
+
+// Clients returns the SDK v1 implementations, created with the Config
+func (c Config) Clients() (Clients, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return Clients{}, err
+	}
+
+	return Clients{
+		Secrets: NewSecretGetterV1(secretsmanager.New(sess)),
+		Lambda:  NewLambdaInvokerV1(lambda.New(sess)),
+		S3:      NewObjectStoreV1(s3manager.NewUploader(sess), s3manager.NewDownloader(sess)),
+		SNS:     NewPublisherV1(sns.New(sess)),
+	}, nil
+}
+
+// NewSecretGetterV1 returns a SecretGetter that uses an SDK v1 client
+func NewSecretGetterV1(sma secretsmanageriface.SecretsManagerAPI) SecretGetter {
+	return secretsV1{sma}
+}
+
+type secretsV1 struct {
+	sma secretsmanageriface.SecretsManagerAPI
+}
+
+func (s secretsV1) GetSecretString(ctx context.Context, id string, stage VersionStage) (string, error) {
+	return secret{id: id, stage: stage}.getSecretString(ctx, s.sma)
+}
+
+// NewLambdaInvokerV1 returns a LambdaInvoker that uses an SDK v1 client
+func NewLambdaInvokerV1(la lambdaiface.LambdaAPI) LambdaInvoker {
+	return lambdaV1{la}
+}
+
+type lambdaV1 struct {
+	la lambdaiface.LambdaAPI
+}
+
+func (l lambdaV1) Invoke(ctx context.Context, li awsclient.LambdaInvocation) (LambdaResponse, error) {
+	payload, err := json.Marshal(li.Event)
+	if err != nil {
+		return LambdaResponse{}, errors.New("error parsing json from lambda event")
+	}
+
+	clientContext, err := shared.EncodeClientContext(li)
+	if err != nil {
+		return LambdaResponse{}, err
+	}
+
+	in := &lambda.InvokeInput{
+		FunctionName:   aws.String(li.FunctionName),
+		Payload:        payload,
+		InvocationType: optionalString(li.InvocationType),
+		Qualifier:      optionalString(li.Qualifier),
+		ClientContext:  optionalString(clientContext),
+		LogType:        optionalString(shared.LogType(li)),
+	}
+
+	var out *lambda.InvokeOutput
+	err = awsclient.DefaultRetryPolicy.ThrottleOnly().Do(ctx, func() error {
+		out, err = l.la.InvokeWithContext(ctx, in, noSDKRetries)
+		return wrapError("Invoke", err)
+	})
+	if err != nil {
+		return LambdaResponse{}, fmt.Errorf("error invoking %s: %w", li.FunctionName, err)
+	}
+
+	return LambdaResponse{
+		StatusCode:      int(aws.Int64Value(out.StatusCode)),
+		Payload:         out.Payload,
+		FunctionError:   aws.StringValue(out.FunctionError),
+		ExecutedVersion: aws.StringValue(out.ExecutedVersion),
+		Logs:            shared.DecodeLogs(aws.StringValue(out.LogResult)),
+	}, nil
+}
+
+// NewObjectStoreV1 returns an ObjectStore that uses SDK v1 clients
+func NewObjectStoreV1(u s3manageriface.UploaderAPI, d s3manageriface.DownloaderAPI) ObjectStore {
+	return objectStoreV1{u, d}
+}
+
+type objectStoreV1 struct {
+	u s3manageriface.UploaderAPI
+	d s3manageriface.DownloaderAPI
+}
+
+func (o objectStoreV1) Upload(ctx context.Context, s awsclient.S3Object, r io.Reader, opts S3UploadOptions) (S3UploadResult, error) {
+	out, err := S3Object(s).UploadReader(ctx, o.u, r, opts)
+	if err != nil {
+		return S3UploadResult{}, err
+	}
+
+	return S3UploadResult{
+		Location:  out.Location,
+		VersionID: aws.StringValue(out.VersionID),
+		ETag:      aws.StringValue(out.ETag),
+	}, nil
+}
+
+func (o objectStoreV1) Download(ctx context.Context, s awsclient.S3Object, w io.WriterAt, opts S3DownloadOptions) (int64, error) {
+	return S3Object(s).DownloadWriter(ctx, o.d, w, opts)
+}
+
+// NewPublisherV1 returns a Publisher that uses an SDK v1 client
+func NewPublisherV1(sa snsiface.SNSAPI) Publisher {
+	return publisherV1{sa}
+}
+
+type publisherV1 struct {
+	sa snsiface.SNSAPI
+}
+
+func (p publisherV1) Publish(ctx context.Context, m awsclient.SNSMessage) (string, error) {
+	out, err := SNSMessage(m).Publish(ctx, p.sa)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.MessageId), nil
+}
+
+func (p publisherV1) PublishBatch(ctx context.Context, topicARN string, msgs []awsclient.SNSMessage) ([]string, error) {
+	return publishSNSBatch(ctx, p.sa, topicARN, msgs)
+}
@@ -0,0 +1,181 @@
+package aws
+
+import (
+	"context"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/sdkv2"
+)
+
+// Service is an AWS service whose endpoint can be overridden in Config
+type Service = awsclient.Service
+
+const (
+	ServiceS3             = awsclient.ServiceS3
+	ServiceSNS            = awsclient.ServiceSNS
+	ServiceSQS            = awsclient.ServiceSQS
+	ServiceLambda         = awsclient.ServiceLambda
+	ServiceSecretsManager = awsclient.ServiceSecretsManager
+	ServiceSTS            = awsclient.ServiceSTS
+)
+
+// Config holds the settings used to create every AWS client of this package, for both SDK v1 and
+// v2. It is the awsclient.Config with the methods that create SDK v1 clients. Use LoadConfig to
+// read it from the environment.
+type Config awsclient.Config
+
+// ConfigOption overrides a setting of the Config returned by LoadConfig
+type ConfigOption = awsclient.ConfigOption
+
+// WithRegion sets the region of the clients
+func WithRegion(region string) ConfigOption {
+	return awsclient.WithRegion(region)
+}
+
+// WithProfile uses a profile of the shared config files
+func WithProfile(profile string) ConfigOption {
+	return awsclient.WithProfile(profile)
+}
+
+// WithRole assumes the role `arn`, with an optional `externalID`
+func WithRole(arn, externalID string) ConfigOption {
+	return awsclient.WithRole(arn, externalID)
+}
+
+// WithEndpoint sends the requests of every service to `url`
+func WithEndpoint(url string) ConfigOption {
+	return awsclient.WithEndpoint(url)
+}
+
+// WithServiceEndpoint sends the requests of `svc` to `url`
+func WithServiceEndpoint(svc Service, url string) ConfigOption {
+	return awsclient.WithServiceEndpoint(svc, url)
+}
+
+// LoadConfig reads the Config from the environment and then applies `opts`. See
+// awsclient.LoadConfig for the variables used.
+func LoadConfig(opts ...ConfigOption) Config {
+	return Config(awsclient.LoadConfig(opts...))
+}
+
+// Session returns an SDK v1 session that uses the Config. The region is read from the shared
+// config of the profile if it is not set.
+func (c Config) Session() (*session.Session, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           c.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			Region:           optionalString(c.Region),
+			S3ForcePathStyle: aws.Bool(c.S3ForcePathStyle),
+			EndpointResolver: endpoints.ResolverFunc(c.resolveV1),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.RoleARN != "" {
+		sess.Config.Credentials = stscreds.NewCredentials(sess, c.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if c.RoleSessionName != "" {
+				p.RoleSessionName = c.RoleSessionName
+			}
+			p.ExternalID = optionalString(c.ExternalID)
+		})
+	}
+
+	return sess, nil
+}
+
+func (c Config) resolveV1(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+	if url := awsclient.Config(c).EndpointFor(Service(service)); url != "" {
+		return endpoints.ResolvedEndpoint{URL: url, SigningRegion: region}, nil
+	}
+
+	return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+}
+
+// V2 returns an SDK v2 config that uses the Config. See sdkv2.NewConfig.
+func (c Config) V2(ctx context.Context) (awsv2.Config, error) {
+	return sdkv2.NewConfig(ctx, awsclient.Config(c))
+}
+
+// Lambda returns a Lambda client
+func (c Config) Lambda() (*lambda.Lambda, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return lambda.New(sess), nil
+}
+
+// SNS returns an SNS client
+func (c Config) SNS() (*sns.SNS, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return sns.New(sess), nil
+}
+
+// SQS returns an SQS client
+func (c Config) SQS() (*sqs.SQS, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqs.New(sess), nil
+}
+
+// S3 returns an S3 client
+func (c Config) S3() (*s3.S3, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.New(sess), nil
+}
+
+// S3Uploader returns an uploader for S3Object.Upload and S3Object.UploadReader
+func (c Config) S3Uploader() (*s3manager.Uploader, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return s3manager.NewUploader(sess), nil
+}
+
+// S3Downloader returns a downloader for S3Object.Download and S3Object.DownloadWriter
+func (c Config) S3Downloader() (*s3manager.Downloader, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return s3manager.NewDownloader(sess), nil
+}
+
+// SecretsManager returns a Secrets Manager client
+func (c Config) SecretsManager() (*secretsmanager.SecretsManager, error) {
+	sess, err := c.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return secretsmanager.New(sess), nil
+}
@@ -0,0 +1,177 @@
+package aws_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	a := assert.New(t)
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	t.Setenv("AWS_ASSUME_ROLE_ARN", "arn:aws:iam::123456789012:role/stori")
+	t.Setenv("AWS_ENDPOINT_URL", "http://localhost:4566")
+	t.Setenv("AWS_ENDPOINT_URL_SQS", "http://localhost:9324")
+	t.Setenv("AWS_S3_FORCE_PATH_STYLE", "")
+
+	c := aws.LoadConfig()
+	a.Equal("us-west-2", c.Region)
+	a.Equal("arn:aws:iam::123456789012:role/stori", c.RoleARN)
+	a.Equal("http://localhost:4566", c.Endpoint)
+	a.Equal(map[aws.Service]string{aws.ServiceSQS: "http://localhost:9324"}, c.Endpoints)
+	a.True(c.S3ForcePathStyle, "overriding the S3 endpoint should use path-style urls")
+
+	t.Setenv("AWS_S3_FORCE_PATH_STYLE", "false")
+	c = aws.LoadConfig(
+		aws.WithRegion("us-east-1"),
+		aws.WithRole("", ""),
+		aws.WithServiceEndpoint(aws.ServiceS3, "http://localhost:9000"),
+	)
+	a.Equal("us-east-1", c.Region)
+	a.Empty(c.RoleARN)
+	a.Equal("http://localhost:9000", c.Endpoints[aws.ServiceS3])
+	a.False(c.S3ForcePathStyle)
+}
+
+func TestLoadConfigEndpointOptions(t *testing.T) {
+	a := assert.New(t)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_S3_FORCE_PATH_STYLE", "")
+
+	a.False(aws.LoadConfig().S3ForcePathStyle)
+
+	c := aws.LoadConfig(aws.WithEndpoint("http://localhost:4566"))
+	a.True(c.S3ForcePathStyle, "the endpoint options should use path-style urls")
+
+	s3c, err := c.S3()
+	a.NoError(err)
+	a.True(awssdk.BoolValue(s3c.Config.S3ForcePathStyle))
+
+	cfg, err := c.V2(context.Background())
+	a.NoError(err)
+	e, err := cfg.EndpointResolver.ResolveEndpoint("S3", "us-east-1")
+	a.NoError(err)
+	a.True(e.HostnameImmutable)
+
+	a.True(aws.LoadConfig(aws.WithServiceEndpoint(aws.ServiceS3, "http://localhost:9000")).S3ForcePathStyle)
+	a.False(aws.LoadConfig(aws.WithServiceEndpoint(aws.ServiceSQS, "http://localhost:9324")).S3ForcePathStyle)
+
+	t.Setenv("AWS_S3_FORCE_PATH_STYLE", "false")
+	a.False(aws.LoadConfig(aws.WithEndpoint("http://localhost:4566")).S3ForcePathStyle,
+		"AWS_S3_FORCE_PATH_STYLE should take precedence")
+}
+
+func TestConfigEndpoints(t *testing.T) {
+	a := assert.New(t)
+	c := aws.Config{
+		Region:           "us-west-2",
+		Endpoint:         "http://localhost:4566",
+		Endpoints:        map[aws.Service]string{aws.ServiceSQS: "http://localhost:9324"},
+		S3ForcePathStyle: true,
+	}
+
+	sa, err := c.SNS()
+	a.NoError(err)
+	a.Equal("http://localhost:4566", sa.Endpoint)
+
+	qa, err := c.SQS()
+	a.NoError(err)
+	a.Equal("http://localhost:9324", qa.Endpoint)
+
+	s3c, err := c.S3()
+	a.NoError(err)
+	a.True(awssdk.BoolValue(s3c.Config.S3ForcePathStyle))
+
+	la, err := aws.Config{Region: "us-west-2"}.Lambda()
+	a.NoError(err)
+	a.Equal("https://lambda.us-west-2.amazonaws.com", la.Endpoint)
+
+	cfg, err := c.V2(context.Background())
+	a.NoError(err)
+	a.Equal("us-west-2", cfg.Region)
+
+	e, err := cfg.EndpointResolver.ResolveEndpoint("SQS", "us-west-2")
+	a.NoError(err)
+	a.Equal("http://localhost:9324", e.URL)
+
+	e, err = cfg.EndpointResolver.ResolveEndpoint("S3", "us-west-2")
+	a.NoError(err)
+	a.True(e.HostnameImmutable)
+}
+
+// TestEmulator runs the helpers against a local emulator such as LocalStack. It only runs when
+// AWS_ENDPOINT_URL is set, e.g. AWS_ENDPOINT_URL=http://localhost:4566 AWS_REGION=us-east-1
+func TestEmulator(t *testing.T) {
+	if os.Getenv("AWS_ENDPOINT_URL") == "" {
+		t.Skip("AWS_ENDPOINT_URL is not set")
+	}
+
+	a := assert.New(t)
+	ctx := context.Background()
+	c := aws.LoadConfig()
+	name := fmt.Sprintf("stori-utils-%d", time.Now().UnixNano())
+
+	t.Run("s3", func(t *testing.T) {
+		s3c, _ := c.S3()
+		_, err := s3c.CreateBucket(&s3.CreateBucketInput{Bucket: awssdk.String(name)})
+		a.NoError(err)
+
+		u, _ := c.S3Uploader()
+		d, _ := c.S3Downloader()
+		obj := aws.S3Object{BucketName: name, Key: "statements/1.pdf"}
+		_, err = obj.UploadReader(ctx, u, strings.NewReader("statement"), aws.S3UploadOptions{})
+		a.NoError(err)
+
+		buf := awssdk.NewWriteAtBuffer(nil)
+		_, err = obj.DownloadWriter(ctx, d, buf, aws.S3DownloadOptions{})
+		a.NoError(err)
+		a.Equal("statement", string(buf.Bytes()))
+
+		a.NoError(obj.Delete(ctx, s3c))
+	})
+
+	t.Run("sns", func(t *testing.T) {
+		sa, _ := c.SNS()
+		topic, err := sa.CreateTopic(&sns.CreateTopicInput{Name: awssdk.String(name)})
+		a.NoError(err)
+
+		_, err = aws.SNSMessage{TopicARN: *topic.TopicArn, Message: "hello"}.Publish(ctx, sa)
+		a.NoError(err)
+	})
+
+	t.Run("sqs", func(t *testing.T) {
+		qa, _ := c.SQS()
+		queue, err := qa.CreateQueue(&sqs.CreateQueueInput{QueueName: awssdk.String(name)})
+		a.NoError(err)
+
+		_, err = aws.SQSMessage{QueueURL: *queue.QueueUrl, Body: "hello"}.Send(ctx, qa)
+		a.NoError(err)
+	})
+
+	t.Run("secretsmanager", func(t *testing.T) {
+		sma, _ := c.SecretsManager()
+		_, err := sma.CreateSecret(&secretsmanager.CreateSecretInput{
+			Name:         awssdk.String(name),
+			SecretString: awssdk.String(`{"user":"stori"}`),
+		})
+		a.NoError(err)
+
+		value, err := aws.NewSecretCache(sma, time.Minute).Get(ctx, name)
+		a.NoError(err)
+		a.Equal(`{"user":"stori"}`, value)
+	})
+}
@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
+)
+
+// Kinds of AWS failures. Errors returned by the helpers in this package match one of these with
+// errors.Is, and still wrap the original awserr.Error for errors.As. They are the same errors as
+// those of awsclient, so the SDK v2 implementations of aws/sdkv2 match them too.
+var (
+	ErrNotFound       = awsclient.ErrNotFound
+	ErrAccessDenied   = awsclient.ErrAccessDenied
+	ErrThrottled      = awsclient.ErrThrottled
+	ErrInvalidRequest = awsclient.ErrInvalidRequest
+	ErrTransient      = awsclient.ErrTransient
+)
+
+type (
+	// Error is an error from the AWS SDK, classified by Kind
+	Error = awsclient.Error
+	// RetryPolicy retries AWS calls that failed because of throttling or transient failures. The
+	// helpers in this package use awsclient.DefaultRetryPolicy.
+	RetryPolicy = awsclient.RetryPolicy
+)
+
+// noSDKRetries disables the retries of the SDK for a request that is retried with
+// awsclient.DefaultRetryPolicy, so the retries of both layers don't multiply
+func noSDKRetries(r *request.Request) {
+	r.Retryer = client.NoOpRetryer{}
+}
+
+// wrapError classifies `err` returned by the AWS operation `op` into an *Error. nil is returned
+// for nil errors.
+func wrapError(op string, err error) error {
+	return shared.WrapError(op, err)
+}
+
+// batchEntryError returns the *Error of an entry of the batch operation `op` that failed with
+// `code`, so it can be classified like the errors of whole requests
+func batchEntryError(op, code, message string) error {
+	return shared.EntryError(op, code, message)
+}
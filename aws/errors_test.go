@@ -0,0 +1,89 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKinds(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "no secret", nil), aws.ErrNotFound},
+		{awserr.New("AccessDeniedException", "denied", nil), aws.ErrAccessDenied},
+		{awserr.New("ThrottlingException", "slow down", nil), aws.ErrThrottled},
+		{awserr.NewRequestFailure(awserr.New("SlowDown", "", nil), http.StatusTooManyRequests, "id"), aws.ErrThrottled},
+		{awserr.New("ValidationException", "bad", nil), aws.ErrInvalidRequest},
+		{awserr.NewRequestFailure(awserr.New("InternalError", "", nil), http.StatusInternalServerError, "id"), aws.ErrTransient},
+	}
+
+	for _, c := range cases {
+		mock := &mockSecretsClient{err: c.err}
+		_, err := aws.NewSecretCache(mock, time.Minute).Get(ctx, "db")
+
+		a.ErrorIs(err, c.kind, "%v should be %v", c.err, c.kind)
+
+		var aerr awserr.Error
+		a.True(errors.As(err, &aerr), "the original awserr.Error should be preserved")
+		a.Equal(c.err.(awserr.Error).Code(), aerr.Code())
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	p := aws.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, RetryTransient: true}
+
+	attempts := 0
+	err := p.Do(ctx, func() error {
+		attempts++
+		return &aws.Error{Op: "Op", Kind: aws.ErrThrottled, Err: errors.New("throttled")}
+	})
+	a.ErrorIs(err, aws.ErrThrottled)
+	a.Equal(3, attempts, "throttled calls should be retried up to MaxAttempts")
+
+	attempts = 0
+	err = p.Do(ctx, func() error {
+		attempts++
+		if attempts < 2 {
+			return &aws.Error{Op: "Op", Kind: aws.ErrTransient, Err: errors.New("500")}
+		}
+		return nil
+	})
+	a.NoError(err)
+	a.Equal(2, attempts)
+
+	attempts = 0
+	_ = p.ThrottleOnly().Do(ctx, func() error {
+		attempts++
+		return &aws.Error{Op: "Op", Kind: aws.ErrTransient, Err: errors.New("500")}
+	})
+	a.Equal(1, attempts, "transient failures should not be retried by a ThrottleOnly policy")
+
+	attempts = 0
+	_ = p.Do(ctx, func() error {
+		attempts++
+		return &aws.Error{Op: "Op", Kind: aws.ErrAccessDenied, Err: errors.New("denied")}
+	})
+	a.Equal(1, attempts, "access denied should not be retried")
+
+	attempts = 0
+	_ = p.Do(awsclient.SingleAttempt(ctx), func() error {
+		attempts++
+		return &aws.Error{Op: "Op", Kind: aws.ErrThrottled, Err: errors.New("throttled")}
+	})
+	a.Equal(1, attempts, "a SingleAttempt context should not be retried")
+}
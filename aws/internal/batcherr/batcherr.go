@@ -0,0 +1,27 @@
+// Package batcherr backs the Is and As methods of the batch errors of awsclient and aws, which hold
+// an error per failed entry.
+package batcherr
+
+import "errors"
+
+// Is reports whether errors.Is(err, target) is true for any of `errs`
+func Is(target error, errs []error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As calls errors.As(err, target) with each of `errs` until one of them matches
+func As(target interface{}, errs []error) bool {
+	for _, err := range errs {
+		if err != nil && errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
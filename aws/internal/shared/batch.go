@@ -0,0 +1,71 @@
+package shared
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+)
+
+// BatchFailure is an entry of a batch request that failed. It has the same fields as
+// awsclient.SNSBatchFailure and SQSBatchFailure, so it can be converted to either.
+type BatchFailure struct {
+	Index       int
+	Code        string
+	Message     string
+	SenderFault bool
+	Err         error
+}
+
+// BatchResult is the outcome of a batch request. IDs has the entry id and message id of each
+// successful entry.
+type BatchResult struct {
+	IDs      [][2]string
+	Failures []BatchFailure
+}
+
+// SendBatches calls `send` with the ranges of up to `size` of the `n` entries of a batch request,
+// retrying each request with `policy`. The id of every entry must be its index.
+//
+// The returned slice has the message id of every successful entry, and an empty string for those
+// that failed. Once a request fails, its entries and the remaining ones are returned as failed with
+// the RequestFailed code.
+func SendBatches(ctx context.Context, policy awsclient.RetryPolicy, op string, n, size int, send func(ctx context.Context, start, end int) (BatchResult, error)) ([]string, []BatchFailure) {
+	ids := make([]string, n)
+
+	var failures []BatchFailure
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+
+		var r BatchResult
+		err := policy.Do(ctx, func() error {
+			var err error
+			r, err = send(ctx, start, end)
+			return err
+		})
+		if err != nil {
+			// the whole request failed, so none of the remaining entries were sent
+			for i := start; i < n; i++ {
+				failures = append(failures, BatchFailure{Index: i, Code: "RequestFailed", Message: err.Error(), Err: err})
+			}
+			break
+		}
+
+		for _, id := range r.IDs {
+			if i, err := strconv.Atoi(id[0]); err == nil && i < n {
+				ids[i] = id[1]
+			}
+		}
+		for _, f := range r.Failures {
+			if f.Err == nil {
+				f.Err = EntryError(op, f.Code, f.Message)
+			}
+			failures = append(failures, f)
+		}
+	}
+
+	return ids, failures
+}
@@ -0,0 +1,160 @@
+// Package shared has the helpers used by the implementations of the awsclient interfaces of both
+// SDK versions. SDK errors are recognized by their methods, so it doesn't import either SDK.
+package shared
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+)
+
+// throttleCodes are the error codes of throttled requests
+var throttleCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestThrottledException":              true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+	"TransactionInProgressException":         true,
+	"RequestLimitExceeded":                   true,
+	"BandwidthLimitExceeded":                 true,
+	"LimitExceededException":                 true,
+	"RequestThrottled":                       true,
+	"SlowDown":                               true,
+	"PriorRequestNotComplete":                true,
+	"EC2ThrottledException":                  true,
+}
+
+var notFoundCodes = map[string]bool{
+	"ResourceNotFoundException": true,
+	"NotFound":                  true,
+	"NotFoundException":         true,
+	"NoSuchKey":                 true,
+	"NoSuchBucket":              true,
+	"NoSuchVersion":             true,
+	"QueueDoesNotExist":         true,
+	"AWS.SimpleQueueService.NonExistentQueue":     true,
+	"AWS.SimpleQueueService.QueueDeletedRecently": true,
+}
+
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"AuthorizationError":          true,
+	"UnrecognizedClientException": true,
+	"InvalidClientTokenId":        true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"KMSAccessDeniedException":    true,
+}
+
+var invalidRequestCodes = map[string]bool{
+	"InvalidParameter":               true,
+	"InvalidParameterException":      true,
+	"InvalidParameterValue":          true,
+	"InvalidParameterValueException": true,
+	"InvalidRequestException":        true,
+	"InvalidRequestContentException": true,
+	"ValidationException":            true,
+	"ValidationError":                true,
+	"RequestTooLargeException":       true,
+}
+
+// transientCodes are the error codes of transient failures: the SDK v1 codes of requests that
+// failed to be sent or timed out, and server side failures, which are reported without a status
+// code in the failed entries of batch requests
+var transientCodes = map[string]bool{
+	"RequestError":            true,
+	"RequestTimeout":          true,
+	"ResponseTimeout":         true,
+	"RequestTimeoutException": true,
+	"InternalError":           true,
+	"InternalFailure":         true,
+	"InternalServerError":     true,
+	"ServiceUnavailable":      true,
+}
+
+// The methods of the SDK errors: awserr.Error and awserr.RequestFailure of SDK v1, and
+// smithy.APIError and the HTTP response errors of SDK v2
+type (
+	codeError        interface{ Code() string }
+	apiError         interface{ ErrorCode() string }
+	statusError      interface{ StatusCode() int }
+	httpStatusError  interface{ HTTPStatusCode() int }
+	temporaryFailure interface{ Temporary() bool }
+)
+
+// WrapError classifies `err` returned by the AWS operation `op` into an *awsclient.Error. nil is
+// returned for nil errors.
+func WrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &awsclient.Error{Op: op, Kind: errorKind(err), Err: err}
+}
+
+// EntryError returns the *awsclient.Error of an entry of the batch operation `op` that failed with
+// `code`, so it can be classified like the errors of whole requests
+func EntryError(op, code, message string) error {
+	return WrapError(op, &entryError{code: code, message: message})
+}
+
+// entryError is the failure of a batch entry. Like awserr.Error, it has the Code, Message and
+// OrigErr methods.
+type entryError struct {
+	code    string
+	message string
+}
+
+func (e *entryError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func (e *entryError) Code() string    { return e.code }
+func (e *entryError) Message() string { return e.message }
+func (e *entryError) OrigErr() error  { return nil }
+
+// errorKind returns the kind of AWS failure of `err`, for errors of both SDK versions
+func errorKind(err error) error {
+	var code string
+	var ce codeError
+	var ae apiError
+	switch {
+	case errors.As(err, &ce):
+		code = ce.Code()
+	case errors.As(err, &ae):
+		code = ae.ErrorCode()
+	default:
+		return nil
+	}
+
+	var status int
+	var se statusError
+	var hse httpStatusError
+	if errors.As(err, &se) {
+		status = se.StatusCode()
+	} else if errors.As(err, &hse) {
+		status = hse.HTTPStatusCode()
+	}
+
+	var tf temporaryFailure
+	temporary := errors.As(err, &tf) && tf.Temporary()
+
+	switch {
+	case throttleCodes[code] || status == http.StatusTooManyRequests:
+		return awsclient.ErrThrottled
+	case notFoundCodes[code] || status == http.StatusNotFound:
+		return awsclient.ErrNotFound
+	case accessDeniedCodes[code] || status == http.StatusForbidden:
+		return awsclient.ErrAccessDenied
+	case invalidRequestCodes[code]:
+		return awsclient.ErrInvalidRequest
+	case temporary || transientCodes[code] || status >= http.StatusInternalServerError:
+		return awsclient.ErrTransient
+	default:
+		return nil
+	}
+}
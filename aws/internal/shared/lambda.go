@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+)
+
+// maxClientContextSize is the max size of the base64 encoded client context
+const maxClientContextSize = 3583
+
+// EncodeClientContext returns the base64 encoded JSON of the client context of `li`, or an empty
+// string if there is none
+func EncodeClientContext(li awsclient.LambdaInvocation) (string, error) {
+	if li.ClientContext == nil {
+		return "", nil
+	}
+
+	bb, err := json.Marshal(li.ClientContext)
+	if err != nil {
+		return "", fmt.Errorf("error parsing json from lambda client context: %w", err)
+	}
+
+	cc := base64.StdEncoding.EncodeToString(bb)
+	if len(cc) > maxClientContextSize {
+		return "", awsclient.ErrClientContextTooLarge
+	}
+
+	return cc, nil
+}
+
+// LogType returns the LogType of the invocation
+func LogType(li awsclient.LambdaInvocation) string {
+	if li.LogTail {
+		return "Tail"
+	}
+
+	return ""
+}
+
+// DecodeLogs decodes the base64 encoded LogResult of an invocation
+func DecodeLogs(logResult string) string {
+	bb, err := base64.StdEncoding.DecodeString(logResult)
+	if err != nil {
+		return ""
+	}
+
+	return string(bb)
+}
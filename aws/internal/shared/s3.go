@@ -0,0 +1,187 @@
+package shared
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+)
+
+// RetryUpload calls `upload` with the body to send, reporting progress if set. It is only retried
+// if `r` is an io.Seeker, which is rewound to its initial offset before each attempt, so readers
+// positioned after a header upload the same bytes on every attempt. Otherwise `sdkRetries` is true,
+// and the upload should keep the retries of the SDK, which buffers each part.
+func RetryUpload(ctx context.Context, r io.Reader, progress func(int64), upload func(body io.Reader, sdkRetries bool) error) error {
+	seeker, canRetry := r.(io.Seeker)
+
+	var start int64
+	if canRetry {
+		var err error
+		// some readers, like pipes, are seekers that fail to seek
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canRetry = false
+		}
+	}
+
+	policy := awsclient.DefaultRetryPolicy
+	if !canRetry {
+		policy.MaxAttempts = 1
+	}
+
+	return policy.Do(ctx, func() error {
+		body := r
+		if canRetry {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		if progress != nil {
+			body = &progressReader{r: body, progress: progress}
+		}
+
+		return upload(body, !canRetry)
+	})
+}
+
+// RetryDownload calls `download` with the target to write the object to, retrying throttled and
+// transient failures, so `download` should disable the retries of the SDK. `sequential` is true
+// when the parts must be written in order to be hashed. Every attempt writes the object from its
+// first byte, so the bytes of a failed attempt are overwritten, and progress starts over.
+func RetryDownload(ctx context.Context, w io.WriterAt, opts awsclient.S3DownloadOptions, download func(target io.WriterAt, sequential bool) (int64, error)) (int64, error) {
+	var n int64
+	var hw *hashWriterAt
+	err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		var target io.WriterAt
+		target, hw = downloadTarget(w, opts)
+
+		var err error
+		n, err = download(target, hw != nil)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error in download file: %w", err)
+	}
+
+	if hw != nil {
+		if err := hw.verify(opts.ExpectedSHA256); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// downloadTarget wraps `w` to report progress and hash the content as set in `opts`. The
+// returned hashWriterAt is nil if no checksum is expected; otherwise parts must be downloaded in
+// order.
+func downloadTarget(w io.WriterAt, opts awsclient.S3DownloadOptions) (io.WriterAt, *hashWriterAt) {
+	var hw *hashWriterAt
+	if opts.ExpectedSHA256 != "" {
+		hw = &hashWriterAt{w: w, h: sha256.New()}
+		w = hw
+	}
+
+	if opts.Progress != nil {
+		w = &progressWriterAt{w: w, progress: opts.Progress}
+	}
+
+	return w, hw
+}
+
+// EncodeTags renders `tags` as the URL query encoded string S3 expects in the Tagging header
+func EncodeTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(tags[k]))
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// progressReader reports the number of bytes read
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	progress func(int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.total += int64(n)
+		p.progress(p.total)
+	}
+
+	return n, err
+}
+
+// progressWriterAt reports the number of bytes written. Parts can be written concurrently.
+type progressWriterAt struct {
+	w        io.WriterAt
+	total    int64
+	progress func(int64)
+}
+
+func (p *progressWriterAt) WriteAt(b []byte, off int64) (int, error) {
+	n, err := p.w.WriteAt(b, off)
+	if n > 0 {
+		p.progress(atomic.AddInt64(&p.total, int64(n)))
+	}
+
+	return n, err
+}
+
+// hashWriterAt hashes the bytes written to it. Writes must be sequential.
+type hashWriterAt struct {
+	w   io.WriterAt
+	h   hash.Hash
+	mu  sync.Mutex
+	off int64
+	err error
+}
+
+func (hw *hashWriterAt) WriteAt(b []byte, off int64) (int, error) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	if off != hw.off && hw.err == nil {
+		hw.err = errors.New("can not verify checksum of out of order writes")
+	}
+
+	n, err := hw.w.WriteAt(b, off)
+	hw.h.Write(b[:n])
+	hw.off += int64(n)
+
+	return n, err
+}
+
+func (hw *hashWriterAt) verify(expected string) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	if hw.err != nil {
+		return hw.err
+	}
+
+	if got := hex.EncodeToString(hw.h.Sum(nil)); !strings.EqualFold(got, expected) {
+		return fmt.Errorf("%w: expected %s, got %s", awsclient.ErrChecksumMismatch, expected, got)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+)
+
+// snsMaxBatchSize is the max number of entries in a single PublishBatch request
+const snsMaxBatchSize = 10
+
+// SNSEntry is an SNS message encoded for a request of either SDK version
+type SNSEntry struct {
+	// ID is the index of the message in a batch
+	ID              string
+	Body            string
+	Attrs           map[string]MessageAttribute
+	Subject         string
+	GroupID         string
+	DeduplicationID string
+}
+
+// NewSNSEntry encodes the body and attributes of `m`
+func NewSNSEntry(m awsclient.SNSMessage) (SNSEntry, error) {
+	body, err := json.Marshal(m.Message)
+	if err != nil {
+		return SNSEntry{}, fmt.Errorf("error parsing json from sns message: %w", err)
+	}
+
+	attrs, err := MessageAttributes(m.Attributes)
+	if err != nil {
+		return SNSEntry{}, err
+	}
+
+	return SNSEntry{
+		Body:            string(body),
+		Attrs:           attrs,
+		Subject:         m.Subject,
+		GroupID:         m.GroupID,
+		DeduplicationID: m.DeduplicationID,
+	}, nil
+}
+
+// PublishSNSBatch encodes `msgs` and calls `send` with batches of up to 10 entries, retrying
+// throttled and transient request failures with DefaultRetryPolicy
+func PublishSNSBatch(ctx context.Context, topicARN string, msgs []awsclient.SNSMessage, send func(context.Context, []SNSEntry) (BatchResult, error)) ([]string, error) {
+	ids := make([]string, len(msgs))
+	entries := make([]SNSEntry, 0, len(msgs))
+
+	for i, m := range msgs {
+		if m.TopicARN != "" && m.TopicARN != topicARN {
+			return ids, awsclient.ErrSNSTopicMismatch
+		}
+
+		e, err := NewSNSEntry(m)
+		if err != nil {
+			return ids, fmt.Errorf("sns message %d: %w", i, err)
+		}
+		e.ID = strconv.Itoa(i)
+		entries = append(entries, e)
+	}
+
+	ids, failures := SendBatches(ctx, awsclient.DefaultRetryPolicy, "PublishBatch", len(entries), snsMaxBatchSize, func(ctx context.Context, start, end int) (BatchResult, error) {
+		return send(ctx, entries[start:end])
+	})
+
+	if len(failures) > 0 {
+		out := make([]awsclient.SNSBatchFailure, len(failures))
+		for i, f := range failures {
+			out[i] = awsclient.SNSBatchFailure(f)
+		}
+		return ids, &awsclient.SNSBatchError{Failures: out}
+	}
+
+	return ids, nil
+}
+
+// MessageAttribute is a single SNS or SQS message attribute
+type MessageAttribute struct {
+	DataType string
+	Value    string
+}
+
+// MessageAttributes converts a map or struct into message attributes. Strings and bools become
+// String attributes, numbers Number attributes and slices String.Array attributes. Nil values are
+// left out.
+func MessageAttributes(attrs interface{}) (map[string]MessageAttribute, error) {
+	if attrs == nil {
+		return nil, nil
+	}
+
+	bb, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing message attributes: %w", err)
+	}
+
+	var values map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(bb))
+	d.UseNumber()
+	if err := d.Decode(&values); err != nil {
+		return nil, errors.New("message attributes must be a map or struct")
+	}
+
+	out := make(map[string]MessageAttribute, len(values))
+	for k, v := range values {
+		switch val := v.(type) {
+		case nil:
+			continue
+		case string:
+			out[k] = MessageAttribute{"String", val}
+		case bool:
+			out[k] = MessageAttribute{"String", strconv.FormatBool(val)}
+		case json.Number:
+			out[k] = MessageAttribute{"Number", val.String()}
+		case []interface{}:
+			arr, _ := json.Marshal(val)
+			out[k] = MessageAttribute{"String.Array", string(arr)}
+		default:
+			return nil, fmt.Errorf("unsupported type for message attribute %q", k)
+		}
+	}
+
+	return out, nil
+}
+
+// OptionalString returns nil for empty strings, so optional fields are left out of requests
+func OptionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
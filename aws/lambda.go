@@ -0,0 +1,56 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+)
+
+// The values of LambdaInvocation.InvocationType
+const (
+	InvocationRequestResponse = awsclient.InvocationRequestResponse
+	InvocationEvent           = awsclient.InvocationEvent
+	InvocationDryRun          = awsclient.InvocationDryRun
+)
+
+var ErrClientContextTooLarge = awsclient.ErrClientContextTooLarge
+
+type (
+	// FunctionError is returned when the invoked function fails
+	FunctionError = awsclient.FunctionError
+	// LambdaResponse is the response of a Lambda invocation
+	LambdaResponse = awsclient.LambdaResponse
+)
+
+// Invoke invokes the function and decodes its response into `dst`, which can be nil to ignore
+// the response. A *FunctionError is returned if the function failed.
+func (li LambdaInvocation) Invoke(ctx context.Context, la lambdaiface.LambdaAPI, dst interface{}) (LambdaResponse, error) {
+	return awsclient.InvokeInto(ctx, NewLambdaInvokerV1(la), awsclient.LambdaInvocation(li), dst)
+}
+
+// InvokeInto is LambdaInvocation.Invoke for any LambdaInvoker, such as the SDK v2 one. See
+// awsclient.InvokeInto.
+func InvokeInto(ctx context.Context, invoker LambdaInvoker, li LambdaInvocation, dst interface{}) (LambdaResponse, error) {
+	return awsclient.InvokeInto(ctx, invoker, awsclient.LambdaInvocation(li), dst)
+}
+
+const DefaultFanOutConcurrency = awsclient.DefaultFanOutConcurrency
+
+type (
+	// FanOutOptions configures InvokeAll
+	FanOutOptions = awsclient.FanOutOptions
+	// FanOutResult is the outcome of one invocation of InvokeAll
+	FanOutResult = awsclient.FanOutResult
+)
+
+// InvokeAll invokes every one of `invocations` with at most opts.Concurrency running at once. See
+// awsclient.InvokeAll.
+func InvokeAll(ctx context.Context, invoker LambdaInvoker, invocations []LambdaInvocation, opts FanOutOptions) []FanOutResult {
+	lis := make([]awsclient.LambdaInvocation, len(invocations))
+	for i, li := range invocations {
+		lis[i] = awsclient.LambdaInvocation(li)
+	}
+
+	return awsclient.InvokeAll(ctx, invoker, lis, opts)
+}
@@ -0,0 +1,127 @@
+package aws_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// Lambda client returning a fixed output and recording the input
+type mockInvokeClient struct {
+	lambdaiface.LambdaAPI
+	out *lambda.InvokeOutput
+	in  *lambda.InvokeInput
+	// maxRetries are the retries left to the SDK by the request options
+	maxRetries int
+}
+
+func (m *mockInvokeClient) InvokeWithContext(_ awssdk.Context, in *lambda.InvokeInput, opts ...request.Option) (*lambda.InvokeOutput, error) {
+	m.in = in
+
+	r := &request.Request{Retryer: client.DefaultRetryer{NumMaxRetries: 3}}
+	r.ApplyOptions(opts...)
+	m.maxRetries = r.MaxRetries()
+
+	return m.out, nil
+}
+
+func TestInvoke(t *testing.T) {
+	a := assert.New(t)
+	mock := &mockInvokeClient{out: &lambda.InvokeOutput{
+		StatusCode: awssdk.Int64(200),
+		Payload:    []byte(`{"balance":10}`),
+		LogResult:  awssdk.String(base64.StdEncoding.EncodeToString([]byte("START RequestId: 1"))),
+	}}
+
+	li := aws.LambdaInvocation{
+		FunctionName:  "stori-balance",
+		Event:         map[string]string{"account": "1"},
+		Qualifier:     "live",
+		ClientContext: map[string]interface{}{"custom": map[string]string{"user": "1"}},
+		LogTail:       true,
+	}
+
+	var out struct {
+		Balance int `json:"balance"`
+	}
+	res, err := li.Invoke(context.Background(), mock, &out)
+	a.NoError(err)
+	a.Equal(10, out.Balance)
+	a.Zero(mock.maxRetries, "the SDK should not retry on top of the retry policy")
+	a.Equal("START RequestId: 1", res.Logs)
+
+	a.Equal("live", *mock.in.Qualifier)
+	a.Equal("Tail", *mock.in.LogType)
+	a.Nil(mock.in.InvocationType, "should use the default invocation type")
+	cc, _ := base64.StdEncoding.DecodeString(*mock.in.ClientContext)
+	a.JSONEq(`{"custom":{"user":"1"}}`, string(cc))
+
+	// Event invocations have no payload to decode
+	mock.out = &lambda.InvokeOutput{StatusCode: awssdk.Int64(202)}
+	li = aws.LambdaInvocation{FunctionName: "stori-balance", InvocationType: aws.InvocationEvent}
+	_, err = li.Invoke(context.Background(), mock, &out)
+	a.NoError(err)
+	a.Equal("Event", *mock.in.InvocationType)
+	a.Nil(mock.in.Qualifier)
+	a.Nil(mock.in.ClientContext)
+	a.Nil(mock.in.LogType)
+
+	li.ClientContext = strings.Repeat("x", 3000)
+	_, err = li.Invoke(context.Background(), mock, nil)
+	a.ErrorIs(err, aws.ErrClientContextTooLarge)
+}
+
+func TestInvokeFunctionError(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    aws.FunctionError
+	}{
+		{
+			"node",
+			`{"errorType":"TypeError","errorMessage":"x is undefined","stackTrace":["at handler (index.js:1:1)"]}`,
+			aws.FunctionError{Type: "TypeError", Message: "x is undefined", StackTrace: []string{"at handler (index.js:1:1)"}},
+		},
+		{
+			"go",
+			`{"errorType":"errorString","errorMessage":"boom","stackTrace":[{"path":"main.go","line":12,"label":"handler"}]}`,
+			aws.FunctionError{Type: "errorString", Message: "boom", StackTrace: []string{"handler (main.go:12)"}},
+		},
+		{
+			"raw",
+			"Task timed out\n",
+			aws.FunctionError{Message: "Task timed out"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			mock := &mockInvokeClient{out: &lambda.InvokeOutput{
+				StatusCode:    awssdk.Int64(200),
+				FunctionError: awssdk.String("Unhandled"),
+				Payload:       []byte(tt.payload),
+			}}
+
+			var out map[string]interface{}
+			_, err := aws.LambdaInvocation{FunctionName: "stori-fn"}.Invoke(context.Background(), mock, &out)
+
+			var fe *aws.FunctionError
+			if a.ErrorAs(err, &fe) {
+				tt.want.FunctionName = "stori-fn"
+				tt.want.Kind = "Unhandled"
+				a.Equal(&tt.want, fe)
+			}
+			a.Nil(out, "the error payload should not be decoded into the response")
+		})
+	}
+}
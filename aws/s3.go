@@ -0,0 +1,428 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/batcherr"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
+)
+
+type (
+	// S3UploadOptions configures the object created by S3Object.UploadReader
+	S3UploadOptions = awsclient.S3UploadOptions
+	// S3DownloadOptions configures S3Object.DownloadWriter
+	S3DownloadOptions = awsclient.S3DownloadOptions
+	// S3UploadResult is the outcome of ObjectStore.Upload
+	S3UploadResult = awsclient.S3UploadResult
+)
+
+// S3ObjectInfo is the S3Object along with the attributes returned by List and Head. ContentType
+// and Metadata are only set by Head.
+type S3ObjectInfo struct {
+	S3Object
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	StorageClass string
+	ContentType  string
+	Metadata     map[string]string
+}
+
+// S3DeleteFailure describes a single object that could not be deleted by DeleteS3Objects
+type S3DeleteFailure struct {
+	Object  S3Object
+	Code    string
+	Message string
+	// Err is the *Error of the failure, which matches ErrAccessDenied, ErrThrottled, etc. with
+	// errors.Is
+	Err error
+}
+
+// S3DeleteError is returned by DeleteS3Objects when one or more objects were not deleted
+type S3DeleteError struct {
+	Failures []S3DeleteFailure
+}
+
+func (e *S3DeleteError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("s3://%s/%s: %s: %s", f.Object.BucketName, f.Object.Key, f.Code, f.Message))
+	}
+
+	return fmt.Sprintf("%d S3 objects were not deleted: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any failure matches `target`, like errors.Is(err, ErrThrottled) to check if
+// the objects should be deleted again
+func (e *S3DeleteError) Is(target error) bool {
+	return batcherr.Is(target, e.errs())
+}
+
+// As finds the first failure that matches `target`, like an *Error
+func (e *S3DeleteError) As(target interface{}) bool {
+	return batcherr.As(target, e.errs())
+}
+
+func (e *S3DeleteError) errs() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+
+	return errs
+}
+
+// s3MaxDeleteBatchSize is the max number of keys in a single DeleteObjects request
+const s3MaxDeleteBatchSize = 1000
+
+// MaxPresignExpiry is the longest expiry S3 accepts for presigned URLs
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+var (
+	ErrChecksumMismatch     = awsclient.ErrChecksumMismatch
+	ErrInvalidPresignExpiry = errors.New("presign expiry must be between 1 second and 7 days")
+)
+
+// UploadReader uploads the content of `r` to S3 without staging it on disk. Large bodies are sent
+// as a multipart upload. The upload is only retried if `r` is also an io.Seeker.
+func (s S3Object) UploadReader(ctx context.Context, u s3manageriface.UploaderAPI, r io.Reader, opts S3UploadOptions) (*s3manager.UploadOutput, error) {
+	var out *s3manager.UploadOutput
+	err := shared.RetryUpload(ctx, r, opts.Progress, func(body io.Reader, sdkRetries bool) error {
+		var err error
+		out, err = u.UploadWithContext(ctx, s.uploadInput(body, opts), func(up *s3manager.Uploader) {
+			if opts.PartSize > 0 {
+				up.PartSize = opts.PartSize
+			}
+			if !sdkRetries {
+				noUploaderRetries(up)
+			}
+		})
+		return wrapError("Upload", err)
+	})
+	if err != nil {
+		return &s3manager.UploadOutput{}, fmt.Errorf("error in uploading file: %w", err)
+	}
+
+	return out, nil
+}
+
+// DownloadWriter downloads the object into `w` without staging it on disk. Use
+// aws.NewWriteAtBuffer to download into memory. It returns the number of bytes downloaded.
+//
+// Throttled and transient failures are retried like Download. Every attempt writes the object
+// from its first byte, so the bytes of a failed attempt are overwritten, and Progress starts over.
+func (s S3Object) DownloadWriter(ctx context.Context, d s3manageriface.DownloaderAPI, w io.WriterAt, opts S3DownloadOptions) (int64, error) {
+	return shared.RetryDownload(ctx, w, opts, func(target io.WriterAt, sequential bool) (int64, error) {
+		n, err := d.DownloadWithContext(
+			ctx,
+			target,
+			&s3.GetObjectInput{
+				Bucket:    aws.String(s.BucketName),
+				Key:       aws.String(s.Key),
+				VersionId: optionalString(s.VersionID),
+			},
+			func(dl *s3manager.Downloader) {
+				// hashing needs the parts in order
+				if sequential {
+					dl.Concurrency = 1
+				}
+			},
+			noDownloaderRetries,
+		)
+		return n, wrapError("Download", err)
+	})
+}
+
+// List calls `f` with every object whose key starts with s.Key, in lexicographic key order.
+// Pages of up to 1000 objects are requested as needed, so listing stops early without fetching
+// the remaining pages when `f` returns false.
+func (s S3Object) List(ctx context.Context, sa s3iface.S3API, f func(obj S3ObjectInfo) bool) error {
+	in := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.BucketName),
+		Prefix: optionalString(s.Key),
+	}
+
+	for {
+		var out *s3.ListObjectsV2Output
+		err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+			var err error
+			out, err = sa.ListObjectsV2WithContext(ctx, in, noSDKRetries)
+			return wrapError("ListObjectsV2", err)
+		})
+		if err != nil {
+			return fmt.Errorf("error listing s3://%s/%s: %w", s.BucketName, s.Key, err)
+		}
+
+		for _, o := range out.Contents {
+			info := S3ObjectInfo{
+				S3Object:     S3Object{BucketName: s.BucketName, Key: aws.StringValue(o.Key)},
+				Size:         aws.Int64Value(o.Size),
+				LastModified: aws.TimeValue(o.LastModified),
+				ETag:         aws.StringValue(o.ETag),
+				StorageClass: aws.StringValue(o.StorageClass),
+			}
+			if !f(info) {
+				return nil
+			}
+		}
+
+		if !aws.BoolValue(out.IsTruncated) {
+			return nil
+		}
+		in.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+// Head returns the attributes of the object. Errors match ErrNotFound if the object doesn't exist.
+func (s S3Object) Head(ctx context.Context, sa s3iface.S3API) (S3ObjectInfo, error) {
+	var out *s3.HeadObjectOutput
+	err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		var err error
+		out, err = sa.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:    aws.String(s.BucketName),
+			Key:       aws.String(s.Key),
+			VersionId: optionalString(s.VersionID),
+		}, noSDKRetries)
+		return wrapError("HeadObject", err)
+	})
+	if err != nil {
+		return S3ObjectInfo{}, fmt.Errorf("error getting s3://%s/%s: %w", s.BucketName, s.Key, err)
+	}
+
+	return S3ObjectInfo{
+		S3Object:     s,
+		Size:         aws.Int64Value(out.ContentLength),
+		LastModified: aws.TimeValue(out.LastModified),
+		ETag:         aws.StringValue(out.ETag),
+		StorageClass: aws.StringValue(out.StorageClass),
+		ContentType:  aws.StringValue(out.ContentType),
+		Metadata:     aws.StringValueMap(out.Metadata),
+	}, nil
+}
+
+// Exists reports whether the object exists
+func (s S3Object) Exists(ctx context.Context, sa s3iface.S3API) (bool, error) {
+	_, err := s.Head(ctx, sa)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Copy copies the object, or the VersionID of it, to `dst`, keeping its metadata. Objects larger
+// than 5 GB can not be copied in a single request and return an ErrInvalidRequest error.
+func (s S3Object) Copy(ctx context.Context, sa s3iface.S3API, dst S3Object) error {
+	source := escapeS3Path(s.BucketName + "/" + s.Key)
+	if s.VersionID != "" {
+		source += "?versionId=" + url.QueryEscape(s.VersionID)
+	}
+
+	err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		_, err := sa.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(dst.BucketName),
+			Key:        aws.String(dst.Key),
+			CopySource: aws.String(source),
+		}, noSDKRetries)
+		return wrapError("CopyObject", err)
+	})
+	if err != nil {
+		return fmt.Errorf("error copying s3://%s/%s: %w", s.BucketName, s.Key, err)
+	}
+
+	return nil
+}
+
+// Move copies the object to `dst` and then deletes it. If VersionID is set only that version is
+// deleted.
+func (s S3Object) Move(ctx context.Context, sa s3iface.S3API, dst S3Object) error {
+	if err := s.Copy(ctx, sa, dst); err != nil {
+		return err
+	}
+
+	return s.Delete(ctx, sa)
+}
+
+// Delete deletes the object. Deleting an object that doesn't exist is not an error.
+func (s S3Object) Delete(ctx context.Context, sa s3iface.S3API) error {
+	err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		_, err := sa.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket:    aws.String(s.BucketName),
+			Key:       aws.String(s.Key),
+			VersionId: optionalString(s.VersionID),
+		}, noSDKRetries)
+		return wrapError("DeleteObject", err)
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting s3://%s/%s: %w", s.BucketName, s.Key, err)
+	}
+
+	return nil
+}
+
+// DeleteS3Objects deletes `objs`, sending one DeleteObjects request per bucket and up to 1000 keys
+// per request. Objects with a VersionID delete that version instead of the latest one. If any object failed an *S3DeleteError is returned with the details of each failure.
+func DeleteS3Objects(ctx context.Context, sa s3iface.S3API, objs []S3Object) error {
+	var buckets []string
+	keys := map[string][]*s3.ObjectIdentifier{}
+	for _, o := range objs {
+		if _, ok := keys[o.BucketName]; !ok {
+			buckets = append(buckets, o.BucketName)
+		}
+		keys[o.BucketName] = append(keys[o.BucketName], &s3.ObjectIdentifier{
+			Key:       aws.String(o.Key),
+			VersionId: optionalString(o.VersionID),
+		})
+	}
+
+	var failures []S3DeleteFailure
+	for _, bucket := range buckets {
+		ids := keys[bucket]
+		for start := 0; start < len(ids); start += s3MaxDeleteBatchSize {
+			end := start + s3MaxDeleteBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+
+			in := &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &s3.Delete{Objects: ids[start:end], Quiet: aws.Bool(true)},
+			}
+
+			var out *s3.DeleteObjectsOutput
+			err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+				var err error
+				out, err = sa.DeleteObjectsWithContext(ctx, in, noSDKRetries)
+				return wrapError("DeleteObjects", err)
+			})
+			if err != nil {
+				for _, id := range ids[start:end] {
+					failures = append(failures, S3DeleteFailure{
+						Object:  S3Object{BucketName: bucket, Key: aws.StringValue(id.Key), VersionID: aws.StringValue(id.VersionId)},
+						Code:    "RequestFailed",
+						Message: err.Error(),
+						Err:     err,
+					})
+				}
+				continue
+			}
+
+			for _, e := range out.Errors {
+				failures = append(failures, S3DeleteFailure{
+					Object:  S3Object{BucketName: bucket, Key: aws.StringValue(e.Key), VersionID: aws.StringValue(e.VersionId)},
+					Code:    aws.StringValue(e.Code),
+					Message: aws.StringValue(e.Message),
+					Err:     batchEntryError("DeleteObjects", aws.StringValue(e.Code), aws.StringValue(e.Message)),
+				})
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return &S3DeleteError{Failures: failures}
+	}
+
+	return nil
+}
+
+// PresignGet returns a URL that downloads the object without AWS credentials until `expiry`
+// passes. The URL is signed with the credentials of `sa`, so it stops working earlier if they
+// are temporary credentials that expire first.
+func (s S3Object) PresignGet(sa s3iface.S3API, expiry time.Duration) (string, error) {
+	if err := validatePresignExpiry(expiry); err != nil {
+		return "", err
+	}
+
+	req, _ := sa.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:    aws.String(s.BucketName),
+		Key:       aws.String(s.Key),
+		VersionId: optionalString(s.VersionID),
+	})
+
+	u, err := req.Presign(expiry)
+	if err != nil {
+		return "", fmt.Errorf("error presigning s3://%s/%s: %w", s.BucketName, s.Key, err)
+	}
+
+	return u, nil
+}
+
+// PresignPut returns a URL that uploads the object with an HTTP PUT without AWS credentials until
+// `expiry` passes. When `contentType` is set the client must send the same Content-Type header.
+func (s S3Object) PresignPut(sa s3iface.S3API, expiry time.Duration, contentType string) (string, error) {
+	if err := validatePresignExpiry(expiry); err != nil {
+		return "", err
+	}
+
+	req, _ := sa.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(s.BucketName),
+		Key:         aws.String(s.Key),
+		ContentType: optionalString(contentType),
+	})
+
+	u, err := req.Presign(expiry)
+	if err != nil {
+		return "", fmt.Errorf("error presigning s3://%s/%s: %w", s.BucketName, s.Key, err)
+	}
+
+	return u, nil
+}
+
+func validatePresignExpiry(expiry time.Duration) error {
+	if expiry < time.Second || expiry > MaxPresignExpiry {
+		return ErrInvalidPresignExpiry
+	}
+
+	return nil
+}
+
+// uploadInput builds the s3manager.UploadInput for the object
+func (s S3Object) uploadInput(body io.Reader, opts S3UploadOptions) *s3manager.UploadInput {
+	in := &s3manager.UploadInput{
+		Bucket:       aws.String(s.BucketName),
+		Key:          aws.String(s.Key),
+		Body:         body,
+		ContentType:  optionalString(opts.ContentType),
+		StorageClass: optionalString(opts.StorageClass),
+		Tagging:      optionalString(shared.EncodeTags(opts.Tags)),
+	}
+
+	if len(opts.Metadata) > 0 {
+		in.Metadata = aws.StringMap(opts.Metadata)
+	}
+
+	if opts.KMSKeyID != "" {
+		in.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		in.SSEKMSKeyId = aws.String(opts.KMSKeyID)
+	}
+
+	if opts.Checksum {
+		in.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmSha256)
+	}
+
+	return in
+}
+
+// noUploaderRetries disables the retries of the SDK for the parts of an upload retried with
+// awsclient.DefaultRetryPolicy
+func noUploaderRetries(u *s3manager.Uploader) {
+	u.RequestOptions = append(u.RequestOptions, noSDKRetries)
+}
+
+// noDownloaderRetries disables the retries of the SDK for the parts of a download retried with
+// awsclient.DefaultRetryPolicy
+func noDownloaderRetries(d *s3manager.Downloader) {
+	d.RequestOptions = append(d.RequestOptions, noSDKRetries)
+}
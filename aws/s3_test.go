@@ -0,0 +1,389 @@
+package aws_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// uploader that reads the whole body and records the input
+type mockStreamUploader struct {
+	s3manageriface.UploaderAPI
+	input    *s3manager.UploadInput
+	body     []byte
+	partSize int64
+	// failures is the number of attempts that fail with a transient error after reading the body
+	failures int
+}
+
+func (m *mockStreamUploader) UploadWithContext(_ awssdk.Context, in *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	u := &s3manager.Uploader{}
+	for _, o := range opts {
+		o(u)
+	}
+	m.partSize = u.PartSize
+
+	m.input = in
+	m.body, _ = ioutil.ReadAll(in.Body)
+	if m.failures > 0 {
+		m.failures--
+		return nil, awserr.New("InternalError", "try again", nil)
+	}
+
+	return &s3manager.UploadOutput{Location: "location"}, nil
+}
+
+// downloader that writes `content` in two parts
+type mockStreamDownloader struct {
+	s3manageriface.DownloaderAPI
+	content []byte
+	// failures is the number of attempts that fail with a transient error after the first part
+	failures int
+}
+
+func (m *mockStreamDownloader) DownloadWithContext(_ awssdk.Context, w io.WriterAt, _ *s3.GetObjectInput, opts ...func(*s3manager.Downloader)) (int64, error) {
+	half := len(m.content) / 2
+	if _, err := w.WriteAt(m.content[:half], 0); err != nil {
+		return 0, err
+	}
+	if m.failures > 0 {
+		m.failures--
+		return 0, awserr.New("InternalError", "connection reset", nil)
+	}
+	if _, err := w.WriteAt(m.content[half:], int64(half)); err != nil {
+		return 0, err
+	}
+
+	return int64(len(m.content)), nil
+}
+
+func TestUploadReader(t *testing.T) {
+	a := assert.New(t)
+	obj := aws.S3Object{BucketName: "stori-bucket", Key: "statements/1.pdf"}
+	mock := &mockStreamUploader{}
+
+	var progress int64
+	out, err := obj.UploadReader(context.Background(), mock, strings.NewReader("statement"), aws.S3UploadOptions{
+		ContentType:  "application/pdf",
+		KMSKeyID:     "alias/statements",
+		Metadata:     map[string]string{"account": "1"},
+		Tags:         map[string]string{"type": "statement", "owner": "a&b"},
+		StorageClass: s3.StorageClassStandardIa,
+		Checksum:     true,
+		PartSize:     10 * 1024 * 1024,
+		Progress:     func(n int64) { progress = n },
+	})
+	a.NoError(err)
+	a.Equal("location", out.Location)
+
+	in := mock.input
+	a.Equal([]byte("statement"), mock.body)
+	a.Equal("application/pdf", *in.ContentType)
+	a.Equal("aws:kms", *in.ServerSideEncryption)
+	a.Equal("alias/statements", *in.SSEKMSKeyId)
+	a.Equal("1", *in.Metadata["account"])
+	a.Equal("owner=a%26b&type=statement", *in.Tagging)
+	a.Equal("STANDARD_IA", *in.StorageClass)
+	a.Equal("SHA256", *in.ChecksumAlgorithm)
+	a.Equal(int64(10*1024*1024), mock.partSize)
+	a.Equal(int64(len("statement")), progress)
+
+	_, _ = obj.UploadReader(context.Background(), mock, strings.NewReader("x"), aws.S3UploadOptions{})
+	a.Nil(mock.input.ContentType, "unset options should not be sent")
+	a.Nil(mock.input.Tagging)
+	a.Nil(mock.input.ServerSideEncryption)
+
+	// a reader positioned after a header is rewound to the same position on retries
+	r := strings.NewReader("header|statement")
+	_, _ = r.Seek(int64(len("header|")), io.SeekStart)
+	mock.failures = 1
+	_, err = obj.UploadReader(context.Background(), mock, r, aws.S3UploadOptions{})
+	a.NoError(err)
+	a.Equal([]byte("statement"), mock.body)
+}
+
+func TestDownloadWriter(t *testing.T) {
+	a := assert.New(t)
+	obj := aws.S3Object{BucketName: "stori-bucket", Key: "statements/1.pdf"}
+	content := []byte("statement content")
+	mock := &mockStreamDownloader{content: content}
+	sum := sha256.Sum256(content)
+
+	var progress int64
+	buf := awssdk.NewWriteAtBuffer(nil)
+	n, err := obj.DownloadWriter(context.Background(), mock, buf, aws.S3DownloadOptions{
+		ExpectedSHA256: hex.EncodeToString(sum[:]),
+		Progress:       func(n int64) { progress = n },
+	})
+	a.NoError(err)
+	a.Equal(int64(len(content)), n)
+	a.True(bytes.Equal(content, buf.Bytes()))
+	a.Equal(int64(len(content)), progress)
+
+	_, err = obj.DownloadWriter(context.Background(), mock, awssdk.NewWriteAtBuffer(nil), aws.S3DownloadOptions{
+		ExpectedSHA256: strings.Repeat("0", 64),
+	})
+	a.ErrorIs(err, aws.ErrChecksumMismatch)
+
+	mock.failures = 1
+	buf = awssdk.NewWriteAtBuffer(nil)
+	n, err = obj.DownloadWriter(context.Background(), mock, buf, aws.S3DownloadOptions{
+		ExpectedSHA256: hex.EncodeToString(sum[:]),
+	})
+	a.NoError(err, "transient failures should be retried, verifying the checksum of the last attempt")
+	a.Equal(int64(len(content)), n)
+	a.True(bytes.Equal(content, buf.Bytes()))
+}
+
+// S3 client that stores objects in memory
+type mockS3Client struct {
+	s3iface.S3API
+	objects   map[string]string
+	pageSize  int
+	listCalls int
+	deletes   []*s3.DeleteObjectsInput
+	deleteErr error
+}
+
+func (m *mockS3Client) ListObjectsV2WithContext(_ awssdk.Context, in *s3.ListObjectsV2Input, _ ...request.Option) (*s3.ListObjectsV2Output, error) {
+	m.listCalls++
+
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, awssdk.StringValue(in.Prefix)) && k > awssdk.StringValue(in.ContinuationToken) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectsV2Output{}
+	if len(keys) > m.pageSize {
+		keys = keys[:m.pageSize]
+		out.IsTruncated = awssdk.Bool(true)
+		out.NextContinuationToken = awssdk.String(keys[len(keys)-1])
+	}
+	for _, k := range keys {
+		out.Contents = append(out.Contents, &s3.Object{Key: awssdk.String(k), Size: awssdk.Int64(int64(len(m.objects[k])))})
+	}
+
+	return out, nil
+}
+
+func (m *mockS3Client) HeadObjectWithContext(_ awssdk.Context, in *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+	body, ok := m.objects[awssdk.StringValue(in.Key)]
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+	}
+
+	return &s3.HeadObjectOutput{ContentLength: awssdk.Int64(int64(len(body))), ContentType: awssdk.String("text/plain")}, nil
+}
+
+func (m *mockS3Client) CopyObjectWithContext(_ awssdk.Context, in *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+	// S3 decodes the copy source like a query string, so + is a space
+	source, _ := url.QueryUnescape(awssdk.StringValue(in.CopySource))
+	m.objects[awssdk.StringValue(in.Key)] = m.objects[strings.TrimPrefix(source, "stori-bucket/")]
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *mockS3Client) DeleteObjectWithContext(_ awssdk.Context, in *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	delete(m.objects, awssdk.StringValue(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *mockS3Client) DeleteObjectsWithContext(_ awssdk.Context, in *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	m.deletes = append(m.deletes, in)
+	if m.deleteErr != nil {
+		return nil, m.deleteErr
+	}
+
+	out := &s3.DeleteObjectsOutput{}
+	for _, o := range in.Delete.Objects {
+		if awssdk.StringValue(o.Key) == "locked" {
+			out.Errors = append(out.Errors, &s3.Error{Key: o.Key, VersionId: o.VersionId, Code: awssdk.String("AccessDenied"), Message: awssdk.String("Access Denied")})
+		}
+	}
+
+	return out, nil
+}
+
+func newMockS3Client() *mockS3Client {
+	return &mockS3Client{
+		pageSize: 2,
+		objects: map[string]string{
+			"statements/1.pdf": "one",
+			"statements/2.pdf": "two",
+			"statements/3.pdf": "three",
+			"reports/1.csv":    "report",
+		},
+	}
+}
+
+func TestS3List(t *testing.T) {
+	a := assert.New(t)
+	mock := newMockS3Client()
+	obj := aws.S3Object{BucketName: "stori-bucket", Key: "statements/"}
+
+	var keys []string
+	err := obj.List(context.Background(), mock, func(o aws.S3ObjectInfo) bool {
+		a.Equal("stori-bucket", o.BucketName)
+		keys = append(keys, o.Key)
+		return true
+	})
+	a.NoError(err)
+	a.Equal([]string{"statements/1.pdf", "statements/2.pdf", "statements/3.pdf"}, keys)
+	a.Equal(2, mock.listCalls)
+
+	mock.listCalls = 0
+	err = obj.List(context.Background(), mock, func(o aws.S3ObjectInfo) bool { return false })
+	a.NoError(err)
+	a.Equal(1, mock.listCalls, "should not fetch more pages after stopping")
+}
+
+func TestS3HeadExists(t *testing.T) {
+	a := assert.New(t)
+	mock := newMockS3Client()
+
+	info, err := aws.S3Object{BucketName: "stori-bucket", Key: "statements/3.pdf"}.Head(context.Background(), mock)
+	a.NoError(err)
+	a.Equal(int64(5), info.Size)
+	a.Equal("text/plain", info.ContentType)
+
+	_, err = aws.S3Object{BucketName: "stori-bucket", Key: "missing"}.Head(context.Background(), mock)
+	a.ErrorIs(err, aws.ErrNotFound)
+
+	ok, err := aws.S3Object{BucketName: "stori-bucket", Key: "missing"}.Exists(context.Background(), mock)
+	a.NoError(err)
+	a.False(ok)
+
+	ok, err = aws.S3Object{BucketName: "stori-bucket", Key: "reports/1.csv"}.Exists(context.Background(), mock)
+	a.NoError(err)
+	a.True(ok)
+}
+
+func TestS3CopyMoveDelete(t *testing.T) {
+	a := assert.New(t)
+	mock := newMockS3Client()
+	src := aws.S3Object{BucketName: "stori-bucket", Key: "statements/1.pdf"}
+
+	a.NoError(src.Copy(context.Background(), mock, aws.S3Object{BucketName: "stori-bucket", Key: "copy.pdf"}))
+	a.Equal("one", mock.objects["copy.pdf"])
+	a.Contains(mock.objects, src.Key)
+
+	a.NoError(src.Move(context.Background(), mock, aws.S3Object{BucketName: "stori-bucket", Key: "archive/1 a+b.pdf"}))
+	a.Equal("one", mock.objects["archive/1 a+b.pdf"])
+	a.NotContains(mock.objects, src.Key)
+
+	a.NoError(aws.S3Object{BucketName: "stori-bucket", Key: "copy.pdf"}.Delete(context.Background(), mock))
+	a.NotContains(mock.objects, "copy.pdf")
+
+	// + and spaces in the source key
+	src = aws.S3Object{BucketName: "stori-bucket", Key: "archive/1 a+b.pdf"}
+	a.NoError(src.Copy(context.Background(), mock, aws.S3Object{BucketName: "stori-bucket", Key: "statement+1.pdf"}))
+	a.Equal("one", mock.objects["statement+1.pdf"])
+	a.NoError(aws.S3Object{BucketName: "stori-bucket", Key: "statement+1.pdf"}.Move(
+		context.Background(), mock, aws.S3Object{BucketName: "stori-bucket", Key: "statement 2.pdf"}))
+	a.Equal("one", mock.objects["statement 2.pdf"])
+	a.NotContains(mock.objects, "statement+1.pdf")
+}
+
+func TestDeleteS3Objects(t *testing.T) {
+	a := assert.New(t)
+	mock := newMockS3Client()
+
+	objs := []aws.S3Object{{BucketName: "other-bucket", Key: "locked"}}
+	for i := 0; i < 1001; i++ {
+		objs = append(objs, aws.S3Object{BucketName: "stori-bucket", Key: fmt.Sprintf("key-%d", i)})
+	}
+
+	err := aws.DeleteS3Objects(context.Background(), mock, objs)
+	a.Len(mock.deletes, 3, "should send one request per bucket and 1000 keys")
+	a.Equal("other-bucket", *mock.deletes[0].Bucket)
+	a.Len(mock.deletes[1].Delete.Objects, 1000)
+	a.Len(mock.deletes[2].Delete.Objects, 1)
+
+	var derr *aws.S3DeleteError
+	if a.ErrorAs(err, &derr) && a.Len(derr.Failures, 1) {
+		f := derr.Failures[0]
+		a.Equal(aws.S3DeleteFailure{
+			Object:  aws.S3Object{BucketName: "other-bucket", Key: "locked"},
+			Code:    "AccessDenied",
+			Message: "Access Denied",
+			Err:     f.Err,
+		}, f)
+	}
+	a.ErrorIs(err, aws.ErrAccessDenied, "the failures should be classified")
+}
+
+func TestDeleteS3ObjectsVersions(t *testing.T) {
+	a := assert.New(t)
+	mock := newMockS3Client()
+
+	obj := aws.S3Object{BucketName: "stori-bucket", Key: "locked", VersionID: "v1"}
+	objs := []aws.S3Object{obj, {BucketName: "stori-bucket", Key: "latest"}}
+
+	err := aws.DeleteS3Objects(context.Background(), mock, objs)
+	if a.Len(mock.deletes, 1) {
+		ids := mock.deletes[0].Delete.Objects
+		a.Equal("v1", awssdk.StringValue(ids[0].VersionId), "the version should be deleted")
+		a.Nil(ids[1].VersionId, "objects without a version should delete the latest one")
+	}
+
+	var derr *aws.S3DeleteError
+	if a.ErrorAs(err, &derr) && a.Len(derr.Failures, 1) {
+		a.Equal(obj, derr.Failures[0].Object)
+	}
+
+	mock.deleteErr = awserr.New("AccessDenied", "Access Denied", nil)
+	err = aws.DeleteS3Objects(context.Background(), mock, objs[:1])
+	if a.ErrorAs(err, &derr) && a.Len(derr.Failures, 1) {
+		a.Equal(obj, derr.Failures[0].Object, "failed requests should keep the version")
+	}
+}
+
+func TestPresign(t *testing.T) {
+	a := assert.New(t)
+	sess := session.Must(session.NewSession(&awssdk.Config{
+		Region:      awssdk.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	client := s3.New(sess)
+	obj := aws.S3Object{BucketName: "stori-bucket", Key: "statements/1.pdf"}
+
+	get, err := obj.PresignGet(client, 15*time.Minute)
+	a.NoError(err)
+	u, _ := url.Parse(get)
+	a.Equal("/statements/1.pdf", u.Path)
+	a.Equal("900", u.Query().Get("X-Amz-Expires"))
+	a.NotEmpty(u.Query().Get("X-Amz-Signature"))
+
+	put, err := obj.PresignPut(client, time.Hour, "application/pdf")
+	a.NoError(err)
+	u, _ = url.Parse(put)
+	a.Equal("3600", u.Query().Get("X-Amz-Expires"))
+	a.Contains(u.Query().Get("X-Amz-SignedHeaders"), "content-type")
+
+	_, err = obj.PresignGet(client, 8*24*time.Hour)
+	a.ErrorIs(err, aws.ErrInvalidPresignExpiry)
+}
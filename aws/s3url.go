@@ -0,0 +1,233 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidS3URL = errors.New("invalid s3 url")
+
+// s3Endpoint matches the S3 part of a hostname, such as s3, s3.us-west-2, s3-us-west-2,
+// s3.dualstack.us-west-2 or s3-fips.us-east-1, capturing the region.
+const s3Endpoint = `s3(?:-fips)?(?:[.-]dualstack)?(?:[.-]([a-z0-9-]+))?\.amazonaws\.com(?:\.cn)?`
+
+var (
+	pathStyleHost     = regexp.MustCompile(`^` + s3Endpoint + `$`)
+	virtualHostedHost = regexp.MustCompile(`^(.+)\.` + s3Endpoint + `$`)
+	accessPointHost   = regexp.MustCompile(`^([a-z0-9-]+)-(\d{12})\.s3-accesspoint(?:\.dualstack)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+	accessPointARN    = regexp.MustCompile(`^arn:(aws[a-z-]*):s3:([a-z0-9-]+):(\d{12}):accesspoint[/:]([a-z0-9-]+)$`)
+	// accessPointObject splits an access point ARN followed by an optional key. The key is
+	// preceded by /object/ in ARNs and by a single / in s3:// URLs.
+	accessPointObject = regexp.MustCompile(`^(arn:aws[a-z-]*:s3:[a-z0-9-]+:\d{12}:accesspoint[/:][a-z0-9-]+)(?:/(?:object/)?(.*))?$`)
+)
+
+// ParseS3URL parses an S3 url and returns the bucket name, path to the object, region, version
+// and the url in an S3Object struct. The following types of S3 urls can be parsed:
+// - s3://[bucket_name]/[path_to_object]
+// - https://s3.amazonaws.com/[bucket_name]/[path_to_object]
+// - https://s3.[region].amazonaws.com/[bucket_name]/[path_to_object]
+// - https://[bucket_name].s3.amazonaws.com/[path_to_object]
+// - https://[bucket_name].s3.[region].amazonaws.com/[path_to_object]
+// - https://[access_point]-[account_id].s3-accesspoint.[region].amazonaws.com/[path_to_object]
+// - arn:aws:s3:[region]:[account_id]:accesspoint/[access_point]/object/[path_to_object]
+//
+// Legacy s3-[region] and dualstack endpoints are accepted too. For https urls the key is
+// unescaped and the versionId query parameter is used as the VersionID. The key of s3:// urls is
+// used as is. For access points the BucketName is the access point ARN, which the SDK accepts in
+// place of a bucket name. If the url doesn't match any of these patterns an error wrapping
+// ErrInvalidS3URL is returned.
+func ParseS3URL(s3URL string) (S3Object, error) {
+	var (
+		obj S3Object
+		err error
+	)
+
+	switch {
+	case strings.HasPrefix(s3URL, "arn:"):
+		obj, err = parseAccessPointObject(s3URL)
+	case strings.HasPrefix(s3URL, "s3://"):
+		obj, err = parseS3URI(strings.TrimPrefix(s3URL, "s3://"))
+	default:
+		obj, err = parseHTTPSURL(s3URL)
+	}
+	if err != nil {
+		return S3Object{}, err
+	}
+
+	if obj.BucketName == "" {
+		return S3Object{}, fmt.Errorf("%w: missing bucket name", ErrInvalidS3URL)
+	}
+	obj.Url = s3URL
+
+	return obj, nil
+}
+
+// parseS3URI parses the part of an s3:// url after the scheme
+func parseS3URI(s string) (S3Object, error) {
+	if strings.HasPrefix(s, "arn:") {
+		return parseAccessPointObject(s)
+	}
+
+	i := strings.Index(s, "/")
+	if i < 0 {
+		return S3Object{BucketName: s}, nil
+	}
+
+	return S3Object{BucketName: s[:i], Key: s[i+1:]}, nil
+}
+
+// parseAccessPointObject parses an access point ARN optionally followed by a key
+func parseAccessPointObject(s string) (S3Object, error) {
+	m := accessPointObject.FindStringSubmatch(s)
+	if m == nil {
+		return S3Object{}, fmt.Errorf("%w: invalid access point arn", ErrInvalidS3URL)
+	}
+
+	obj := S3Object{BucketName: m[1], Key: m[2]}
+	_, obj.Region, _, _, _ = parseAccessPointARN(m[1])
+
+	return obj, nil
+}
+
+// parseHTTPSURL parses virtual-hosted, path-style and access point https urls
+func parseHTTPSURL(s string) (S3Object, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return S3Object{}, fmt.Errorf("%w: couldn't parse the url", ErrInvalidS3URL)
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return S3Object{}, fmt.Errorf("%w: invalid protocol", ErrInvalidS3URL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	path := strings.TrimPrefix(u.Path, "/")
+	obj := S3Object{VersionID: u.Query().Get("versionId")}
+
+	if m := accessPointHost.FindStringSubmatch(host); m != nil {
+		partition := "aws"
+		if m[4] != "" {
+			partition = "aws-cn"
+		}
+		obj.BucketName = fmt.Sprintf("arn:%s:s3:%s:%s:accesspoint/%s", partition, m[3], m[2], m[1])
+		obj.Region = m[3]
+		obj.Key = path
+		return obj, nil
+	}
+
+	if m := pathStyleHost.FindStringSubmatch(host); m != nil {
+		obj.Region = endpointRegion(m[1])
+		parts := strings.SplitN(path, "/", 2)
+		obj.BucketName = parts[0]
+		if len(parts) == 2 {
+			obj.Key = parts[1]
+		}
+		return obj, nil
+	}
+
+	if m := virtualHostedHost.FindStringSubmatch(host); m != nil {
+		obj.BucketName = m[1]
+		obj.Region = endpointRegion(m[2])
+		obj.Key = path
+		return obj, nil
+	}
+
+	return S3Object{}, fmt.Errorf("%w: %s is not an s3 host", ErrInvalidS3URL, host)
+}
+
+// endpointRegion returns the region of the region part of an S3 hostname
+func endpointRegion(r string) string {
+	if r == "external-1" {
+		return "us-east-1"
+	}
+
+	return r
+}
+
+// parseAccessPointARN returns the components of an access point ARN
+func parseAccessPointARN(arn string) (partition, region, account, name string, ok bool) {
+	m := accessPointARN.FindStringSubmatch(arn)
+	if m == nil {
+		return "", "", "", "", false
+	}
+
+	return m[1], m[2], m[3], m[4], true
+}
+
+// S3URI returns the object as an s3://[bucket_name]/[path_to_object] url, as used by the AWS CLI
+func (s S3Object) S3URI() string {
+	return "s3://" + s.BucketName + "/" + s.Key
+}
+
+// VirtualHostedURL returns the https://[bucket_name].s3.[region].amazonaws.com/[path_to_object]
+// url of the object, or the access point hostname if BucketName is an access point ARN. The
+// global endpoint is used if the Region is unknown.
+func (s S3Object) VirtualHostedURL() string {
+	if host, ok := s.accessPointHost(); ok {
+		return s.httpsURL(host, s.Key)
+	}
+
+	return s.httpsURL(s.BucketName+"."+s3Host(s.Region), s.Key)
+}
+
+// PathStyleURL returns the https://s3.[region].amazonaws.com/[bucket_name]/[path_to_object] url of
+// the object. Access points don't support path-style urls, so the VirtualHostedURL is returned
+// for them.
+func (s S3Object) PathStyleURL() string {
+	if host, ok := s.accessPointHost(); ok {
+		return s.httpsURL(host, s.Key)
+	}
+
+	return s.httpsURL(s3Host(s.Region), s.BucketName+"/"+s.Key)
+}
+
+// accessPointHost returns the hostname of the access point if BucketName is an access point ARN
+func (s S3Object) accessPointHost() (string, bool) {
+	partition, region, account, name, ok := parseAccessPointARN(s.BucketName)
+	if !ok {
+		return "", false
+	}
+
+	host := fmt.Sprintf("%s-%s.s3-accesspoint.%s.amazonaws.com", name, account, region)
+	if partition == "aws-cn" {
+		host += ".cn"
+	}
+
+	return host, true
+}
+
+// httpsURL returns an https url with `path` escaped and the version id in the query string
+func (s S3Object) httpsURL(host, path string) string {
+	u := "https://" + host + "/" + escapeS3Path(path)
+	if s.VersionID != "" {
+		u += "?versionId=" + url.QueryEscape(s.VersionID)
+	}
+
+	return u
+}
+
+// escapeS3Path escapes each segment of `path`. S3 decodes + as a space in some contexts, like
+// the x-amz-copy-source header, so it is always escaped.
+func escapeS3Path(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(seg), "+", "%2B")
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// s3Host returns the S3 hostname of the region
+func s3Host(region string) string {
+	switch {
+	case region == "":
+		return "s3.amazonaws.com"
+	case strings.HasPrefix(region, "cn-"):
+		return "s3." + region + ".amazonaws.com.cn"
+	default:
+		return "s3." + region + ".amazonaws.com"
+	}
+}
@@ -0,0 +1,97 @@
+package aws_test
+
+import (
+	"testing"
+
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseS3URLFormats(t *testing.T) {
+	const ap = "arn:aws:s3:us-west-2:123456789012:accesspoint/statements"
+
+	tests := []struct {
+		url  string
+		want aws.S3Object
+	}{
+		{"s3://stori-bucket", aws.S3Object{BucketName: "stori-bucket"}},
+		{"s3://stori-bucket/a b/c%20d.pdf", aws.S3Object{BucketName: "stori-bucket", Key: "a b/c%20d.pdf"}},
+		{"https://s3.amazonaws.com/stori-bucket/key", aws.S3Object{BucketName: "stori-bucket", Key: "key"}},
+		{"https://s3.us-west-2.amazonaws.com/stori-bucket/a/key", aws.S3Object{BucketName: "stori-bucket", Key: "a/key", Region: "us-west-2"}},
+		{"https://s3-us-west-2.amazonaws.com/stori-bucket/key", aws.S3Object{BucketName: "stori-bucket", Key: "key", Region: "us-west-2"}},
+		{"https://s3-external-1.amazonaws.com/stori-bucket/key", aws.S3Object{BucketName: "stori-bucket", Key: "key", Region: "us-east-1"}},
+		{"https://s3.dualstack.us-west-2.amazonaws.com/stori-bucket/key", aws.S3Object{BucketName: "stori-bucket", Key: "key", Region: "us-west-2"}},
+		{"https://s3.amazonaws.com/stori-bucket", aws.S3Object{BucketName: "stori-bucket"}},
+		{"https://stori-bucket.s3.amazonaws.com/key", aws.S3Object{BucketName: "stori-bucket", Key: "key"}},
+		{"https://stori-bucket.s3.amazonaws.com", aws.S3Object{BucketName: "stori-bucket"}},
+		{"https://stori.bucket.s3.us-west-2.amazonaws.com/key", aws.S3Object{BucketName: "stori.bucket", Key: "key", Region: "us-west-2"}},
+		{"https://stori-bucket.s3-us-west-2.amazonaws.com/key", aws.S3Object{BucketName: "stori-bucket", Key: "key", Region: "us-west-2"}},
+		{"https://stori-bucket.s3.dualstack.us-west-2.amazonaws.com/key", aws.S3Object{BucketName: "stori-bucket", Key: "key", Region: "us-west-2"}},
+		{"https://stori-bucket.s3.cn-north-1.amazonaws.com.cn/key", aws.S3Object{BucketName: "stori-bucket", Key: "key", Region: "cn-north-1"}},
+		{
+			"https://stori-bucket.s3.us-west-2.amazonaws.com/a%20b/c%2Bd%3F.pdf?versionId=v1",
+			aws.S3Object{BucketName: "stori-bucket", Key: "a b/c+d?.pdf", Region: "us-west-2", VersionID: "v1"},
+		},
+		{
+			"https://statements-123456789012.s3-accesspoint.us-west-2.amazonaws.com/a/key",
+			aws.S3Object{BucketName: ap, Key: "a/key", Region: "us-west-2"},
+		},
+		{ap + "/object/a/key", aws.S3Object{BucketName: ap, Key: "a/key", Region: "us-west-2"}},
+		{ap, aws.S3Object{BucketName: ap, Region: "us-west-2"}},
+		{"s3://" + ap + "/a/key", aws.S3Object{BucketName: ap, Key: "a/key", Region: "us-west-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := aws.ParseS3URL(tt.url)
+			assert.NoError(t, err)
+
+			tt.want.Url = tt.url
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseS3URLErrors(t *testing.T) {
+	urls := []string{
+		"",
+		"s3://",
+		"https://s3.amazonaws.com",
+		"https://s3.amazonaws.com/",
+		"ftp://stori-bucket.s3.amazonaws.com/key",
+		"https://example.com/key",
+		"https://stori-bucket.s3.amazonaws.com/%zz",
+		"arn:aws:s3:us-west-2:123456789012:bucket/stori",
+	}
+
+	for _, u := range urls {
+		_, err := aws.ParseS3URL(u)
+		assert.ErrorIs(t, err, aws.ErrInvalidS3URL, u)
+	}
+}
+
+func TestS3ObjectURLs(t *testing.T) {
+	a := assert.New(t)
+
+	obj := aws.S3Object{BucketName: "stori-bucket", Key: "a b/c+d.pdf", Region: "us-west-2", VersionID: "v1"}
+	a.Equal("s3://stori-bucket/a b/c+d.pdf", obj.S3URI())
+	a.Equal("https://stori-bucket.s3.us-west-2.amazonaws.com/a%20b/c%2Bd.pdf?versionId=v1", obj.VirtualHostedURL())
+	a.Equal("https://s3.us-west-2.amazonaws.com/stori-bucket/a%20b/c%2Bd.pdf?versionId=v1", obj.PathStyleURL())
+
+	obj = aws.S3Object{BucketName: "stori-bucket", Key: "key"}
+	a.Equal("https://stori-bucket.s3.amazonaws.com/key", obj.VirtualHostedURL())
+	a.Equal("https://s3.amazonaws.com/stori-bucket/key", obj.PathStyleURL())
+
+	obj = aws.S3Object{BucketName: "arn:aws:s3:us-west-2:123456789012:accesspoint/statements", Key: "key"}
+	a.Equal("https://statements-123456789012.s3-accesspoint.us-west-2.amazonaws.com/key", obj.VirtualHostedURL())
+	a.Equal(obj.VirtualHostedURL(), obj.PathStyleURL())
+
+	// rendered urls parse back into the same object
+	obj = aws.S3Object{BucketName: "stori-bucket", Key: "a b/c+d.pdf", Region: "us-west-2", VersionID: "v1"}
+	for _, u := range []string{obj.VirtualHostedURL(), obj.PathStyleURL()} {
+		parsed, err := aws.ParseS3URL(u)
+		a.NoError(err)
+		parsed.Url = ""
+		a.Equal(obj, parsed)
+	}
+}
@@ -0,0 +1,328 @@
+// Package sdkv2 implements the awsclient interfaces with AWS SDK v2. It doesn't import SDK v1, so
+// services that only use it and awsclient don't link v1.
+package sdkv2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	lambdav2 "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	secretsmanagerv2 "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	snsv2 "github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
+)
+
+// SDK v2 clients don't have interfaces, so these are the methods used by the implementations.
+// They are satisfied by the clients of the SDK and by mocks in tests.
+type (
+	SecretsManagerAPI interface {
+		GetSecretValue(ctx context.Context, in *secretsmanagerv2.GetSecretValueInput, opts ...func(*secretsmanagerv2.Options)) (*secretsmanagerv2.GetSecretValueOutput, error)
+	}
+
+	LambdaAPI interface {
+		Invoke(ctx context.Context, in *lambdav2.InvokeInput, opts ...func(*lambdav2.Options)) (*lambdav2.InvokeOutput, error)
+	}
+
+	SNSAPI interface {
+		Publish(ctx context.Context, in *snsv2.PublishInput, opts ...func(*snsv2.Options)) (*snsv2.PublishOutput, error)
+		PublishBatch(ctx context.Context, in *snsv2.PublishBatchInput, opts ...func(*snsv2.Options)) (*snsv2.PublishBatchOutput, error)
+	}
+
+	S3UploaderAPI interface {
+		Upload(ctx context.Context, in *s3v2.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+	}
+
+	S3DownloaderAPI interface {
+		Download(ctx context.Context, w io.WriterAt, in *s3v2.GetObjectInput, opts ...func(*manager.Downloader)) (int64, error)
+	}
+)
+
+// NewClients returns the SDK v2 implementations, created with the config of `c`
+func NewClients(ctx context.Context, c awsclient.Config) (awsclient.Clients, error) {
+	cfg, err := NewConfig(ctx, c)
+	if err != nil {
+		return awsclient.Clients{}, err
+	}
+
+	s3c := s3v2.NewFromConfig(cfg, func(o *s3v2.Options) {
+		o.UsePathStyle = c.S3ForcePathStyle
+	})
+
+	return awsclient.Clients{
+		Secrets: NewSecretGetter(secretsmanagerv2.NewFromConfig(cfg)),
+		Lambda:  NewLambdaInvoker(lambdav2.NewFromConfig(cfg)),
+		S3:      NewObjectStore(manager.NewUploader(s3c), manager.NewDownloader(s3c)),
+		SNS:     NewPublisher(snsv2.NewFromConfig(cfg)),
+	}, nil
+}
+
+// NewSecretGetter returns an awsclient.SecretGetter that uses an SDK v2 client
+func NewSecretGetter(sma SecretsManagerAPI) awsclient.SecretGetter {
+	return secretGetter{sma}
+}
+
+type secretGetter struct {
+	sma SecretsManagerAPI
+}
+
+func (s secretGetter) GetSecretString(ctx context.Context, id string, stage awsclient.VersionStage) (string, error) {
+	if stage == "" {
+		stage = awsclient.StageCurrent
+	}
+
+	in := &secretsmanagerv2.GetSecretValueInput{
+		SecretId:     awsv2.String(id),
+		VersionStage: awsv2.String(string(stage)),
+	}
+
+	var out *secretsmanagerv2.GetSecretValueOutput
+	err := awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		var err error
+		out, err = s.sma.GetSecretValue(ctx, in, noSecretsRetries)
+		return shared.WrapError("GetSecretValue", err)
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting secret %s: %w", id, err)
+	}
+
+	return awsv2.ToString(out.SecretString), nil
+}
+
+// NewLambdaInvoker returns an awsclient.LambdaInvoker that uses an SDK v2 client
+func NewLambdaInvoker(la LambdaAPI) awsclient.LambdaInvoker {
+	return lambdaInvoker{la}
+}
+
+type lambdaInvoker struct {
+	la LambdaAPI
+}
+
+func (l lambdaInvoker) Invoke(ctx context.Context, li awsclient.LambdaInvocation) (awsclient.LambdaResponse, error) {
+	payload, err := json.Marshal(li.Event)
+	if err != nil {
+		return awsclient.LambdaResponse{}, errors.New("error parsing json from lambda event")
+	}
+
+	clientContext, err := shared.EncodeClientContext(li)
+	if err != nil {
+		return awsclient.LambdaResponse{}, err
+	}
+
+	in := &lambdav2.InvokeInput{
+		FunctionName:   awsv2.String(li.FunctionName),
+		Payload:        payload,
+		InvocationType: lambdatypes.InvocationType(li.InvocationType),
+		Qualifier:      shared.OptionalString(li.Qualifier),
+		ClientContext:  shared.OptionalString(clientContext),
+		LogType:        lambdatypes.LogType(shared.LogType(li)),
+	}
+
+	var out *lambdav2.InvokeOutput
+	err = awsclient.DefaultRetryPolicy.ThrottleOnly().Do(ctx, func() error {
+		out, err = l.la.Invoke(ctx, in, noLambdaRetries)
+		return shared.WrapError("Invoke", err)
+	})
+	if err != nil {
+		return awsclient.LambdaResponse{}, fmt.Errorf("error invoking %s: %w", li.FunctionName, err)
+	}
+
+	return awsclient.LambdaResponse{
+		StatusCode:      int(out.StatusCode),
+		Payload:         out.Payload,
+		FunctionError:   awsv2.ToString(out.FunctionError),
+		ExecutedVersion: awsv2.ToString(out.ExecutedVersion),
+		Logs:            shared.DecodeLogs(awsv2.ToString(out.LogResult)),
+	}, nil
+}
+
+// NewObjectStore returns an awsclient.ObjectStore that uses the SDK v2 transfer managers
+func NewObjectStore(u S3UploaderAPI, d S3DownloaderAPI) awsclient.ObjectStore {
+	return objectStore{u, d}
+}
+
+type objectStore struct {
+	u S3UploaderAPI
+	d S3DownloaderAPI
+}
+
+func (o objectStore) Upload(ctx context.Context, s awsclient.S3Object, r io.Reader, opts awsclient.S3UploadOptions) (awsclient.S3UploadResult, error) {
+	var out *manager.UploadOutput
+	err := shared.RetryUpload(ctx, r, opts.Progress, func(body io.Reader, sdkRetries bool) error {
+		var err error
+		out, err = o.u.Upload(ctx, putObjectInput(s, body, opts), func(up *manager.Uploader) {
+			if opts.PartSize > 0 {
+				up.PartSize = opts.PartSize
+			}
+			if !sdkRetries {
+				up.ClientOptions = append(up.ClientOptions, noS3Retries)
+			}
+		})
+		return shared.WrapError("Upload", err)
+	})
+	if err != nil {
+		return awsclient.S3UploadResult{}, fmt.Errorf("error in uploading file: %w", err)
+	}
+
+	return awsclient.S3UploadResult{
+		Location:  out.Location,
+		VersionID: awsv2.ToString(out.VersionID),
+		ETag:      awsv2.ToString(out.ETag),
+	}, nil
+}
+
+// Download retries throttled and transient failures like aws.S3Object.DownloadWriter. Every
+// attempt writes the object from its first byte, and Progress starts over.
+func (o objectStore) Download(ctx context.Context, s awsclient.S3Object, w io.WriterAt, opts awsclient.S3DownloadOptions) (int64, error) {
+	in := &s3v2.GetObjectInput{
+		Bucket:    awsv2.String(s.BucketName),
+		Key:       awsv2.String(s.Key),
+		VersionId: shared.OptionalString(s.VersionID),
+	}
+
+	return shared.RetryDownload(ctx, w, opts, func(target io.WriterAt, sequential bool) (int64, error) {
+		n, err := o.d.Download(ctx, target, in, func(dl *manager.Downloader) {
+			// hashing needs the parts in order
+			if sequential {
+				dl.Concurrency = 1
+			}
+			dl.ClientOptions = append(dl.ClientOptions, noS3Retries)
+		})
+		return n, shared.WrapError("Download", err)
+	})
+}
+
+// putObjectInput builds the input to upload `body` to the object
+func putObjectInput(s awsclient.S3Object, body io.Reader, opts awsclient.S3UploadOptions) *s3v2.PutObjectInput {
+	in := &s3v2.PutObjectInput{
+		Bucket:       awsv2.String(s.BucketName),
+		Key:          awsv2.String(s.Key),
+		Body:         body,
+		ContentType:  shared.OptionalString(opts.ContentType),
+		StorageClass: s3types.StorageClass(opts.StorageClass),
+		Tagging:      shared.OptionalString(shared.EncodeTags(opts.Tags)),
+	}
+
+	if len(opts.Metadata) > 0 {
+		in.Metadata = opts.Metadata
+	}
+
+	if opts.KMSKeyID != "" {
+		in.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		in.SSEKMSKeyId = awsv2.String(opts.KMSKeyID)
+	}
+
+	if opts.Checksum {
+		in.ChecksumAlgorithm = s3types.ChecksumAlgorithmSha256
+	}
+
+	return in
+}
+
+// NewPublisher returns an awsclient.Publisher that uses an SDK v2 client
+func NewPublisher(sa SNSAPI) awsclient.Publisher {
+	return publisher{sa}
+}
+
+type publisher struct {
+	sa SNSAPI
+}
+
+func (p publisher) Publish(ctx context.Context, m awsclient.SNSMessage) (string, error) {
+	e, err := shared.NewSNSEntry(m)
+	if err != nil {
+		return "", err
+	}
+
+	in := &snsv2.PublishInput{
+		TopicArn:               awsv2.String(m.TopicARN),
+		Message:                awsv2.String(e.Body),
+		MessageAttributes:      snsAttributes(e.Attrs),
+		Subject:                shared.OptionalString(e.Subject),
+		MessageGroupId:         shared.OptionalString(e.GroupID),
+		MessageDeduplicationId: shared.OptionalString(e.DeduplicationID),
+	}
+
+	var out *snsv2.PublishOutput
+	err = awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		out, err = p.sa.Publish(ctx, in, noSNSRetries)
+		return shared.WrapError("Publish", err)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return awsv2.ToString(out.MessageId), nil
+}
+
+func (p publisher) PublishBatch(ctx context.Context, topicARN string, msgs []awsclient.SNSMessage) ([]string, error) {
+	return shared.PublishSNSBatch(ctx, topicARN, msgs, func(ctx context.Context, entries []shared.SNSEntry) (shared.BatchResult, error) {
+		in := &snsv2.PublishBatchInput{TopicArn: awsv2.String(topicARN)}
+		for _, e := range entries {
+			in.PublishBatchRequestEntries = append(in.PublishBatchRequestEntries, snstypes.PublishBatchRequestEntry{
+				Id:                     awsv2.String(e.ID),
+				Message:                awsv2.String(e.Body),
+				MessageAttributes:      snsAttributes(e.Attrs),
+				Subject:                shared.OptionalString(e.Subject),
+				MessageGroupId:         shared.OptionalString(e.GroupID),
+				MessageDeduplicationId: shared.OptionalString(e.DeduplicationID),
+			})
+		}
+
+		out, err := p.sa.PublishBatch(ctx, in, noSNSRetries)
+		if err != nil {
+			return shared.BatchResult{}, shared.WrapError("PublishBatch", err)
+		}
+
+		var r shared.BatchResult
+		for _, s := range out.Successful {
+			r.IDs = append(r.IDs, [2]string{awsv2.ToString(s.Id), awsv2.ToString(s.MessageId)})
+		}
+		for _, f := range out.Failed {
+			i, _ := strconv.Atoi(awsv2.ToString(f.Id))
+			r.Failures = append(r.Failures, shared.BatchFailure{
+				Index:       i,
+				Code:        awsv2.ToString(f.Code),
+				Message:     awsv2.ToString(f.Message),
+				SenderFault: f.SenderFault,
+			})
+		}
+
+		return r, nil
+	})
+}
+
+// snsAttributes converts message attributes into SDK v2 SNS message attributes
+func snsAttributes(ma map[string]shared.MessageAttribute) map[string]snstypes.MessageAttributeValue {
+	if ma == nil {
+		return nil
+	}
+
+	out := make(map[string]snstypes.MessageAttributeValue, len(ma))
+	for k, a := range ma {
+		out[k] = snstypes.MessageAttributeValue{DataType: awsv2.String(a.DataType), StringValue: awsv2.String(a.Value)}
+	}
+
+	return out
+}
+
+// The options below disable the retries of the SDK for the calls retried with
+// awsclient.DefaultRetryPolicy, so the retries of both layers don't multiply
+
+func noSecretsRetries(o *secretsmanagerv2.Options) { o.Retryer = awsv2.NopRetryer{} }
+
+func noLambdaRetries(o *lambdav2.Options) { o.Retryer = awsv2.NopRetryer{} }
+
+func noS3Retries(o *s3v2.Options) { o.Retryer = awsv2.NopRetryer{} }
+
+func noSNSRetries(o *snsv2.Options) { o.Retryer = awsv2.NopRetryer{} }
@@ -0,0 +1,233 @@
+package sdkv2_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	lambdav2 "github.com/aws/aws-sdk-go-v2/service/lambda"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	secretsmanagerv2 "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	snsv2 "github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/smithy-go"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/sdkv2"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSecretsV2 struct {
+	calls int
+	err   error
+}
+
+func (m *mockSecretsV2) GetSecretValue(_ context.Context, in *secretsmanagerv2.GetSecretValueInput, _ ...func(*secretsmanagerv2.Options)) (*secretsmanagerv2.GetSecretValueOutput, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &secretsmanagerv2.GetSecretValueOutput{SecretString: awsv2.String(*in.SecretId + ":" + *in.VersionStage)}, nil
+}
+
+type mockLambdaV2 struct {
+	in   *lambdav2.InvokeInput
+	opts lambdav2.Options
+}
+
+func (m *mockLambdaV2) Invoke(_ context.Context, in *lambdav2.InvokeInput, optFns ...func(*lambdav2.Options)) (*lambdav2.InvokeOutput, error) {
+	m.in = in
+	for _, f := range optFns {
+		f(&m.opts)
+	}
+	return &lambdav2.InvokeOutput{StatusCode: 200, Payload: []byte(`"ok"`), ExecutedVersion: awsv2.String("$LATEST")}, nil
+}
+
+type mockUploaderV2 struct {
+	in   *s3v2.PutObjectInput
+	body []byte
+}
+
+func (m *mockUploaderV2) Upload(_ context.Context, in *s3v2.PutObjectInput, _ ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	m.in = in
+	m.body, _ = ioutil.ReadAll(in.Body)
+	return &manager.UploadOutput{Location: "location", VersionID: awsv2.String("v1")}, nil
+}
+
+type mockDownloaderV2 struct {
+	content     []byte
+	concurrency int
+	calls       int
+	// fail is the number of calls that write part of the content and fail
+	fail int
+}
+
+func (m *mockDownloaderV2) Download(_ context.Context, w io.WriterAt, _ *s3v2.GetObjectInput, opts ...func(*manager.Downloader)) (int64, error) {
+	d := &manager.Downloader{}
+	for _, o := range opts {
+		o(d)
+	}
+	m.concurrency = d.Concurrency
+
+	m.calls++
+	if m.calls <= m.fail {
+		_, _ = w.WriteAt(m.content[:1], 0)
+		return 0, &smithy.GenericAPIError{Code: "InternalError", Message: "try again"}
+	}
+
+	n, err := w.WriteAt(m.content, 0)
+	return int64(n), err
+}
+
+type mockSNSV2 struct {
+	publish []*snsv2.PublishInput
+	batches []*snsv2.PublishBatchInput
+	err     error
+}
+
+func (m *mockSNSV2) Publish(_ context.Context, in *snsv2.PublishInput, _ ...func(*snsv2.Options)) (*snsv2.PublishOutput, error) {
+	m.publish = append(m.publish, in)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &snsv2.PublishOutput{MessageId: awsv2.String("message-id")}, nil
+}
+
+func (m *mockSNSV2) PublishBatch(_ context.Context, in *snsv2.PublishBatchInput, _ ...func(*snsv2.Options)) (*snsv2.PublishBatchOutput, error) {
+	m.batches = append(m.batches, in)
+
+	out := &snsv2.PublishBatchOutput{}
+	for _, e := range in.PublishBatchRequestEntries {
+		if *e.Message == `"fail"` {
+			out.Failed = append(out.Failed, snstypes.BatchResultErrorEntry{Id: e.Id, Code: awsv2.String("InternalError"), Message: awsv2.String("boom")})
+			continue
+		}
+		out.Successful = append(out.Successful, snstypes.PublishBatchResultEntry{Id: e.Id, MessageId: awsv2.String("id-" + *e.Id)})
+	}
+
+	return out, nil
+}
+
+func TestSecretGetterV2(t *testing.T) {
+	a := assert.New(t)
+	mock := &mockSecretsV2{}
+	cache := awsclient.NewSecretCache(sdkv2.NewSecretGetter(mock), time.Minute)
+
+	v, err := cache.Get(context.Background(), "db")
+	a.NoError(err)
+	a.Equal("db:AWSCURRENT", v)
+
+	_, _ = cache.Get(context.Background(), "db")
+	a.Equal(1, mock.calls, "values should be cached")
+
+	mock.err = &smithy.GenericAPIError{Code: "ResourceNotFoundException", Message: "not found"}
+	_, err = sdkv2.NewSecretGetter(mock).GetSecretString(context.Background(), "missing", awsclient.StagePrevious)
+	a.ErrorIs(err, awsclient.ErrNotFound)
+}
+
+func TestLambdaInvoker(t *testing.T) {
+	a := assert.New(t)
+	li := awsclient.LambdaInvocation{FunctionName: "stori-fn", Event: map[string]int{"id": 1}, InvocationType: "Event"}
+	want := awsclient.LambdaResponse{StatusCode: 200, Payload: []byte(`"ok"`), ExecutedVersion: "$LATEST"}
+
+	v2 := &mockLambdaV2{}
+	res, err := sdkv2.NewLambdaInvoker(v2).Invoke(context.Background(), li)
+	a.NoError(err)
+	a.Equal(want, res)
+	a.Equal("stori-fn", *v2.in.FunctionName)
+	a.Equal("Event", string(v2.in.InvocationType))
+	a.JSONEq(`{"id":1}`, string(v2.in.Payload))
+	a.IsType(awsv2.NopRetryer{}, v2.opts.Retryer, "the SDK should not retry on top of the retry policy")
+}
+
+func TestObjectStoreV2(t *testing.T) {
+	a := assert.New(t)
+	obj := awsclient.S3Object{BucketName: "stori-bucket", Key: "statements/1.pdf"}
+	content := []byte("statement")
+	u := &mockUploaderV2{}
+	d := &mockDownloaderV2{content: content}
+	store := sdkv2.NewObjectStore(u, d)
+
+	res, err := store.Upload(context.Background(), obj, strings.NewReader("statement"), awsclient.S3UploadOptions{
+		ContentType: "application/pdf",
+		KMSKeyID:    "alias/statements",
+		Tags:        map[string]string{"type": "statement"},
+		Checksum:    true,
+	})
+	a.NoError(err)
+	a.Equal(awsclient.S3UploadResult{Location: "location", VersionID: "v1"}, res)
+	a.Equal(content, u.body)
+	a.Equal("application/pdf", *u.in.ContentType)
+	a.Equal("aws:kms", string(u.in.ServerSideEncryption))
+	a.Equal("type=statement", *u.in.Tagging)
+	a.Equal("SHA256", string(u.in.ChecksumAlgorithm))
+
+	sum := sha256.Sum256(content)
+	buf := manager.NewWriteAtBuffer(nil)
+	n, err := store.Download(context.Background(), obj, buf, awsclient.S3DownloadOptions{ExpectedSHA256: hex.EncodeToString(sum[:])})
+	a.NoError(err)
+	a.Equal(int64(len(content)), n)
+	a.Equal(content, buf.Bytes())
+	a.Equal(1, d.concurrency)
+
+	_, err = store.Download(context.Background(), obj, manager.NewWriteAtBuffer(nil), awsclient.S3DownloadOptions{ExpectedSHA256: "00"})
+	a.ErrorIs(err, awsclient.ErrChecksumMismatch)
+
+	// transient failures are retried, and the retry overwrites the partial content
+	d = &mockDownloaderV2{content: content, fail: 1}
+	buf = manager.NewWriteAtBuffer(nil)
+	n, err = sdkv2.NewObjectStore(u, d).Download(context.Background(), obj, buf, awsclient.S3DownloadOptions{ExpectedSHA256: hex.EncodeToString(sum[:])})
+	a.NoError(err)
+	a.Equal(int64(len(content)), n)
+	a.Equal(content, buf.Bytes())
+	a.Equal(2, d.calls)
+}
+
+func TestPublisherV2(t *testing.T) {
+	a := assert.New(t)
+	mock := &mockSNSV2{}
+	p := sdkv2.NewPublisher(mock)
+
+	id, err := p.Publish(context.Background(), awsclient.SNSMessage{
+		TopicARN:   "arn:aws:sns:us-east-1:123456789012:stori",
+		Message:    map[string]string{"id": "1"},
+		Attributes: map[string]interface{}{"type": "payment", "amount": 10},
+	})
+	a.NoError(err)
+	a.Equal("message-id", id)
+	a.Equal(`{"id":"1"}`, *mock.publish[0].Message)
+	a.Equal("Number", *mock.publish[0].MessageAttributes["amount"].DataType)
+
+	msgs := make([]awsclient.SNSMessage, 12)
+	for i := range msgs {
+		msgs[i] = awsclient.SNSMessage{Message: fmt.Sprint(i)}
+	}
+	msgs[11].Message = "fail"
+
+	ids, err := p.PublishBatch(context.Background(), "arn:aws:sns:us-east-1:123456789012:stori", msgs)
+	a.Len(mock.batches, 2)
+	a.Equal("id-0", ids[0])
+	a.Equal("id-10", ids[10])
+	a.Empty(ids[11])
+
+	var berr *awsclient.SNSBatchError
+	if a.ErrorAs(err, &berr) {
+		a.Len(berr.Failures, 1)
+		a.Equal("InternalError", berr.Failures[0].Code)
+		a.ErrorIs(berr, awsclient.ErrTransient)
+	}
+
+	mock.err = &smithy.GenericAPIError{Code: "Throttling", Message: "slow down"}
+	_, err = p.Publish(context.Background(), awsclient.SNSMessage{Message: "retry"})
+	a.ErrorIs(err, awsclient.ErrThrottled)
+	a.Len(mock.publish, 1+awsclient.DefaultRetryPolicy.MaxAttempts, "throttled requests should be retried")
+}
@@ -0,0 +1,64 @@
+package sdkv2
+
+import (
+	"context"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
+)
+
+// serviceIDs maps the SDK v2 service ids to the services of awsclient.Config
+var serviceIDs = map[string]awsclient.Service{
+	"S3":              awsclient.ServiceS3,
+	"SNS":             awsclient.ServiceSNS,
+	"SQS":             awsclient.ServiceSQS,
+	"Lambda":          awsclient.ServiceLambda,
+	"Secrets Manager": awsclient.ServiceSecretsManager,
+	"STS":             awsclient.ServiceSTS,
+}
+
+// NewConfig returns an SDK v2 config that uses the settings of `c`
+func NewConfig(ctx context.Context, c awsclient.Config) (awsv2.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithEndpointResolver(endpointResolver(c)),
+	}
+	if c.Region != "" {
+		opts = append(opts, config.WithRegion(c.Region))
+	}
+	if c.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(c.Profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return awsv2.Config{}, err
+	}
+
+	if c.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), c.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if c.RoleSessionName != "" {
+				o.RoleSessionName = c.RoleSessionName
+			}
+			o.ExternalID = shared.OptionalString(c.ExternalID)
+		})
+		cfg.Credentials = awsv2.NewCredentialsCache(provider)
+	}
+
+	return cfg, nil
+}
+
+// endpointResolver resolves the endpoint overrides of `c`
+func endpointResolver(c awsclient.Config) awsv2.EndpointResolverFunc {
+	return func(service, region string) (awsv2.Endpoint, error) {
+		if url := c.EndpointFor(serviceIDs[service]); url != "" {
+			return awsv2.Endpoint{URL: url, SigningRegion: region, HostnameImmutable: service == "S3" && c.S3ForcePathStyle}, nil
+		}
+
+		// fall back to the default endpoint of the service
+		return awsv2.Endpoint{}, &awsv2.EndpointNotFoundError{}
+	}
+}
@@ -0,0 +1,74 @@
+package aws
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+)
+
+// VersionStage is the staging label of a secret version
+type VersionStage = awsclient.VersionStage
+
+const (
+	StageCurrent  = awsclient.StageCurrent
+	StagePrevious = awsclient.StagePrevious
+	StagePending  = awsclient.StagePending
+)
+
+// DefaultSecretTTL is how long GetSecret and GetSecretJSON cache a secret value
+const DefaultSecretTTL = awsclient.DefaultSecretTTL
+
+// SecretCache caches secret values from AWS Secrets Manager for a TTL. It is safe for concurrent
+// use.
+type SecretCache = awsclient.SecretCache
+
+var (
+	defaultCache   *SecretCache
+	defaultCacheMu sync.Mutex
+)
+
+// defaultSecretCache returns the cache used by GetSecret and GetSecretJSON. Only a created cache is
+// kept, so if the client can't be created, like before the credentials are available, the next
+// call tries again.
+func defaultSecretCache() (*SecretCache, error) {
+	defaultCacheMu.Lock()
+	defer defaultCacheMu.Unlock()
+
+	if defaultCache != nil {
+		return defaultCache, nil
+	}
+
+	sma, err := LoadConfig().SecretsManager()
+	if err != nil {
+		return nil, err
+	}
+	defaultCache = NewSecretCache(sma, DefaultSecretTTL)
+
+	return defaultCache, nil
+}
+
+// GetSecretJSON unmarshals the AWSCURRENT version of the secret `id` into `dst`. Values are cached
+// for DefaultSecretTTL.
+func GetSecretJSON(id string, dst interface{}) error {
+	c, err := defaultSecretCache()
+	if err != nil {
+		return err
+	}
+
+	return c.GetJSON(context.Background(), id, dst)
+}
+
+// NewSecretCache creates a SecretCache that keeps values for `ttl`. A ttl of 0 or less uses
+// DefaultSecretTTL.
+func NewSecretCache(sma secretsmanageriface.SecretsManagerAPI, ttl time.Duration) *SecretCache {
+	return NewSecretCacheFrom(NewSecretGetterV1(sma), ttl)
+}
+
+// NewSecretCacheFrom creates a SecretCache that gets values from `secrets`, such as the SDK v2
+// implementation from sdkv2.NewSecretGetter
+func NewSecretCacheFrom(secrets SecretGetter, ttl time.Duration) *SecretCache {
+	return awsclient.NewSecretCache(secrets, ttl)
+}
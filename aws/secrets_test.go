@@ -0,0 +1,144 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// Secrets Manager client returning values by version stage, and counting calls
+type mockSecretsClient struct {
+	secretsmanageriface.SecretsManagerAPI
+	mu     sync.Mutex
+	values map[string]string
+	calls  int
+	err    error
+}
+
+func (m *mockSecretsClient) GetSecretValueWithContext(_ context.Context, in *secretsmanager.GetSecretValueInput, _ ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	v, ok := m.values[*in.VersionStage]
+	if !ok {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+
+	return &secretsmanager.GetSecretValueOutput{SecretString: awssdk.String(v)}, nil
+}
+
+func (m *mockSecretsClient) set(stage, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[stage] = value
+}
+
+func TestSecretCache(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mock := &mockSecretsClient{values: map[string]string{
+		"AWSCURRENT":  `{"username":"current"}`,
+		"AWSPREVIOUS": `{"username":"previous"}`,
+	}}
+
+	c := aws.NewSecretCache(mock, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		v, err := c.Get(ctx, "db")
+		a.NoError(err)
+		a.Equal(`{"username":"current"}`, v)
+	}
+	a.Equal(1, mock.calls, "cached secrets should not be fetched again")
+
+	v, err := c.GetVersion(ctx, "db", aws.StagePrevious)
+	a.NoError(err)
+	a.Equal(`{"username":"previous"}`, v)
+
+	var dst struct {
+		UserName string `json:"username"`
+	}
+	a.NoError(c.GetJSON(ctx, "db", &dst))
+	a.Equal("current", dst.UserName)
+
+	_, err = c.GetVersion(ctx, "db", aws.StagePending)
+	a.Error(err)
+
+	mock.set("AWSCURRENT", "rotated")
+	c.Invalidate("db")
+	v, _ = c.Get(ctx, "db")
+	a.Equal("rotated", v, "invalidated secrets should be fetched again")
+}
+
+func TestSecretCacheExpiry(t *testing.T) {
+	a := assert.New(t)
+	mock := &mockSecretsClient{values: map[string]string{"AWSCURRENT": "v1"}}
+	c := aws.NewSecretCache(mock, time.Millisecond)
+
+	_, _ = c.Get(context.Background(), "db")
+	time.Sleep(2 * time.Millisecond)
+	_, _ = c.Get(context.Background(), "db")
+	a.Equal(2, mock.calls, "expired secrets should be fetched again")
+
+	mock.set("AWSCURRENT", "v2")
+	c = aws.NewSecretCache(mock, time.Hour)
+	_, _ = c.Get(context.Background(), "db")
+	mock.set("AWSCURRENT", "v3")
+
+	stop := c.StartRefresh(time.Millisecond)
+	defer stop()
+	a.Eventually(func() bool {
+		v, _ := c.Get(context.Background(), "db")
+		return v == "v3"
+	}, time.Second, time.Millisecond, "background refresh should update cached secrets")
+}
+
+func TestWithSecret(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mock := &mockSecretsClient{values: map[string]string{"AWSCURRENT": "old", "AWSPREVIOUS": "older"}}
+	c := aws.NewSecretCache(mock, time.Hour)
+
+	// cache the current value, then rotate the secret
+	_, _ = c.Get(ctx, "db")
+	mock.set("AWSCURRENT", "new")
+
+	var tried []string
+	err := c.WithSecret(ctx, "db", func(v string) error {
+		tried = append(tried, v)
+		if v != "new" {
+			return errors.New("authentication failed")
+		}
+		return nil
+	})
+	a.NoError(err)
+	a.Equal([]string{"old", "new"}, tried, "a stale cached value should be refreshed")
+
+	// the resource hasn't been updated with the pending rotation yet
+	tried = nil
+	err = c.WithSecret(ctx, "db", func(v string) error {
+		tried = append(tried, v)
+		if v != "older" {
+			return errors.New("authentication failed")
+		}
+		return nil
+	})
+	a.NoError(err)
+	a.Equal([]string{"new", "older"}, tried, "AWSPREVIOUS should be used as a fallback")
+
+	err = c.WithSecret(ctx, "db", func(string) error { return errors.New("authentication failed") })
+	a.EqualError(err, "authentication failed")
+}
@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
+)
+
+// SNSMessage contains the information needed to publish a message to an SNS topic. It is the
+// awsclient.SNSMessage with the methods implemented with SDK v1.
+type SNSMessage awsclient.SNSMessage
+
+type (
+	// SNSBatchFailure describes a single message that could not be published by PublishSNSBatch
+	SNSBatchFailure = awsclient.SNSBatchFailure
+	// SNSBatchError is returned by PublishSNSBatch when one or more messages were not published
+	SNSBatchError = awsclient.SNSBatchError
+)
+
+var ErrSNSTopicMismatch = awsclient.ErrSNSTopicMismatch
+
+// Publish publishes the message to its topic. Throttled and transient failures, like 5xx responses
+// and reset connections, are retried with DefaultRetryPolicy as the SDK did, so a message whose
+// response was lost can be published twice. FIFO topics drop the duplicate by its deduplication
+// id.
+func (m SNSMessage) Publish(ctx context.Context, sa snsiface.SNSAPI) (*sns.PublishOutput, error) {
+	e, err := shared.NewSNSEntry(awsclient.SNSMessage(m))
+	if err != nil {
+		return &sns.PublishOutput{}, err
+	}
+
+	in := &sns.PublishInput{
+		TopicArn:               aws.String(m.TopicARN),
+		Message:                aws.String(e.Body),
+		MessageAttributes:      snsAttributes(e.Attrs),
+		Subject:                optionalString(e.Subject),
+		MessageGroupId:         optionalString(e.GroupID),
+		MessageDeduplicationId: optionalString(e.DeduplicationID),
+	}
+
+	var out *sns.PublishOutput
+	err = awsclient.DefaultRetryPolicy.Do(ctx, func() error {
+		out, err = sa.PublishWithContext(ctx, in, noSDKRetries)
+		return wrapError("Publish", err)
+	})
+
+	return out, err
+}
+
+// PublishSNSBatch publishes `msgs` to `topicARN`, sending up to 10 messages per PublishBatch
+// request. The TopicARN of each message must be empty or equal to `topicARN`. Requests are retried
+// like Publish.
+//
+// The returned slice has the message id of every published message, in the same order as `msgs`,
+// and an empty string for those that failed. If any message failed an *SNSBatchError is returned
+// with the details of each failure.
+func PublishSNSBatch(ctx context.Context, sa snsiface.SNSAPI, topicARN string, msgs []SNSMessage) ([]string, error) {
+	ms := make([]awsclient.SNSMessage, len(msgs))
+	for i, m := range msgs {
+		ms[i] = awsclient.SNSMessage(m)
+	}
+
+	return publishSNSBatch(ctx, sa, topicARN, ms)
+}
+
+// publishSNSBatch is PublishSNSBatch for the awsclient messages of Publisher.PublishBatch
+func publishSNSBatch(ctx context.Context, sa snsiface.SNSAPI, topicARN string, msgs []awsclient.SNSMessage) ([]string, error) {
+	return shared.PublishSNSBatch(ctx, topicARN, msgs, func(ctx context.Context, entries []shared.SNSEntry) (shared.BatchResult, error) {
+		in := &sns.PublishBatchInput{TopicArn: aws.String(topicARN)}
+		for _, e := range entries {
+			in.PublishBatchRequestEntries = append(in.PublishBatchRequestEntries, &sns.PublishBatchRequestEntry{
+				Id:                     aws.String(e.ID),
+				Message:                aws.String(e.Body),
+				MessageAttributes:      snsAttributes(e.Attrs),
+				Subject:                optionalString(e.Subject),
+				MessageGroupId:         optionalString(e.GroupID),
+				MessageDeduplicationId: optionalString(e.DeduplicationID),
+			})
+		}
+
+		out, err := sa.PublishBatchWithContext(ctx, in, noSDKRetries)
+		if err != nil {
+			return shared.BatchResult{}, wrapError("PublishBatch", err)
+		}
+
+		var r shared.BatchResult
+		for _, s := range out.Successful {
+			r.IDs = append(r.IDs, [2]string{aws.StringValue(s.Id), aws.StringValue(s.MessageId)})
+		}
+		for _, f := range out.Failed {
+			i, _ := strconv.Atoi(aws.StringValue(f.Id))
+			r.Failures = append(r.Failures, shared.BatchFailure{
+				Index:       i,
+				Code:        aws.StringValue(f.Code),
+				Message:     aws.StringValue(f.Message),
+				SenderFault: aws.BoolValue(f.SenderFault),
+			})
+		}
+
+		return r, nil
+	})
+}
+
+// snsAttributes converts message attributes into SNS message attributes
+func snsAttributes(ma map[string]shared.MessageAttribute) map[string]*sns.MessageAttributeValue {
+	if ma == nil {
+		return nil
+	}
+
+	out := make(map[string]*sns.MessageAttributeValue, len(ma))
+	for k, a := range ma {
+		out[k] = &sns.MessageAttributeValue{DataType: aws.String(a.DataType), StringValue: aws.String(a.Value)}
+	}
+
+	return out
+}
+
+// optionalString returns nil for empty strings, so optional fields are left out of requests
+func optionalString(s string) *string {
+	return shared.OptionalString(s)
+}
@@ -0,0 +1,157 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// SNS client used to avoid hitting the actual AWS endpoint. Entries with a "fail" subject fail.
+type mockSNSClient struct {
+	snsiface.SNSAPI
+	publishInput *sns.PublishInput
+	publishCalls int
+	publishErrs  []error
+	batchInputs  []*sns.PublishBatchInput
+	batchErr     error
+}
+
+func (m *mockSNSClient) PublishWithContext(_ context.Context, in *sns.PublishInput, _ ...request.Option) (*sns.PublishOutput, error) {
+	m.publishInput = in
+	m.publishCalls++
+	if len(m.publishErrs) > 0 {
+		err := m.publishErrs[0]
+		m.publishErrs = m.publishErrs[1:]
+		return nil, err
+	}
+	return &sns.PublishOutput{MessageId: awssdk.String("message-id")}, nil
+}
+
+func (m *mockSNSClient) PublishBatchWithContext(_ context.Context, in *sns.PublishBatchInput, _ ...request.Option) (*sns.PublishBatchOutput, error) {
+	m.batchInputs = append(m.batchInputs, in)
+	if m.batchErr != nil {
+		return nil, m.batchErr
+	}
+
+	out := &sns.PublishBatchOutput{}
+	for _, e := range in.PublishBatchRequestEntries {
+		if awssdk.StringValue(e.Subject) == "fail" {
+			out.Failed = append(out.Failed, &sns.BatchResultErrorEntry{
+				Id:          e.Id,
+				Code:        awssdk.String("InvalidParameter"),
+				Message:     awssdk.String("bad message"),
+				SenderFault: awssdk.Bool(true),
+			})
+			continue
+		}
+		out.Successful = append(out.Successful, &sns.PublishBatchResultEntry{
+			Id:        e.Id,
+			MessageId: awssdk.String("id-" + *e.Id),
+		})
+	}
+
+	return out, nil
+}
+
+func TestSNSPublish(t *testing.T) {
+	a := assert.New(t)
+	mock := &mockSNSClient{}
+
+	type attrs struct {
+		EventType string   `json:"event_type"`
+		Amount    int      `json:"amount"`
+		Urgent    bool     `json:"urgent"`
+		Tags      []string `json:"tags"`
+		Missing   *string  `json:"missing"`
+	}
+
+	m := aws.SNSMessage{
+		TopicARN:   "arn:aws:sns:us-east-1:123456789012:topic.fifo",
+		Message:    map[string]string{"hello": "world"},
+		Attributes: attrs{"payment", 100, true, []string{"a", "b"}, nil},
+		GroupID:    "account-1",
+	}
+
+	out, err := m.Publish(context.Background(), mock)
+	a.NoError(err)
+	a.Equal("message-id", *out.MessageId)
+
+	in := mock.publishInput
+	a.Equal(`{"hello":"world"}`, *in.Message)
+	a.Equal("account-1", *in.MessageGroupId)
+	a.Nil(in.MessageDeduplicationId, "empty optional fields should not be sent")
+	a.Nil(in.Subject)
+
+	a.Equal("String", *in.MessageAttributes["event_type"].DataType)
+	a.Equal("payment", *in.MessageAttributes["event_type"].StringValue)
+	a.Equal("Number", *in.MessageAttributes["amount"].DataType)
+	a.Equal("100", *in.MessageAttributes["amount"].StringValue)
+	a.Equal("true", *in.MessageAttributes["urgent"].StringValue)
+	a.Equal("String.Array", *in.MessageAttributes["tags"].DataType)
+	a.Equal(`["a","b"]`, *in.MessageAttributes["tags"].StringValue)
+	a.NotContains(in.MessageAttributes, "missing", "nil attributes should not be sent")
+
+	_, err = aws.SNSMessage{Attributes: "not a map"}.Publish(context.Background(), mock)
+	a.Error(err)
+
+	mock.publishCalls = 0
+	mock.publishErrs = []error{
+		awserr.New("Throttling", "rate exceeded", nil),
+		awserr.New("RequestError", "connection reset by peer", nil),
+	}
+	_, err = m.Publish(context.Background(), mock)
+	a.NoError(err, "throttled and transient failures should be retried")
+	a.Equal(3, mock.publishCalls)
+
+	mock.publishErrs = []error{awserr.New("InvalidParameter", "bad topic", nil)}
+	_, err = m.Publish(context.Background(), mock)
+	a.ErrorIs(err, aws.ErrInvalidRequest, "invalid requests should not be retried")
+}
+
+func TestPublishSNSBatch(t *testing.T) {
+	a := assert.New(t)
+	mock := &mockSNSClient{}
+	topic := "arn:aws:sns:us-east-1:123456789012:topic"
+
+	msgs := make([]aws.SNSMessage, 12)
+	for i := range msgs {
+		msgs[i] = aws.SNSMessage{Message: i}
+	}
+	msgs[11].Subject = "fail"
+
+	ids, err := aws.PublishSNSBatch(context.Background(), mock, topic, msgs)
+	a.Len(mock.batchInputs, 2, "messages should be sent in batches of 10")
+	a.Len(mock.batchInputs[0].PublishBatchRequestEntries, 10)
+	a.Equal("id-0", ids[0])
+	a.Equal("id-10", ids[10])
+	a.Equal("", ids[11], "failed messages should not have an id")
+
+	var batchErr *aws.SNSBatchError
+	a.True(errors.As(err, &batchErr))
+	if a.Len(batchErr.Failures, 1) {
+		f := batchErr.Failures[0]
+		a.Equal(aws.SNSBatchFailure{Index: 11, Code: "InvalidParameter", Message: "bad message", SenderFault: true, Err: f.Err}, f)
+	}
+	a.ErrorIs(err, aws.ErrInvalidRequest, "the failures should be classified")
+	a.False(errors.Is(err, aws.ErrThrottled))
+
+	mock.batchErr = awserr.New("Throttling", "rate exceeded", nil)
+	_, err = aws.PublishSNSBatch(context.Background(), mock, topic, msgs[:2])
+	a.ErrorIs(err, aws.ErrThrottled, "the error of failed requests should be kept")
+	var awsErr *aws.Error
+	if a.ErrorAs(err, &awsErr) {
+		a.Equal("PublishBatch", awsErr.Op)
+	}
+	mock.batchErr = nil
+
+	_, err = aws.PublishSNSBatch(context.Background(), mock, topic, []aws.SNSMessage{{TopicARN: "other"}})
+	a.ErrorIs(err, aws.ErrSNSTopicMismatch)
+}
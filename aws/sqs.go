@@ -0,0 +1,523 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/aws/internal/batcherr"
+	"github.com/credifranco/stori-utils-go/aws/internal/shared"
+)
+
+// sqsMaxBatchSize is the max number of entries in a single SendMessageBatch or ReceiveMessage
+// request
+const sqsMaxBatchSize = 10
+
+// sqsDeleteTimeout limits how long an SQSConsumer takes to delete a processed message. Deletes
+// don't use the context of Run, so the messages processed during a shutdown are not redelivered.
+const sqsDeleteTimeout = 5 * time.Second
+
+// sqsReceiveRetry retries the throttled and transient ReceiveMessage failures of an SQSConsumer
+// until its context is done, so a network blip doesn't stop it
+var sqsReceiveRetry = awsclient.RetryPolicy{
+	MaxAttempts:    math.MaxInt32,
+	BaseDelay:      100 * time.Millisecond,
+	MaxDelay:       20 * time.Second,
+	RetryTransient: true,
+}
+
+// SQSMessage contains the information needed to send a message to an SQS queue.
+type SQSMessage struct {
+	QueueURL string
+	// Body is marshalled to JSON and used as the message body
+	Body interface{}
+	// Attributes are sent as message attributes, following the same rules as SNSMessage.Attributes
+	Attributes interface{}
+	// DelaySeconds delays the delivery of the message. Not supported by FIFO queues.
+	DelaySeconds int64
+	// GroupID is the MessageGroupId, required for FIFO queues
+	GroupID string
+	// DeduplicationID is the MessageDeduplicationId for FIFO queues without content-based
+	// deduplication
+	DeduplicationID string
+}
+
+// SQSBatchFailure describes a single message that could not be sent by SendSQSBatch
+type SQSBatchFailure struct {
+	// Index is the position of the message in the slice passed to SendSQSBatch
+	Index       int
+	Code        string
+	Message     string
+	SenderFault bool
+	// Err is the *Error of the failure, which matches ErrThrottled, ErrTransient, etc. with
+	// errors.Is
+	Err error
+}
+
+// SQSBatchError is returned by SendSQSBatch when one or more messages were not sent
+type SQSBatchError struct {
+	Failures []SQSBatchFailure
+}
+
+func (e *SQSBatchError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("message %d: %s: %s", f.Index, f.Code, f.Message))
+	}
+
+	return fmt.Sprintf("%d SQS messages failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any failure matches `target`, like errors.Is(err, ErrThrottled) to check if
+// the batch should be retried
+func (e *SQSBatchError) Is(target error) bool {
+	return batcherr.Is(target, e.errs())
+}
+
+// As finds the first failure that matches `target`, like an *Error
+func (e *SQSBatchError) As(target interface{}) bool {
+	return batcherr.As(target, e.errs())
+}
+
+func (e *SQSBatchError) errs() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+
+	return errs
+}
+
+var ErrSQSQueueMismatch = errors.New("all messages in a batch must use the same queue")
+
+// SQSRecord is a message received from SQS, either through a Lambda SQS event or by an
+// SQSConsumer.
+type SQSRecord struct {
+	MessageID     string
+	ReceiptHandle string
+	Body          string
+	// Attributes are the system attributes, such as MessageGroupId and ApproximateReceiveCount
+	Attributes map[string]string
+	// MessageAttributes holds the string value of every String and Number message attribute
+	MessageAttributes map[string]string
+}
+
+// SQSRecordFunc processes a single SQS record. Returning an error marks the record as failed, so
+// it is retried by SQS. Panics are recovered and handled as errors.
+type SQSRecordFunc func(ctx context.Context, r SQSRecord) error
+
+// call runs `f` on `r`, returning panics as errors
+func (f SQSRecordFunc) call(ctx context.Context, r SQSRecord) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic processing sqs message %s: %v", r.MessageID, p)
+		}
+	}()
+
+	return f(ctx, r)
+}
+
+// SQSConsumer polls an SQS queue and runs Handler on each message, for workers that don't run in
+// Lambda. Messages are deleted when Handler succeeds. While Handler runs, the visibility timeout
+// of the message is extended so it isn't delivered to another consumer.
+type SQSConsumer struct {
+	QueueURL string
+	Handler  SQSRecordFunc
+	// MaxMessages received per poll, between 1 and 10. Defaults to 10
+	MaxMessages int64
+	// WaitTimeSeconds for long polling, up to 20. Defaults to 20
+	WaitTimeSeconds int64
+	// VisibilityTimeout in seconds of received messages, extended while they are processed.
+	// Defaults to 30
+	VisibilityTimeout int64
+	// ExtendInterval is how often the visibility of the messages being processed is extended.
+	// Defaults to half the VisibilityTimeout
+	ExtendInterval time.Duration
+	// Concurrency is the number of messages processed at the same time. Defaults to MaxMessages
+	Concurrency int
+	// OnError is called with errors from Handler or from deleting and extending messages. If nil
+	// those errors are ignored and the messages are retried once their visibility timeout ends.
+	OnError func(r SQSRecord, err error)
+}
+
+// Decode unmarshals the JSON body of the record into `v`
+func (r SQSRecord) Decode(v interface{}) error {
+	if err := json.Unmarshal([]byte(r.Body), v); err != nil {
+		return fmt.Errorf("error decoding sqs message %s: %w", r.MessageID, err)
+	}
+
+	return nil
+}
+
+// NewSQSClient is a helper function to create a new SQS client with the config from LoadConfig
+func NewSQSClient() (*sqs.SQS, error) {
+	c := LoadConfig()
+	if c.Region == "" {
+		return nil, ErrRegionNotSet
+	}
+
+	return c.SQS()
+}
+
+// Send sends the message to its queue.
+func (m SQSMessage) Send(ctx context.Context, qa sqsiface.SQSAPI) (*sqs.SendMessageOutput, error) {
+	body, err := json.Marshal(m.Body)
+	if err != nil {
+		return &sqs.SendMessageOutput{}, fmt.Errorf("error parsing json from sqs message: %w", err)
+	}
+
+	attrs, err := sqsAttributes(m.Attributes)
+	if err != nil {
+		return &sqs.SendMessageOutput{}, err
+	}
+
+	in := &sqs.SendMessageInput{
+		QueueUrl:               aws.String(m.QueueURL),
+		MessageBody:            aws.String(string(body)),
+		MessageAttributes:      attrs,
+		DelaySeconds:           optionalInt64(m.DelaySeconds),
+		MessageGroupId:         optionalString(m.GroupID),
+		MessageDeduplicationId: optionalString(m.DeduplicationID),
+	}
+
+	var out *sqs.SendMessageOutput
+	err = awsclient.DefaultRetryPolicy.ThrottleOnly().Do(ctx, func() error {
+		out, err = qa.SendMessageWithContext(ctx, in, noSDKRetries)
+		return wrapError("SendMessage", err)
+	})
+
+	return out, err
+}
+
+// SendSQSBatch sends `msgs` to `queueURL`, up to 10 messages per SendMessageBatch request. The
+// QueueURL of each message must be empty or equal to `queueURL`.
+//
+// The returned slice has the message id of every sent message, in the same order as `msgs`, and
+// an empty string for those that failed. If any message failed an *SQSBatchError is returned with
+// the details of each failure.
+func SendSQSBatch(ctx context.Context, qa sqsiface.SQSAPI, queueURL string, msgs []SQSMessage) ([]string, error) {
+	ids := make([]string, len(msgs))
+	entries := make([]*sqs.SendMessageBatchRequestEntry, 0, len(msgs))
+
+	for i, m := range msgs {
+		if m.QueueURL != "" && m.QueueURL != queueURL {
+			return ids, ErrSQSQueueMismatch
+		}
+
+		body, err := json.Marshal(m.Body)
+		if err != nil {
+			return ids, fmt.Errorf("error parsing json from sqs message %d: %w", i, err)
+		}
+
+		attrs, err := sqsAttributes(m.Attributes)
+		if err != nil {
+			return ids, fmt.Errorf("sqs message %d: %w", i, err)
+		}
+
+		entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+			Id:                     aws.String(strconv.Itoa(i)),
+			MessageBody:            aws.String(string(body)),
+			MessageAttributes:      attrs,
+			DelaySeconds:           optionalInt64(m.DelaySeconds),
+			MessageGroupId:         optionalString(m.GroupID),
+			MessageDeduplicationId: optionalString(m.DeduplicationID),
+		})
+	}
+
+	ids, failures := shared.SendBatches(ctx, awsclient.DefaultRetryPolicy.ThrottleOnly(), "SendMessageBatch", len(entries), sqsMaxBatchSize, func(ctx context.Context, start, end int) (shared.BatchResult, error) {
+		out, err := qa.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries[start:end],
+		}, noSDKRetries)
+		if err != nil {
+			return shared.BatchResult{}, wrapError("SendMessageBatch", err)
+		}
+
+		var r shared.BatchResult
+		for _, s := range out.Successful {
+			r.IDs = append(r.IDs, [2]string{aws.StringValue(s.Id), aws.StringValue(s.MessageId)})
+		}
+		for _, f := range out.Failed {
+			i, _ := strconv.Atoi(aws.StringValue(f.Id))
+			r.Failures = append(r.Failures, shared.BatchFailure{
+				Index:       i,
+				Code:        aws.StringValue(f.Code),
+				Message:     aws.StringValue(f.Message),
+				SenderFault: aws.BoolValue(f.SenderFault),
+			})
+		}
+
+		return r, nil
+	})
+
+	if len(failures) > 0 {
+		out := make([]SQSBatchFailure, len(failures))
+		for i, f := range failures {
+			out[i] = SQSBatchFailure(f)
+		}
+		return ids, &SQSBatchError{Failures: out}
+	}
+
+	return ids, nil
+}
+
+// SQSEventHandler returns a Lambda handler for SQS events that runs `f` on every record, with up to
+// `concurrency` records processed at the same time. Failed records are returned as batch item
+// failures, so the event source mapping must have ReportBatchItemFailures enabled.
+//
+// Records from FIFO queues that share a MessageGroupId are processed in order, and once one of them
+// fails the rest of its group is reported as failed without being processed, to keep the order.
+func SQSEventHandler(concurrency int, f SQSRecordFunc) func(context.Context, events.SQSEvent) (events.SQSEventResponse, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return func(ctx context.Context, e events.SQSEvent) (events.SQSEventResponse, error) {
+		// group the records so FIFO groups run sequentially. Records without a group run on
+		// their own.
+		var groups [][]events.SQSMessage
+		groupIndex := map[string]int{}
+		for _, m := range e.Records {
+			g, ok := m.Attributes["MessageGroupId"]
+			if !ok {
+				groups = append(groups, []events.SQSMessage{m})
+				continue
+			}
+
+			if i, ok := groupIndex[g]; ok {
+				groups[i] = append(groups[i], m)
+				continue
+			}
+			groupIndex[g] = len(groups)
+			groups = append(groups, []events.SQSMessage{m})
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		failed := map[string]bool{}
+		sem := make(chan struct{}, concurrency)
+
+		for _, g := range groups {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(g []events.SQSMessage) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				for i, m := range g {
+					if err := f.call(ctx, sqsRecordFromEvent(m)); err != nil {
+						mu.Lock()
+						for _, rest := range g[i:] {
+							failed[rest.MessageId] = true
+						}
+						mu.Unlock()
+						return
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		// report failures in the order they were received
+		out := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+		for _, m := range e.Records {
+			if failed[m.MessageId] {
+				out.BatchItemFailures = append(
+					out.BatchItemFailures,
+					events.SQSBatchItemFailure{ItemIdentifier: m.MessageId},
+				)
+			}
+		}
+
+		return out, nil
+	}
+}
+
+// Run polls the queue until `ctx` is done, and returns nil when it is. Throttled and transient
+// errors receiving messages are retried with backoff, and any other error is returned.
+func (c SQSConsumer) Run(ctx context.Context, qa sqsiface.SQSAPI) error {
+	c.setDefaults()
+
+	for {
+		var out *sqs.ReceiveMessageOutput
+		err := sqsReceiveRetry.Do(ctx, func() error {
+			var err error
+			out, err = qa.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:              aws.String(c.QueueURL),
+				MaxNumberOfMessages:   aws.Int64(c.MaxMessages),
+				WaitTimeSeconds:       aws.Int64(c.WaitTimeSeconds),
+				VisibilityTimeout:     aws.Int64(c.VisibilityTimeout),
+				AttributeNames:        aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+				MessageAttributeNames: aws.StringSlice([]string{"All"}),
+			}, noSDKRetries)
+			return wrapError("ReceiveMessage", err)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error receiving sqs messages: %w", err)
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, c.Concurrency)
+		for _, m := range out.Messages {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(r SQSRecord) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				c.process(ctx, qa, r)
+			}(sqsRecordFromMessage(m))
+		}
+		wg.Wait()
+	}
+}
+
+// process runs the Handler on `r`, extending its visibility until the Handler returns, and deletes
+// it on success
+func (c SQSConsumer) process(ctx context.Context, qa sqsiface.SQSAPI, r SQSRecord) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(c.ExtendInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				_, err := qa.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(c.QueueURL),
+					ReceiptHandle:     aws.String(r.ReceiptHandle),
+					VisibilityTimeout: aws.Int64(c.VisibilityTimeout),
+				})
+				if err != nil && ctx.Err() == nil {
+					c.onError(r, fmt.Errorf(
+						"error extending sqs message visibility: %w",
+						wrapError("ChangeMessageVisibility", err),
+					))
+				}
+			}
+		}
+	}()
+
+	err := c.Handler.call(ctx, r)
+	close(done)
+
+	if err != nil {
+		c.onError(r, err)
+		return
+	}
+
+	deleteCtx, cancel := context.WithTimeout(context.Background(), sqsDeleteTimeout)
+	defer cancel()
+
+	if _, err := qa.DeleteMessageWithContext(deleteCtx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.QueueURL),
+		ReceiptHandle: aws.String(r.ReceiptHandle),
+	}); err != nil {
+		c.onError(r, fmt.Errorf("error deleting sqs message: %w", wrapError("DeleteMessage", err)))
+	}
+}
+
+func (c SQSConsumer) onError(r SQSRecord, err error) {
+	if c.OnError != nil {
+		c.OnError(r, err)
+	}
+}
+
+func (c *SQSConsumer) setDefaults() {
+	if c.MaxMessages < 1 || c.MaxMessages > sqsMaxBatchSize {
+		c.MaxMessages = sqsMaxBatchSize
+	}
+
+	if c.WaitTimeSeconds < 1 || c.WaitTimeSeconds > 20 {
+		c.WaitTimeSeconds = 20
+	}
+
+	if c.VisibilityTimeout < 1 {
+		c.VisibilityTimeout = 30
+	}
+
+	if c.ExtendInterval <= 0 {
+		c.ExtendInterval = time.Duration(c.VisibilityTimeout) * time.Second / 2
+	}
+
+	if c.Concurrency < 1 {
+		c.Concurrency = int(c.MaxMessages)
+	}
+}
+
+// sqsAttributes converts a map or struct into SQS message attributes
+func sqsAttributes(attrs interface{}) (map[string]*sqs.MessageAttributeValue, error) {
+	ma, err := shared.MessageAttributes(attrs)
+	if err != nil || ma == nil {
+		return nil, err
+	}
+
+	out := make(map[string]*sqs.MessageAttributeValue, len(ma))
+	for k, a := range ma {
+		out[k] = &sqs.MessageAttributeValue{DataType: aws.String(a.DataType), StringValue: aws.String(a.Value)}
+	}
+
+	return out, nil
+}
+
+func sqsRecordFromEvent(m events.SQSMessage) SQSRecord {
+	attrs := make(map[string]string, len(m.MessageAttributes))
+	for k, a := range m.MessageAttributes {
+		if a.StringValue != nil {
+			attrs[k] = *a.StringValue
+		}
+	}
+
+	return SQSRecord{
+		MessageID:         m.MessageId,
+		ReceiptHandle:     m.ReceiptHandle,
+		Body:              m.Body,
+		Attributes:        m.Attributes,
+		MessageAttributes: attrs,
+	}
+}
+
+func sqsRecordFromMessage(m *sqs.Message) SQSRecord {
+	attrs := make(map[string]string, len(m.MessageAttributes))
+	for k, a := range m.MessageAttributes {
+		if a.StringValue != nil {
+			attrs[k] = *a.StringValue
+		}
+	}
+
+	return SQSRecord{
+		MessageID:         aws.StringValue(m.MessageId),
+		ReceiptHandle:     aws.StringValue(m.ReceiptHandle),
+		Body:              aws.StringValue(m.Body),
+		Attributes:        aws.StringValueMap(m.Attributes),
+		MessageAttributes: attrs,
+	}
+}
+
+// optionalInt64 returns nil for 0, so optional fields are left out of requests
+func optionalInt64(i int64) *int64 {
+	if i == 0 {
+		return nil
+	}
+
+	return aws.Int64(i)
+}
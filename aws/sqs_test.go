@@ -0,0 +1,302 @@
+package aws_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/credifranco/stori-utils-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// SQS client used to avoid hitting the actual AWS endpoint
+type mockSQSClient struct {
+	sqsiface.SQSAPI
+	mu         sync.Mutex
+	sendInput  *sqs.SendMessageInput
+	batchSizes []int
+	received   bool
+	deleted    []string
+	extended   chan *sqs.ChangeMessageVisibilityInput
+	cancel     context.CancelFunc
+	batchErr   error
+	// failID is the id of the batch entry that fails
+	failID string
+	// receiveErrs are returned by the first calls to ReceiveMessageWithContext
+	receiveErrs []error
+}
+
+func (m *mockSQSClient) SendMessageWithContext(_ context.Context, in *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	m.sendInput = in
+	return &sqs.SendMessageOutput{MessageId: awssdk.String("message-id")}, nil
+}
+
+func (m *mockSQSClient) SendMessageBatchWithContext(_ context.Context, in *sqs.SendMessageBatchInput, _ ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	m.batchSizes = append(m.batchSizes, len(in.Entries))
+	if m.batchErr != nil {
+		return nil, m.batchErr
+	}
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, e := range in.Entries {
+		if *e.Id == m.failID {
+			out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{
+				Id:          e.Id,
+				Code:        awssdk.String("InvalidParameterValue"),
+				Message:     awssdk.String("bad message"),
+				SenderFault: awssdk.Bool(true),
+			})
+			continue
+		}
+		out.Successful = append(out.Successful, &sqs.SendMessageBatchResultEntry{
+			Id:        e.Id,
+			MessageId: awssdk.String("id-" + *e.Id),
+		})
+	}
+
+	return out, nil
+}
+
+// ReceiveMessageWithContext returns the receiveErrs, then two messages, and cancels the consumer on
+// the next call
+func (m *mockSQSClient) ReceiveMessageWithContext(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	if len(m.receiveErrs) > 0 {
+		err := m.receiveErrs[0]
+		m.receiveErrs = m.receiveErrs[1:]
+		return nil, err
+	}
+	if m.received {
+		m.cancel()
+		return nil, ctx.Err()
+	}
+	m.received = true
+
+	return &sqs.ReceiveMessageOutput{Messages: []*sqs.Message{
+		{MessageId: awssdk.String("1"), ReceiptHandle: awssdk.String("r1"), Body: awssdk.String(`{"ok":true}`)},
+		{MessageId: awssdk.String("2"), ReceiptHandle: awssdk.String("r2"), Body: awssdk.String(`{"ok":false}`)},
+	}}, nil
+}
+
+func (m *mockSQSClient) DeleteMessageWithContext(ctx context.Context, in *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, *in.ReceiptHandle)
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (m *mockSQSClient) ChangeMessageVisibilityWithContext(_ context.Context, in *sqs.ChangeMessageVisibilityInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	select {
+	case m.extended <- in:
+	default:
+	}
+
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+type okMessage struct {
+	OK bool `json:"ok"`
+}
+
+// processOK fails records whose body has "ok": false
+func processOK(_ context.Context, r aws.SQSRecord) error {
+	var m okMessage
+	if err := r.Decode(&m); err != nil {
+		return err
+	}
+
+	if !m.OK {
+		return errors.New("not ok")
+	}
+
+	return nil
+}
+
+func TestSQSSend(t *testing.T) {
+	a := assert.New(t)
+	mock := &mockSQSClient{}
+
+	out, err := aws.SQSMessage{
+		QueueURL:        "https://sqs.us-east-1.amazonaws.com/123456789012/queue.fifo",
+		Body:            okMessage{true},
+		Attributes:      map[string]interface{}{"retries": 2},
+		GroupID:         "account-1",
+		DeduplicationID: "dedup-1",
+	}.Send(context.Background(), mock)
+	a.NoError(err)
+	a.Equal("message-id", *out.MessageId)
+	a.Equal(`{"ok":true}`, *mock.sendInput.MessageBody)
+	a.Equal("Number", *mock.sendInput.MessageAttributes["retries"].DataType)
+	a.Equal("dedup-1", *mock.sendInput.MessageDeduplicationId)
+	a.Nil(mock.sendInput.DelaySeconds)
+
+	msgs := make([]aws.SQSMessage, 21)
+	ids, err := aws.SendSQSBatch(context.Background(), mock, "queue", msgs)
+	a.NoError(err)
+	a.Equal([]int{10, 10, 1}, mock.batchSizes)
+	a.Equal("id-20", ids[20])
+
+	_, err = aws.SendSQSBatch(context.Background(), mock, "queue", []aws.SQSMessage{{QueueURL: "other"}})
+	a.ErrorIs(err, aws.ErrSQSQueueMismatch)
+
+	mock.failID = "11"
+	ids, err = aws.SendSQSBatch(context.Background(), mock, "queue", msgs)
+	var batchErr *aws.SQSBatchError
+	if a.ErrorAs(err, &batchErr) {
+		a.Equal([]aws.SQSBatchFailure{{
+			Index:       11,
+			Code:        "InvalidParameterValue",
+			Message:     "bad message",
+			SenderFault: true,
+			Err:         batchErr.Failures[0].Err,
+		}}, batchErr.Failures)
+		a.ErrorIs(batchErr.Failures[0].Err, aws.ErrInvalidRequest)
+	}
+	a.Equal("", ids[11])
+	a.Equal("id-12", ids[12])
+
+	mock.batchErr = awserr.New("RequestThrottled", "slow down", nil)
+	_, err = aws.SendSQSBatch(context.Background(), mock, "queue", msgs[:2])
+	if a.ErrorAs(err, &batchErr) {
+		a.Len(batchErr.Failures, 2)
+	}
+	a.ErrorIs(err, aws.ErrThrottled, "the error of failed requests should be kept")
+}
+
+func TestSQSEventHandler(t *testing.T) {
+	a := assert.New(t)
+
+	record := func(id, body, group string) events.SQSMessage {
+		m := events.SQSMessage{MessageId: id, Body: body}
+		if group != "" {
+			m.Attributes = map[string]string{"MessageGroupId": group}
+		}
+		return m
+	}
+
+	h := aws.SQSEventHandler(4, processOK)
+	res, err := h(context.Background(), events.SQSEvent{Records: []events.SQSMessage{
+		record("1", `{"ok":true}`, ""),
+		record("2", `{"ok":false}`, ""),
+		record("3", `not json`, ""),
+		record("4", `{"ok":false}`, "g1"),
+		record("5", `{"ok":true}`, "g1"),
+		record("6", `{"ok":true}`, "g2"),
+	}})
+	a.NoError(err)
+	a.Equal(
+		[]events.SQSBatchItemFailure{{ItemIdentifier: "2"}, {ItemIdentifier: "3"}, {ItemIdentifier: "4"}, {ItemIdentifier: "5"}},
+		res.BatchItemFailures,
+		"records after a failure in the same FIFO group should also fail",
+	)
+}
+
+func TestSQSConsumer(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	mock := &mockSQSClient{cancel: cancel}
+
+	var mu sync.Mutex
+	var failed []string
+	c := aws.SQSConsumer{
+		QueueURL: "queue",
+		Handler:  processOK,
+		OnError: func(r aws.SQSRecord, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, r.MessageID)
+		},
+	}
+
+	a.NoError(c.Run(ctx, mock), "canceling the context should stop the consumer cleanly")
+	a.Equal([]string{"r1"}, mock.deleted, "only successful messages should be deleted")
+	a.Equal([]string{"2"}, failed)
+}
+
+func TestSQSConsumerReceiveErrors(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	mock := &mockSQSClient{cancel: cancel, receiveErrs: []error{
+		awserr.New("ThrottlingException", "slow down", nil),
+		awserr.New("RequestError", "connection reset", nil),
+	}}
+
+	c := aws.SQSConsumer{QueueURL: "queue", Handler: func(context.Context, aws.SQSRecord) error { return nil }}
+	a.NoError(c.Run(ctx, mock), "throttled and transient errors should be retried")
+	a.ElementsMatch([]string{"r1", "r2"}, mock.deleted)
+
+	mock = &mockSQSClient{cancel: cancel, receiveErrs: []error{
+		awserr.New("AWS.SimpleQueueService.NonExistentQueue", "no queue", nil),
+	}}
+	err := c.Run(context.Background(), mock)
+	a.ErrorIs(err, aws.ErrNotFound, "errors that can't be retried should stop the consumer")
+}
+
+func TestSQSConsumerShutdown(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	mock := &mockSQSClient{cancel: cancel}
+
+	var mu sync.Mutex
+	var errs []error
+	c := aws.SQSConsumer{
+		QueueURL:    "queue",
+		Concurrency: 1,
+		Handler: func(_ context.Context, r aws.SQSRecord) error {
+			if r.MessageID == "2" {
+				panic("bad message")
+			}
+			// shutting down while the message is processed
+			cancel()
+			return nil
+		},
+		OnError: func(r aws.SQSRecord, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	}
+
+	a.NoError(c.Run(ctx, mock))
+	a.Equal([]string{"r1"}, mock.deleted, "processed messages should be deleted during a shutdown")
+	if a.Len(errs, 1) {
+		a.Equal("panic processing sqs message 2: bad message", errs[0].Error())
+	}
+}
+
+func TestSQSConsumerExtendVisibility(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	mock := &mockSQSClient{cancel: cancel, extended: make(chan *sqs.ChangeMessageVisibilityInput)}
+
+	c := aws.SQSConsumer{
+		QueueURL:          "queue",
+		VisibilityTimeout: 45,
+		ExtendInterval:    time.Millisecond,
+		Concurrency:       1,
+		Handler: func(_ context.Context, r aws.SQSRecord) error {
+			// the handler finishes once its visibility was extended twice
+			for i := 0; i < 2; i++ {
+				in := <-mock.extended
+				a.Equal(r.ReceiptHandle, *in.ReceiptHandle)
+				a.Equal(int64(45), *in.VisibilityTimeout)
+			}
+			return nil
+		},
+	}
+
+	a.NoError(c.Run(ctx, mock))
+	a.Equal([]string{"r1", "r2"}, mock.deleted)
+}
@@ -5,7 +5,6 @@ package db
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -268,18 +267,45 @@ func (d *AWSDB) Close() {
 func (d *AWSDB) pingProxy(ctx context.Context, dp DBProxies, c chan error, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	if err := d.PingProxy(ctx, dp); err != nil {
+		c <- err
+	}
+}
+
+// PingProxy checks the connection to a single db proxy. It returns ErrReaderNotCreated or
+// ErrWriterNotCreated if the pool for `dp` was not created.
+func (d *AWSDB) PingProxy(ctx context.Context, dp DBProxies) error {
 	switch dp {
 	case Read:
-		if err := d.reader.Ping(ctx); err != nil {
-			c <- err
-			return
+		if d.reader == nil {
+			return ErrReaderNotCreated
 		}
+
+		return d.reader.Ping(ctx)
 	case Write:
-		if err := d.writer.Ping(ctx); err != nil {
-			c <- err
-			return
+		if d.writer == nil {
+			return ErrWriterNotCreated
 		}
+
+		return d.writer.Ping(ctx)
+	default:
+		return fmt.Errorf("%v or %v not provided", Read, Write)
+	}
+}
+
+// Proxies returns the db proxies that have a connection pool
+func (d *AWSDB) Proxies() []DBProxies {
+	var out []DBProxies
+
+	if d.reader != nil {
+		out = append(out, Read)
+	}
+
+	if d.writer != nil {
+		out = append(out, Write)
 	}
+
+	return out
 }
 
 func (d *AWSDB) Ping(ctx context.Context) error {
@@ -312,16 +338,7 @@ func (d *AWSDB) Ping(ctx context.Context) error {
 
 // getValuesAWS populates `ds` from the values stored in AWS Secrets Manager with Secret ID `name`
 func (ds *dbSecret) getValuesAWS(name string) error {
-	r, err := aws.GetSecret(name)
-	if err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal([]byte(r), &ds); err != nil {
-		return err
-	}
-
-	return nil
+	return aws.GetSecretJSON(name, ds)
 }
 
 // dpOpen wraps sql.Open to work with AWS IAM authentication
@@ -348,7 +365,7 @@ func (ds dbSecret) dbOpen(ctx context.Context) (*pgxpool.Pool, error) {
 	cfg.BeforeConnect = func(c context.Context, cc *pgx.ConnConfig) error {
 		now := time.Now()
 		if now.After(ds.exp) {
-			if cc.Config.Password, err = aws.GetRDSAuthToken(ctx, ds.Host, ds.UserName, ds.Port); err != nil {
+			if cc.Config.Password, err = aws.GetRDSAuthToken(c, ds.Host, ds.UserName, ds.Port); err != nil {
 				return err
 			}
 			// Set expire token expire time in 14m 50s
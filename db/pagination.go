@@ -0,0 +1,193 @@
+package db
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Cursor is the position of the last row returned by a keyset paginated query. Value is the value
+// of the sort column and ID the value of the unique tie-breaker column for that row. Column and
+// Desc are the sort of the page the cursor was created for, so it is not accepted by a listing
+// sorted in another way. Create cursors with KeysetPage.Cursor to set them.
+type Cursor struct {
+	Value  interface{} `json:"v"`
+	ID     interface{} `json:"id"`
+	Column string      `json:"c"`
+	Desc   bool        `json:"d,omitempty"`
+}
+
+// CursorSigner encodes Cursors into opaque tokens that can be handed to clients, and decodes them
+// back. Tokens are signed with HMAC-SHA256 so a client can not tamper with them.
+type CursorSigner struct {
+	key []byte
+}
+
+// KeysetPage describes a single page of a keyset (cursor based) paginated query.
+type KeysetPage struct {
+	// Column is the column the results are sorted by
+	Column string
+	// IDColumn is a unique column used to break ties in Column. Defaults to "id"
+	IDColumn string
+	// Desc sorts the results in descending order
+	Desc bool
+	// Limit is the maximum number of rows in the page
+	Limit int
+	// After is the position of the last row of the previous page, nil for the first page
+	After *Cursor
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidColumn = errors.New("invalid column name")
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// NewCursorSigner creates a CursorSigner using `key` as the HMAC secret. The key must be at least
+// 32 bytes long.
+func NewCursorSigner(key []byte) (CursorSigner, error) {
+	if len(key) < sha256.Size {
+		return CursorSigner{}, fmt.Errorf("cursor key must be at least %d bytes", sha256.Size)
+	}
+
+	return CursorSigner{key: key}, nil
+}
+
+// Encode returns `c` as an opaque, signed token
+func (s CursorSigner) Encode(c Cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("could not encode cursor: %v", err)
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.sign(payload)), nil
+}
+
+// Decode verifies the signature of `token` and returns the Cursor it contains. ErrInvalidCursor is
+// returned if the token is malformed or was not signed with the key of `s`.
+func (s CursorSigner) Decode(token string) (Cursor, error) {
+	var c Cursor
+	enc := base64.RawURLEncoding
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return c, ErrInvalidCursor
+	}
+
+	payload, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	sig, err := enc.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, s.sign(payload)) {
+		return c, ErrInvalidCursor
+	}
+
+	// keep numbers as json.Number so large ids don't lose precision as float64
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func (s CursorSigner) sign(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+// Clause builds the `WHERE (col, id) > ($n, $m) ORDER BY col, id LIMIT $k` clause for the page.
+// Placeholders are numbered starting after `argOffset`, so the clause can be appended to a query
+// that already uses `argOffset` arguments. The WHERE condition is left out for the first page.
+//
+// The LIMIT is set to Limit + 1, so the caller can tell whether there is a next page by checking if
+// more than Limit rows were returned.
+func (p KeysetPage) Clause(argOffset int) (string, []interface{}, error) {
+	idCol := p.IDColumn
+	if idCol == "" {
+		idCol = "id"
+	}
+
+	if !identifierRegexp.MatchString(p.Column) || !identifierRegexp.MatchString(idCol) {
+		return "", nil, ErrInvalidColumn
+	}
+
+	if p.Limit < 1 {
+		return "", nil, errors.New("limit must be greater than 0")
+	}
+
+	cmp, dir := ">", "ASC"
+	if p.Desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	var sb strings.Builder
+	var args []interface{}
+
+	if p.After != nil {
+		fmt.Fprintf(
+			&sb,
+			"WHERE (%s, %s) %s ($%d, $%d) ",
+			p.Column, idCol, cmp, argOffset+1, argOffset+2,
+		)
+		args = append(args, p.After.Value, p.After.ID)
+	}
+
+	fmt.Fprintf(
+		&sb,
+		"ORDER BY %s %s, %s %s LIMIT $%d",
+		p.Column, dir, idCol, dir, argOffset+len(args)+1,
+	)
+	args = append(args, p.Limit+1)
+
+	return sb.String(), args, nil
+}
+
+// Apply wraps `sql` in a subquery and appends the page Clause to it, returning the new SQL string
+// and arguments. Use this when `sql` already has its own WHERE clause. Column and IDColumn must be
+// columns returned by `sql`. They can be qualified by their table, like t.created_at, which is
+// removed in the clause as the subquery only has the column names.
+func (p KeysetPage) Apply(sql string, args ...interface{}) (string, []interface{}, error) {
+	p.Column = unqualified(p.Column)
+	p.IDColumn = unqualified(p.IDColumn)
+	clause, pageArgs, err := p.Clause(len(args))
+	if err != nil {
+		return "", nil, err
+	}
+
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+	out := append(append([]interface{}{}, args...), pageArgs...)
+	return fmt.Sprintf("SELECT * FROM (%s) AS page %s", sql, clause), out, nil
+}
+
+// Cursor returns the cursor of the row with the sort `value` and the tie-breaker `id`, for the
+// sort of the page
+func (p KeysetPage) Cursor(value, id interface{}) Cursor {
+	return Cursor{Value: value, ID: id, Column: p.Column, Desc: p.Desc}
+}
+
+// WithCursor returns a copy of the page that starts after `c`. ErrInvalidCursor is returned if `c`
+// was created for a page sorted by another column or in another direction.
+func (p KeysetPage) WithCursor(c Cursor) (KeysetPage, error) {
+	if c.Column != p.Column || c.Desc != p.Desc {
+		return p, ErrInvalidCursor
+	}
+
+	p.After = &c
+	return p, nil
+}
+
+// unqualified removes the table of a qualified column name
+func unqualified(col string) string {
+	return col[strings.LastIndex(col, ".")+1:]
+}
@@ -0,0 +1,94 @@
+package db_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/credifranco/stori-utils-go/db"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCursorKey = []byte(strings.Repeat("k", 32))
+
+func TestCursorSigner(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := db.NewCursorSigner([]byte("short"))
+	a.Error(err, "signer should not accept a short key")
+
+	s, err := db.NewCursorSigner(testCursorKey)
+	a.NoError(err)
+
+	token, err := s.Encode(db.Cursor{Value: "2021-12-01", ID: 9007199254740993})
+	a.NoError(err)
+
+	c, err := s.Decode(token)
+	a.NoError(err)
+	a.Equal("2021-12-01", c.Value)
+	a.Equal(json.Number("9007199254740993"), c.ID, "ids should not lose precision")
+
+	// flip a character of the payload
+	tampered := "A" + token[1:]
+	if tampered == token {
+		tampered = "B" + token[1:]
+	}
+	_, err = s.Decode(tampered)
+	a.ErrorIs(err, db.ErrInvalidCursor, "tampered cursor should be rejected")
+
+	other, _ := db.NewCursorSigner([]byte(strings.Repeat("o", 32)))
+	_, err = other.Decode(token)
+	a.ErrorIs(err, db.ErrInvalidCursor, "cursor signed with another key should be rejected")
+
+	_, err = s.Decode("not-a-cursor")
+	a.ErrorIs(err, db.ErrInvalidCursor)
+}
+
+func TestKeysetPageCursor(t *testing.T) {
+	a := assert.New(t)
+	p := db.KeysetPage{Column: "created_at", Desc: true, Limit: 10}
+
+	c := p.Cursor("2021-12-01", 5)
+	a.Equal(db.Cursor{Value: "2021-12-01", ID: 5, Column: "created_at", Desc: true}, c)
+
+	next, err := p.WithCursor(c)
+	a.NoError(err)
+	a.Equal(&c, next.After)
+
+	_, err = db.KeysetPage{Column: "created_at"}.WithCursor(c)
+	a.ErrorIs(err, db.ErrInvalidCursor, "the direction should match")
+	_, err = db.KeysetPage{Column: "amount", Desc: true}.WithCursor(c)
+	a.ErrorIs(err, db.ErrInvalidCursor, "the column should match")
+}
+
+func TestKeysetPageClause(t *testing.T) {
+	a := assert.New(t)
+
+	p := db.KeysetPage{Column: "created_at", Limit: 10}
+	sql, args, err := p.Clause(0)
+	a.NoError(err)
+	a.Equal("ORDER BY created_at ASC, id ASC LIMIT $1", sql, "first page should not have a WHERE clause")
+	a.Equal([]interface{}{11}, args)
+
+	p.After = &db.Cursor{Value: "2021-12-01", ID: 5}
+	p.Desc = true
+	sql, args, err = p.Clause(1)
+	a.NoError(err)
+	a.Equal("WHERE (created_at, id) < ($2, $3) ORDER BY created_at DESC, id DESC LIMIT $4", sql)
+	a.Equal([]interface{}{"2021-12-01", 5, 11}, args)
+
+	_, _, err = db.KeysetPage{Column: "id; DROP TABLE users", Limit: 1}.Clause(0)
+	a.ErrorIs(err, db.ErrInvalidColumn, "column names should be validated")
+
+	p.Column = "t.created_at"
+	p.IDColumn = "t.id"
+	sql, args, err = p.Apply("SELECT t.id, t.created_at FROM t WHERE user_id = $1;", "u1")
+	a.NoError(err)
+	a.Equal(
+		"SELECT * FROM (SELECT t.id, t.created_at FROM t WHERE user_id = $1) AS page "+
+			"WHERE (created_at, id) < ($2, $3) ORDER BY created_at DESC, id DESC LIMIT $4",
+		sql,
+		"the qualifiers should be removed outside of the subquery",
+	)
+	a.Equal([]interface{}{"u1", "2021-12-01", 5, 11}, args)
+}
@@ -0,0 +1,202 @@
+package log
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.uber.org/zap"
+)
+
+// Keys of the request fields added to the loggers returned by FromContext
+const (
+	RequestIDKey     = "request_id"
+	FunctionARNKey   = "function_arn"
+	APIRequestIDKey  = "api_request_id"
+	UserSubKey       = "user_sub"
+	TraceIDKey       = "trace_id"
+	CorrelationIDKey = "correlation_id"
+)
+
+// Headers read by APIGatewayFields
+const (
+	TraceIDHeader       = "X-Amzn-Trace-Id"
+	CorrelationIDHeader = "X-Correlation-Id"
+)
+
+// lambdaTraceIDKey is the context key used by the Lambda runtime for the X-Ray trace header
+const lambdaTraceIDKey = "x-amzn-trace-id"
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	fieldsKey
+)
+
+// Fields are the request-scoped fields of a logger. Empty fields are not logged.
+type Fields struct {
+	// RequestID is the AWS request ID of the Lambda invocation
+	RequestID   string
+	FunctionARN string
+	// APIRequestID is the request ID of API Gateway, which is returned to the clients
+	APIRequestID string
+	// UserSub is the Cognito sub of the authenticated user
+	UserSub string
+	// TraceID is the root of the X-Ray trace
+	TraceID       string
+	CorrelationID string
+}
+
+// merge returns `f` with the empty fields taken from `other`
+func (f Fields) merge(other Fields) Fields {
+	set := func(dst *string, v string) {
+		if *dst == "" {
+			*dst = v
+		}
+	}
+	set(&f.RequestID, other.RequestID)
+	set(&f.FunctionARN, other.FunctionARN)
+	set(&f.APIRequestID, other.APIRequestID)
+	set(&f.UserSub, other.UserSub)
+	set(&f.TraceID, other.TraceID)
+	set(&f.CorrelationID, other.CorrelationID)
+
+	return f
+}
+
+// keysAndValues returns the non-empty fields as zap key-value pairs
+func (f Fields) keysAndValues() []interface{} {
+	var kv []interface{}
+	add := func(k, v string) {
+		if v != "" {
+			kv = append(kv, k, v)
+		}
+	}
+	add(RequestIDKey, f.RequestID)
+	add(FunctionARNKey, f.FunctionARN)
+	add(APIRequestIDKey, f.APIRequestID)
+	add(UserSubKey, f.UserSub)
+	add(TraceIDKey, f.TraceID)
+	add(CorrelationIDKey, f.CorrelationID)
+
+	return kv
+}
+
+var (
+	defaultLogger     *zap.SugaredLogger
+	defaultLoggerOnce sync.Once
+)
+
+// WithContext returns a copy of `ctx` that carries `logger`, to be retrieved with FromContext
+func WithContext(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger of `ctx` with the fields of FieldsFromContext. If `ctx` has no
+// logger, a logger created with NewLogger is used.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	logger, ok := ctx.Value(loggerKey).(*zap.SugaredLogger)
+	if !ok || logger == nil {
+		logger = getDefaultLogger()
+	}
+
+	if kv := FieldsFromContext(ctx).keysAndValues(); len(kv) > 0 {
+		return logger.With(kv...)
+	}
+
+	return logger
+}
+
+// WithFields returns a copy of `ctx` with the non-empty values of `f` added to its fields
+func WithFields(ctx context.Context, f Fields) context.Context {
+	current, _ := ctx.Value(fieldsKey).(Fields)
+	return context.WithValue(ctx, fieldsKey, f.merge(current))
+}
+
+// WithAPIGatewayRequest returns a copy of `ctx` with the APIGatewayFields of `e`
+func WithAPIGatewayRequest(ctx context.Context, e events.APIGatewayProxyRequest) context.Context {
+	return WithFields(ctx, APIGatewayFields(e))
+}
+
+// FieldsFromContext returns the fields added to `ctx` with WithFields, and the LambdaFields of
+// `ctx` for the ones that were not set
+func FieldsFromContext(ctx context.Context) Fields {
+	f, _ := ctx.Value(fieldsKey).(Fields)
+	return f.merge(LambdaFields(ctx))
+}
+
+// LambdaFields returns the request ID, function ARN and trace ID of the Lambda invocation of `ctx`
+func LambdaFields(ctx context.Context) Fields {
+	var f Fields
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		f.RequestID = lc.AwsRequestID
+		f.FunctionARN = lc.InvokedFunctionArn
+	}
+
+	if trace, ok := ctx.Value(lambdaTraceIDKey).(string); ok {
+		f.TraceID = traceRoot(trace)
+	}
+
+	return f
+}
+
+// APIGatewayFields returns the API Gateway request ID, Cognito sub, trace ID and correlation ID of
+// the request
+func APIGatewayFields(e events.APIGatewayProxyRequest) Fields {
+	f := Fields{
+		APIRequestID:  e.RequestContext.RequestID,
+		TraceID:       traceRoot(header(e, TraceIDHeader)),
+		CorrelationID: header(e, CorrelationIDHeader),
+	}
+
+	if claims, ok := e.RequestContext.Authorizer["claims"].(map[string]interface{}); ok {
+		f.UserSub, _ = claims["sub"].(string)
+	}
+
+	return f
+}
+
+// header returns the value of the header `name` of the request, ignoring case
+func header(e events.APIGatewayProxyRequest, name string) string {
+	for k, v := range e.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	for k, v := range e.MultiValueHeaders {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+
+	return ""
+}
+
+// traceRoot returns the Root of an X-Ray trace header such as Root=1-5759e988-bd86;Sampled=1, or
+// the header itself if it has no Root
+func traceRoot(trace string) string {
+	for _, part := range strings.Split(trace, ";") {
+		if strings.HasPrefix(part, "Root=") {
+			return strings.TrimPrefix(part, "Root=")
+		}
+	}
+
+	return trace
+}
+
+// getDefaultLogger returns the logger used by FromContext when the context has none
+func getDefaultLogger() *zap.SugaredLogger {
+	defaultLoggerOnce.Do(func() {
+		logger, err := NewLogger()
+		if err != nil {
+			logger = zap.NewNop().Sugar()
+		}
+		defaultLogger = logger
+	})
+
+	return defaultLogger
+}
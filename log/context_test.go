@@ -0,0 +1,70 @@
+package log_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/credifranco/stori-utils-go/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFromContext(t *testing.T) {
+	a := assert.New(t)
+	core, logs := observer.New(zap.InfoLevel)
+
+	e := events.APIGatewayProxyRequest{
+		Headers: map[string]string{
+			"x-amzn-trace-id":  "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1",
+			"X-Correlation-ID": "correlation-1",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "api-request-1",
+			Authorizer: map[string]interface{}{"claims": map[string]interface{}{"sub": "user-1"}},
+		},
+	}
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID:       "request-1",
+		InvokedFunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:stori-fn",
+	})
+	ctx = log.WithAPIGatewayRequest(ctx, e)
+	ctx = log.WithContext(ctx, zap.New(core).Sugar())
+
+	log.FromContext(ctx).Infow("handled", "status", 200)
+
+	if a.Equal(1, logs.Len()) {
+		a.Equal(map[string]interface{}{
+			"request_id":     "request-1",
+			"function_arn":   "arn:aws:lambda:us-east-1:123456789012:function:stori-fn",
+			"api_request_id": "api-request-1",
+			"user_sub":       "user-1",
+			"trace_id":       "1-5759e988-bd862e3fe1be46a994272793",
+			"correlation_id": "correlation-1",
+			"status":         int64(200),
+		}, logs.All()[0].ContextMap())
+	}
+
+	// fields can be overridden, and empty fields are not logged
+	ctx = log.WithFields(ctx, log.Fields{CorrelationID: "correlation-2"})
+	ctx = log.WithFields(ctx, log.Fields{UserSub: ""})
+	f := log.FieldsFromContext(ctx)
+	a.Equal("correlation-2", f.CorrelationID)
+	a.Equal("user-1", f.UserSub)
+
+	log.FromContext(context.Background()).Infow("no logger in context")
+	a.Equal(1, logs.Len(), "contexts without a logger should use the default logger")
+}
+
+func TestLambdaFields(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(log.Fields{}, log.LambdaFields(context.Background()))
+
+	//nolint:staticcheck // the Lambda runtime uses a string key
+	ctx := context.WithValue(context.Background(), "x-amzn-trace-id", "Root=1-abc;Parent=def;Sampled=0")
+	a.Equal(log.Fields{TraceID: "1-abc"}, log.LambdaFields(ctx))
+}
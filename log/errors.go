@@ -0,0 +1,100 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrorKey is the key of ErrorField
+const ErrorKey = "error"
+
+// maxErrorCauses limits the causes rendered by ErrorField, in case of cyclic error chains
+const maxErrorCauses = 32
+
+// ErrorField renders `err` as an object with its message, type and the chain of errors it wraps,
+// instead of the flat message of zap.Error:
+//
+//	{"error":{"message":"error reading config: open cfg.json: no such file or directory",
+//	  "type":"*fmt.wrapError","causes":[{"message":"open cfg.json: no such file or directory",
+//	  "type":"*fs.PathError"},{"message":"no such file or directory","type":"syscall.Errno"}]}}
+//
+// It can be passed to sugared loggers too, like logger.Errorw("msg", log.ErrorField(err)).
+func ErrorField(err error) zap.Field {
+	return NamedErrorField(ErrorKey, err)
+}
+
+// NamedErrorField is ErrorField with the key `key`
+func NamedErrorField(key string, err error) zap.Field {
+	if err == nil {
+		return zap.Skip()
+	}
+
+	return zap.Object(key, errorObject{err})
+}
+
+// errorObject is a zapcore.ObjectMarshaler of an error and its causes
+type errorObject struct {
+	err error
+}
+
+func (e errorObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("message", e.err.Error())
+	enc.AddString("type", fmt.Sprintf("%T", e.err))
+
+	if causes := errorCauses(e.err); len(causes) > 0 {
+		return enc.AddArray("causes", zapcore.ArrayMarshalerFunc(func(ae zapcore.ArrayEncoder) error {
+			for _, c := range causes {
+				if err := ae.AppendObject(causeObject{c}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+
+	return nil
+}
+
+// causeObject is a cause of an errorObject, without its own causes
+type causeObject struct {
+	err error
+}
+
+func (c causeObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("message", c.err.Error())
+	enc.AddString("type", fmt.Sprintf("%T", c.err))
+	return nil
+}
+
+// errorCauses returns the errors wrapped by `err`, depth first. Errors joining several errors with
+// Unwrap() []error are also supported.
+func errorCauses(err error) []error {
+	var causes []error
+
+	var walk func(err error)
+	walk = func(err error) {
+		var next []error
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			next = u.Unwrap()
+		default:
+			if n := errors.Unwrap(err); n != nil {
+				next = []error{n}
+			}
+		}
+
+		for _, n := range next {
+			if n == nil || len(causes) >= maxErrorCauses {
+				continue
+			}
+			causes = append(causes, n)
+			walk(n)
+		}
+	}
+	walk(err)
+
+	return causes
+}
@@ -0,0 +1,40 @@
+package log_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/credifranco/stori-utils-go/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestErrorField(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := os.Open("missing.json")
+	err = fmt.Errorf("error reading config: %w", err)
+
+	enc := zapcore.NewMapObjectEncoder()
+	log.ErrorField(err).AddTo(enc)
+
+	a.Equal(map[string]interface{}{
+		"message": "error reading config: open missing.json: no such file or directory",
+		"type":    "*fmt.wrapError",
+		"causes": []interface{}{
+			map[string]interface{}{"message": "open missing.json: no such file or directory", "type": "*fs.PathError"},
+			map[string]interface{}{"message": "no such file or directory", "type": "syscall.Errno"},
+		},
+	}, enc.Fields["error"])
+	a.True(errors.Is(err, fs.ErrNotExist))
+
+	enc = zapcore.NewMapObjectEncoder()
+	log.NamedErrorField("cause", errors.New("boom")).AddTo(enc)
+	a.Equal(map[string]interface{}{"message": "boom", "type": "*errors.errorString"}, enc.Fields["cause"])
+
+	a.Equal(zap.Skip(), log.ErrorField(nil))
+}
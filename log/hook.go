@@ -0,0 +1,408 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"go.uber.org/zap/zapcore"
+)
+
+// HookEntry is a log entry passed to a Hook. Its Stack is set for the levels of the stack traces,
+// error and above by default.
+type HookEntry struct {
+	zapcore.Entry
+	// Fields are the redacted fields of the entry and of its logger
+	Fields map[string]interface{}
+}
+
+// Hook receives the log entries of a level, like errors to forward to an alerting sink. Fire is
+// called synchronously by the logger, and its errors are written to the error output of the logger,
+// so hooks that send the entries over the network should queue them, like SNSHook. Hooks that
+// queue entries can implement Sync to send them when the logger is synced.
+type Hook interface {
+	Fire(e HookEntry) error
+}
+
+// ErrHookClosed is returned by the hooks that receive entries after being closed
+var ErrHookClosed = errors.New("hook closed")
+
+// HookFunc is a function that implements Hook
+type HookFunc func(e HookEntry) error
+
+func (f HookFunc) Fire(e HookEntry) error {
+	return f(e)
+}
+
+// hookCore is a zapcore.Core that fires a Hook
+type hookCore struct {
+	zapcore.LevelEnabler
+	hook   Hook
+	fields []zapcore.Field
+}
+
+// NewHookCore returns a core that fires `hook` with the entries enabled by `enab`. It is meant to
+// be combined with zapcore.NewTee, which WithHook does for NewLogger.
+func NewHookCore(enab zapcore.LevelEnabler, hook Hook) zapcore.Core {
+	return &hookCore{LevelEnabler: enab, hook: hook}
+}
+
+func (c *hookCore) With(fields []zapcore.Field) zapcore.Core {
+	return &hookCore{
+		LevelEnabler: c.LevelEnabler,
+		hook:         c.hook,
+		fields:       append(append([]zapcore.Field(nil), c.fields...), fields...),
+	}
+}
+
+func (c *hookCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+
+	return ce
+}
+
+func (c *hookCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	return c.hook.Fire(HookEntry{Entry: e, Fields: enc.Fields})
+}
+
+func (c *hookCore) Sync() error {
+	if s, ok := c.hook.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+
+	return nil
+}
+
+// MemoryHook is a Hook that keeps the entries in memory, for tests
+type MemoryHook struct {
+	mu      sync.Mutex
+	entries []HookEntry
+}
+
+func (h *MemoryHook) Fire(e HookEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = append(h.entries, e)
+	return nil
+}
+
+// Entries returns the entries received by the hook
+func (h *MemoryHook) Entries() []HookEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]HookEntry(nil), h.entries...)
+}
+
+// Reset removes the entries received by the hook
+func (h *MemoryHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = nil
+}
+
+// snsHookTimeout limits how long an entry takes to be published by the SNSHook
+const snsHookTimeout = 3 * time.Second
+
+// snsSubjectSize is the max size of the subject of an SNS message
+const snsSubjectSize = 100
+
+const (
+	// DefaultSNSHookQueueSize is the number of alerts an SNSHook queues while they are published
+	DefaultSNSHookQueueSize = 100
+	// DefaultSNSHookSyncTimeout is how long the Sync of an SNSHook waits for the queued alerts
+	DefaultSNSHookSyncTimeout = 3 * time.Second
+	// snsHookMaxKeys is the number of distinct logger and message pairs an SNSHook aggregates
+	snsHookMaxKeys = 1000
+)
+
+// SNSAlert is the message published by SNSHook
+type SNSAlert struct {
+	Level      string                 `json:"level"`
+	Time       time.Time              `json:"time"`
+	Logger     string                 `json:"logger,omitempty"`
+	Message    string                 `json:"message"`
+	Caller     string                 `json:"caller,omitempty"`
+	Stacktrace string                 `json:"stacktrace,omitempty"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	// Repeated is the number of entries with the same logger and message that were not published
+	// since the previous alert, because they were logged within the interval of the hook
+	Repeated int `json:"repeated,omitempty"`
+	// Dropped is the number of alerts that were not published since the previous alert, because
+	// the queue of the hook was full
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// SNSHookOption configures an SNSHook
+type SNSHookOption func(h *SNSHook)
+
+// WithSNSHookQueueSize sets how many alerts are queued while they are published. Alerts fired
+// while the queue is full are dropped, and counted in the Dropped of the next alert.
+func WithSNSHookQueueSize(size int) SNSHookOption {
+	return func(h *SNSHook) { h.queueSize = size }
+}
+
+// WithSNSHookSyncTimeout sets how long Sync waits for the queued alerts to be published, so a slow
+// SNS doesn't hold a shutdown. Defaults to DefaultSNSHookSyncTimeout.
+func WithSNSHookSyncTimeout(timeout time.Duration) SNSHookOption {
+	return func(h *SNSHook) { h.syncTimeout = timeout }
+}
+
+// WithSNSHookErrorHandler passes the errors of publishing the alerts to `onError`. By default they
+// are written to stderr, as the logger can not log them without firing the hook again.
+func WithSNSHookErrorHandler(onError func(error)) SNSHookOption {
+	return func(h *SNSHook) { h.onError = onError }
+}
+
+// SNSHook is a Hook that publishes the entries to an SNS topic as an SNSAlert. Entries with the
+// same logger and message are published at most once per interval, and the ones in between are
+// counted in the Repeated of the next alert. Up to 1000 pairs of logger and message are counted;
+// when there are more, the ones that were published the longest ago are forgotten.
+//
+// Fire doesn't wait for the alerts to be published: they are queued and published in order by a
+// goroutine of the hook. Sync waits for the queued alerts, up to the sync timeout, and the loggers
+// of WithHook call it when they are synced.
+type SNSHook struct {
+	publisher   awsclient.Publisher
+	topicARN    string
+	interval    time.Duration
+	queueSize   int
+	syncTimeout time.Duration
+	onError     func(error)
+	queue       chan awsclient.SNSMessage
+	done        chan struct{}
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	dropped int
+	closed  bool
+	seen    map[string]*snsHookKey
+}
+
+// snsHookKey is the aggregation state of a logger and message pair
+type snsHookKey struct {
+	last     time.Time
+	repeated int
+}
+
+// NewSNSHook creates an SNSHook publishing to `topicARN` with `publisher`, such as the SNS of
+// aws.Config.Clients. An `interval` of 0 publishes every entry.
+func NewSNSHook(publisher awsclient.Publisher, topicARN string, interval time.Duration, opts ...SNSHookOption) *SNSHook {
+	h := &SNSHook{
+		publisher:   publisher,
+		topicARN:    topicARN,
+		interval:    interval,
+		queueSize:   DefaultSNSHookQueueSize,
+		syncTimeout: DefaultSNSHookSyncTimeout,
+		onError: func(err error) {
+			fmt.Fprintf(os.Stderr, "%v SNSHook publish error: %v\n", time.Now(), err)
+		},
+		done: make(chan struct{}),
+		seen: map[string]*snsHookKey{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.idle = sync.NewCond(&h.mu)
+	h.queue = make(chan awsclient.SNSMessage, h.queueSize)
+
+	go h.publish()
+
+	return h
+}
+
+func (h *SNSHook) Fire(e HookEntry) error {
+	repeated, ok := h.aggregate(e)
+	if !ok {
+		return nil
+	}
+
+	alert := SNSAlert{
+		Level:      e.Level.String(),
+		Time:       e.Time,
+		Logger:     e.LoggerName,
+		Message:    e.Message,
+		Stacktrace: e.Stack,
+		Fields:     e.Fields,
+		Repeated:   repeated,
+	}
+	if e.Caller.Defined {
+		alert.Caller = e.Caller.TrimmedPath()
+	}
+
+	// SNS rejects empty attributes, so the logger is only set for named loggers
+	attrs := map[string]string{"level": alert.Level}
+	if alert.Logger != "" {
+		attrs["logger"] = alert.Logger
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrHookClosed
+	}
+
+	alert.Dropped = h.dropped
+	select {
+	case h.queue <- awsclient.SNSMessage{TopicARN: h.topicARN, Message: alert, Subject: snsSubject(e), Attributes: attrs}:
+		h.pending++
+		h.dropped = 0
+	default:
+		h.dropped++
+	}
+
+	return nil
+}
+
+// publish publishes the queued alerts until the hook is closed
+func (h *SNSHook) publish() {
+	defer close(h.done)
+
+	for msg := range h.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), snsHookTimeout)
+		_, err := h.publisher.Publish(ctx, msg)
+		cancel()
+		if err != nil && h.onError != nil {
+			h.onError(err)
+		}
+
+		h.mu.Lock()
+		if h.pending--; h.pending == 0 {
+			h.idle.Broadcast()
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Sync waits for the queued alerts to be published. If they are not published within the sync
+// timeout, it returns an error that matches context.DeadlineExceeded and the alerts are left in
+// the queue.
+func (h *SNSHook) Sync() error {
+	deadline := time.Now().Add(h.syncTimeout)
+	// wake up the wait below when the timeout is over
+	t := time.AfterFunc(h.syncTimeout, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.idle.Broadcast()
+	})
+	defer t.Stop()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for h.pending > 0 {
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%d SNS alerts were not published: %w", h.pending, context.DeadlineExceeded)
+		}
+		h.idle.Wait()
+	}
+
+	return nil
+}
+
+// Close publishes the queued alerts and stops the hook. Entries fired after Close return
+// ErrHookClosed.
+func (h *SNSHook) Close() error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.mu.Unlock()
+
+	<-h.done
+	return nil
+}
+
+// aggregate reports whether `e` should be published, and how many of the same entries were not
+func (h *SNSHook) aggregate(e HookEntry) (repeated int, publish bool) {
+	if h.interval <= 0 {
+		return 0, true
+	}
+
+	key := e.LoggerName + "\x00" + e.Message
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	k, ok := h.seen[key]
+	if ok && e.Time.Sub(k.last) < h.interval {
+		k.repeated++
+		return 0, false
+	}
+
+	if !ok {
+		if len(h.seen) >= snsHookMaxKeys {
+			h.evict(e.Time)
+		}
+		k = &snsHookKey{}
+		h.seen[key] = k
+	}
+
+	repeated = k.repeated
+	k.last, k.repeated = e.Time, 0
+
+	return repeated, true
+}
+
+// evict forgets the keys whose interval ended before `now` and had no repetitions, or else the
+// key published the longest ago
+func (h *SNSHook) evict(now time.Time) {
+	var oldest string
+	for key, k := range h.seen {
+		if k.repeated == 0 && now.Sub(k.last) >= h.interval {
+			delete(h.seen, key)
+			continue
+		}
+		if oldest == "" || k.last.Before(h.seen[oldest].last) {
+			oldest = key
+		}
+	}
+
+	if len(h.seen) >= snsHookMaxKeys {
+		delete(h.seen, oldest)
+	}
+}
+
+// snsSubject returns a subject for the alert of `e`, which must be a single line of at most 100
+// printable ASCII characters. Whitespace is collapsed into spaces and other control characters are
+// removed.
+func snsSubject(e HookEntry) string {
+	subject := strings.ToUpper(e.Level.String()) + ": " + e.Message
+	subject = strings.Join(strings.Fields(subject), " ")
+	subject = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		if r > '~' {
+			return '?'
+		}
+		return r
+	}, subject)
+
+	if r := []rune(subject); len(r) > snsSubjectSize {
+		subject = string(r[:snsSubjectSize-3]) + "..."
+	}
+
+	return subject
+}
@@ -0,0 +1,216 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/credifranco/stori-utils-go/aws/awsclient"
+	"github.com/credifranco/stori-utils-go/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// awsclient.Publisher recording the published messages. If block is set, Publish signals started
+// and waits for block to be closed.
+type mockPublisher struct {
+	awsclient.Publisher
+	mu      sync.Mutex
+	msgs    []awsclient.SNSMessage
+	err     error
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (m *mockPublisher) Publish(_ context.Context, msg awsclient.SNSMessage) (string, error) {
+	if m.block != nil {
+		m.started <- struct{}{}
+		<-m.block
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.msgs = append(m.msgs, msg)
+	return "message-id", m.err
+}
+
+func (m *mockPublisher) published() []awsclient.SNSMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]awsclient.SNSMessage(nil), m.msgs...)
+}
+
+func TestHook(t *testing.T) {
+	a := assert.New(t)
+	hook := &log.MemoryHook{}
+
+	l := newTestLogger(t, log.WithHook(zap.ErrorLevel, hook)).Named("payments").With("account", "1")
+	l.Infow("created")
+	l.Errorw("declined", log.ErrorField(errors.New("card declined")), "email", "jane@stori.mx")
+
+	entries := hook.Entries()
+	if a.Len(entries, 1, "only errors should be forwarded") {
+		e := entries[0]
+		a.Equal("declined", e.Message)
+		a.Equal("payments", e.LoggerName)
+		a.Contains(e.Stack, "TestHook", "errors should have a stack trace")
+		a.Equal("1", e.Fields["account"])
+		a.Equal("[REDACTED]", e.Fields["email"], "hooks should receive redacted fields")
+		a.Equal("card declined", e.Fields["error"].(map[string]interface{})["message"])
+	}
+
+	hook.Reset()
+	l = newTestLogger(t, log.WithHook(zap.ErrorLevel, hook), log.WithStacktraceLevel(zap.FatalLevel))
+	l.Errorw("declined")
+	if entries = hook.Entries(); a.Len(entries, 1) {
+		a.Empty(entries[0].Stack)
+	}
+}
+
+func TestSNSHook(t *testing.T) {
+	a := assert.New(t)
+	pub := &mockPublisher{}
+	var errs []error
+	hook := log.NewSNSHook(pub, "arn:aws:sns:us-east-1:123456789012:alerts", time.Minute,
+		log.WithSNSHookErrorHandler(func(err error) { errs = append(errs, err) }))
+	defer hook.Close()
+
+	now := time.Now()
+	entry := func(msg string, at time.Duration) log.HookEntry {
+		return log.HookEntry{
+			Entry:  zapcore.Entry{Level: zap.ErrorLevel, Time: now.Add(at), LoggerName: "payments", Message: msg},
+			Fields: map[string]interface{}{"id": "1"},
+		}
+	}
+
+	a.NoError(hook.Fire(entry("declined", 0)))
+	a.NoError(hook.Fire(entry("declined", time.Second)))
+	a.NoError(hook.Fire(entry("declined", 2*time.Second)))
+	a.NoError(hook.Fire(entry("timeout", 3*time.Second)))
+	a.NoError(hook.Fire(entry("declined", time.Minute)))
+	a.NoError(hook.Sync())
+
+	msgs := pub.published()
+	if a.Len(msgs, 3, "repeated entries should be aggregated") {
+		a.Equal("arn:aws:sns:us-east-1:123456789012:alerts", msgs[0].TopicARN)
+		a.Equal("ERROR: declined", msgs[0].Subject)
+		a.Equal(map[string]string{"level": "error", "logger": "payments"}, msgs[0].Attributes)
+
+		alert := msgs[2].Message.(log.SNSAlert)
+		a.Equal("declined", alert.Message)
+		a.Equal(2, alert.Repeated)
+		a.Equal(map[string]interface{}{"id": "1"}, alert.Fields)
+	}
+
+	a.NoError(hook.Fire(entry("tarjeta\x00 bloqueada\x1b[31m\u0085", 2*time.Minute)))
+	a.NoError(hook.Sync())
+	a.Equal("ERROR: tarjeta bloqueada[31m", pub.published()[3].Subject, "control characters should be removed")
+
+	pub.err = errors.New("throttled")
+	a.NoError(hook.Fire(entry(strings.Repeat("pago rechazado\n", 10), 0)))
+	a.NoError(hook.Sync())
+	a.Equal([]error{pub.err}, errs, "publish errors should be passed to the error handler")
+	subject := pub.published()[4].Subject
+	a.Len(subject, 100)
+	a.NotContains(subject, "\n")
+
+	a.NoError(hook.Close())
+	a.ErrorIs(hook.Fire(entry("closed", 0)), log.ErrHookClosed)
+}
+
+func TestSNSHookUnnamedLogger(t *testing.T) {
+	a := assert.New(t)
+	pub := &mockPublisher{}
+	hook := log.NewSNSHook(pub, "arn:aws:sns:us-east-1:123456789012:alerts", time.Minute)
+	defer hook.Close()
+
+	l := newTestLogger(t, log.WithHook(zap.ErrorLevel, hook))
+	l.Errorw("declined")
+	_ = l.Sync() // waits for the alerts
+
+	if msgs := pub.published(); a.Len(msgs, 1) {
+		a.Equal(map[string]string{"level": "error"}, msgs[0].Attributes, "empty attributes should be omitted")
+	}
+}
+
+func TestSNSHookQueue(t *testing.T) {
+	a := assert.New(t)
+	pub := &mockPublisher{started: make(chan struct{}, 10), block: make(chan struct{})}
+	hook := log.NewSNSHook(pub, "arn:aws:sns:us-east-1:123456789012:alerts", 0, log.WithSNSHookQueueSize(1))
+	defer hook.Close()
+
+	entry := func(msg string) log.HookEntry {
+		return log.HookEntry{Entry: zapcore.Entry{Level: zap.ErrorLevel, Time: time.Now(), Message: msg}}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- hook.Fire(entry("publishing")) }()
+	<-pub.started
+	a.NoError(<-done, "Fire should not wait for the alert to be published")
+
+	a.NoError(hook.Fire(entry("queued")))
+	a.NoError(hook.Fire(entry("dropped")))
+	a.NoError(hook.Fire(entry("dropped")))
+	close(pub.block)
+	a.NoError(hook.Sync())
+
+	a.NoError(hook.Fire(entry("after")))
+	a.NoError(hook.Sync())
+
+	msgs := pub.published()
+	if a.Len(msgs, 3) {
+		a.Equal("queued", msgs[1].Message.(log.SNSAlert).Message)
+		alert := msgs[2].Message.(log.SNSAlert)
+		a.Equal("after", alert.Message)
+		a.Equal(2, alert.Dropped)
+	}
+}
+
+func TestSNSHookSyncTimeout(t *testing.T) {
+	a := assert.New(t)
+	pub := &mockPublisher{started: make(chan struct{}, 1), block: make(chan struct{})}
+	hook := log.NewSNSHook(pub, "arn:aws:sns:us-east-1:123456789012:alerts", 0, log.WithSNSHookSyncTimeout(50*time.Millisecond))
+	defer hook.Close()
+
+	a.NoError(hook.Fire(log.HookEntry{Entry: zapcore.Entry{Level: zap.ErrorLevel, Time: time.Now(), Message: "declined"}}))
+	<-pub.started
+
+	start := time.Now()
+	err := hook.Sync()
+	a.ErrorIs(err, context.DeadlineExceeded, "Sync should not wait for a slow publish")
+	a.Less(time.Since(start), time.Second)
+
+	close(pub.block)
+	a.NoError(hook.Sync())
+	a.Len(pub.published(), 1)
+}
+
+func TestSNSHookEviction(t *testing.T) {
+	a := assert.New(t)
+	pub := &mockPublisher{}
+	hook := log.NewSNSHook(pub, "arn:aws:sns:us-east-1:123456789012:alerts", time.Minute, log.WithSNSHookQueueSize(2000))
+	defer hook.Close()
+
+	now := time.Now()
+	entry := func(msg string, at time.Duration) log.HookEntry {
+		return log.HookEntry{Entry: zapcore.Entry{Level: zap.ErrorLevel, Time: now.Add(at), Message: msg}}
+	}
+
+	for i := 0; i <= 1000; i++ {
+		a.NoError(hook.Fire(entry(fmt.Sprintf("order %d declined", i), time.Duration(i)*time.Millisecond)))
+	}
+	a.NoError(hook.Fire(entry("order 1000 declined", 2*time.Second)))
+	a.NoError(hook.Fire(entry("order 0 declined", 2*time.Second)))
+	a.NoError(hook.Sync())
+
+	msgs := pub.published()
+	a.Len(msgs, 1002, "the oldest entry should be forgotten, and the newest aggregated")
+	a.Equal("order 0 declined", msgs[len(msgs)-1].Message.(log.SNSAlert).Message)
+}
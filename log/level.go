@@ -0,0 +1,260 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelEnv is the env variable with the level spec of NewLogger
+const LevelEnv = "LOG_LEVEL"
+
+// ParseLevel parses a level name, ignoring case: debug, info, warn, error, dpanic, panic or fatal
+func ParseLevel(s string) (zapcore.Level, error) {
+	var l zapcore.Level
+	text := strings.ToLower(strings.TrimSpace(s))
+	// zap takes an empty level as info
+	if text == "" || l.UnmarshalText([]byte(text)) != nil {
+		return l, fmt.Errorf("invalid log level %q", s)
+	}
+
+	return l, nil
+}
+
+// Levels are the levels of a logger and of its named loggers, which can be changed at runtime.
+// They are set with a spec like `info,db=debug,api=warn`, where the item without a name is the
+// default level. Named loggers use the level of the longest name that is a prefix of theirs, so
+// `db` also applies to `db.pool`.
+type Levels struct {
+	def zap.AtomicLevel
+	// names is an immutable map[string]zapcore.Level, replaced on every Set
+	names atomic.Value
+	mu    sync.Mutex
+}
+
+// NewLevels creates the Levels of `spec`. An empty spec is the info level.
+func NewLevels(spec string) (*Levels, error) {
+	l := &Levels{def: zap.NewAtomicLevel()}
+	l.names.Store(map[string]zapcore.Level{})
+
+	if err := l.Set(spec); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Default returns the AtomicLevel of the loggers without a level for their name. It can be used
+// directly, such as with its zap ServeHTTP handler.
+func (l *Levels) Default() zap.AtomicLevel {
+	return l.def
+}
+
+// Set replaces the levels with the ones of `spec`. The default level is only changed if `spec`
+// has one. Nothing is changed if `spec` is invalid.
+func (l *Levels) Set(spec string) error {
+	def, hasDef, names, err := parseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if hasDef {
+		l.def.SetLevel(def)
+	}
+	l.names.Store(names)
+
+	return nil
+}
+
+// Level returns the level of the logger named `name`
+func (l *Levels) Level(name string) zapcore.Level {
+	names := l.names.Load().(map[string]zapcore.Level)
+	for name != "" {
+		if lvl, ok := names[name]; ok {
+			return lvl
+		}
+
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+
+	return l.def.Level()
+}
+
+// Enabled reports whether `lvl` is enabled for any logger
+func (l *Levels) Enabled(lvl zapcore.Level) bool {
+	if l.def.Enabled(lvl) {
+		return true
+	}
+
+	for _, nl := range l.names.Load().(map[string]zapcore.Level) {
+		if nl.Enabled(lvl) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the spec of the levels
+func (l *Levels) String() string {
+	names := l.names.Load().(map[string]zapcore.Level)
+
+	items := make([]string, 0, len(names))
+	for name, lvl := range names {
+		items = append(items, name+"="+lvl.String())
+	}
+	sort.Strings(items)
+
+	return strings.Join(append([]string{l.def.Level().String()}, items...), ",")
+}
+
+// levelsPayload is the body of the Levels HTTP handler
+type levelsPayload struct {
+	Level string `json:"level"`
+}
+
+// ServeHTTP returns the spec of the levels as {"level":"info,db=debug"} on GET requests, and sets
+// it from the same JSON body on PUT requests
+func (l *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var p levelsPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeLevelsError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		if err := l.Set(p.Level); err != nil {
+			writeLevelsError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		writeLevelsError(w, http.StatusMethodNotAllowed, "only GET and PUT are supported")
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(levelsPayload{Level: l.String()})
+}
+
+func writeLevelsError(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
+
+// LevelSource returns the current level spec, such as from an env variable or a parameter store
+type LevelSource func(ctx context.Context) (string, error)
+
+// EnvLevelSource reads the level spec from the env variable `key`
+func EnvLevelSource(key string) LevelSource {
+	return func(context.Context) (string, error) {
+		return os.Getenv(key), nil
+	}
+}
+
+// Watch sets the levels from `source` every `interval` until `ctx` is done. Errors of the source
+// and invalid specs keep the current levels, and are passed to `onError` if it is not nil.
+func (l *Levels) Watch(ctx context.Context, interval time.Duration, source LevelSource, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		spec, err := source(ctx)
+		if err == nil && spec != last {
+			if err = l.Set(spec); err == nil {
+				last = spec
+			}
+		}
+
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// parseLevelSpec parses a spec like `info,db=debug`
+func parseLevelSpec(spec string) (def zapcore.Level, hasDef bool, names map[string]zapcore.Level, err error) {
+	names = map[string]zapcore.Level{}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, level := "", item
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			name, level = strings.TrimSpace(item[:i]), item[i+1:]
+			if name == "" {
+				return def, false, nil, fmt.Errorf("invalid log level spec %q: missing logger name", spec)
+			}
+		}
+
+		lvl, err := ParseLevel(level)
+		if err != nil {
+			return def, false, nil, fmt.Errorf("invalid log level spec %q: %w", spec, err)
+		}
+
+		if name == "" {
+			def, hasDef = lvl, true
+			continue
+		}
+		names[name] = lvl
+	}
+
+	return def, hasDef, names, nil
+}
+
+// levelCore is a zapcore.Core that filters entries with the level of their logger name
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+// newLevelCore wraps `core`, which should enable every level, to filter its entries with `levels`
+func newLevelCore(core zapcore.Core, levels *Levels) zapcore.Core {
+	return &levelCore{Core: core, levels: levels}
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.levels.Enabled(lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.Level(e.LoggerName).Enabled(e.Level) {
+		return ce
+	}
+
+	return c.Core.Check(e, ce)
+}
@@ -0,0 +1,132 @@
+package log_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/credifranco/stori-utils-go/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseLevel(t *testing.T) {
+	a := assert.New(t)
+
+	for s, want := range map[string]zapcore.Level{
+		"debug": zap.DebugLevel, "INFO": zap.InfoLevel, "Warn": zap.WarnLevel, "error": zap.ErrorLevel,
+		"dpanic": zap.DPanicLevel, "PANIC": zap.PanicLevel, " fatal ": zap.FatalLevel,
+	} {
+		lvl, err := log.ParseLevel(s)
+		a.NoError(err)
+		a.Equal(want, lvl, s)
+	}
+
+	_, err := log.ParseLevel("verbose")
+	a.Error(err)
+}
+
+func TestLevels(t *testing.T) {
+	a := assert.New(t)
+
+	levels, err := log.NewLevels("warn, db=debug,db.pool=error,api=info")
+	a.NoError(err)
+	a.Equal(zap.WarnLevel, levels.Level(""))
+	a.Equal(zap.WarnLevel, levels.Level("redis"))
+	a.Equal(zap.DebugLevel, levels.Level("db"))
+	a.Equal(zap.DebugLevel, levels.Level("db.query"))
+	a.Equal(zap.ErrorLevel, levels.Level("db.pool.conn"))
+	a.Equal(zap.InfoLevel, levels.Level("api"))
+	a.True(levels.Enabled(zap.DebugLevel), "debug should be enabled for the db logger")
+	a.Equal("warn,api=info,db.pool=error,db=debug", levels.String())
+
+	// specs without a default keep the default level
+	a.NoError(levels.Set("api=debug"))
+	a.Equal(zap.WarnLevel, levels.Level(""))
+	a.Equal(zap.WarnLevel, levels.Level("db"))
+	a.Equal(zap.DebugLevel, levels.Level("api"))
+
+	for _, spec := range []string{"verbose", "db=", "=debug"} {
+		a.Error(levels.Set(spec), spec)
+	}
+	a.Equal(zap.DebugLevel, levels.Level("api"), "invalid specs should not change the levels")
+
+	levels.Default().SetLevel(zap.ErrorLevel)
+	a.Equal(zap.ErrorLevel, levels.Level("db"))
+}
+
+func TestLevelsHandler(t *testing.T) {
+	a := assert.New(t)
+	levels, _ := log.NewLevels("info")
+
+	rec := httptest.NewRecorder()
+	levels.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level":"debug,db=warn"}`)))
+	a.Equal(http.StatusOK, rec.Code)
+	a.JSONEq(`{"level":"debug,db=warn"}`, rec.Body.String())
+	a.Equal(zap.WarnLevel, levels.Level("db"))
+
+	rec = httptest.NewRecorder()
+	levels.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level":"loud"}`)))
+	a.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	levels.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/level", nil))
+	a.JSONEq(`{"level":"debug,db=warn"}`, rec.Body.String())
+}
+
+func TestLevelsWatch(t *testing.T) {
+	a := assert.New(t)
+	levels, _ := log.NewLevels("info")
+
+	var spec atomic.Value
+	spec.Store("info")
+	var errs int32
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		levels.Watch(ctx, time.Millisecond, func(context.Context) (string, error) {
+			return spec.Load().(string), nil
+		}, func(error) { atomic.AddInt32(&errs, 1) })
+		close(done)
+	}()
+
+	spec.Store("db=debug")
+	a.Eventually(func() bool { return levels.Level("db") == zap.DebugLevel }, time.Second, time.Millisecond)
+
+	spec.Store("nope")
+	a.Eventually(func() bool { return atomic.LoadInt32(&errs) > 0 }, time.Second, time.Millisecond)
+	a.Equal(zap.DebugLevel, levels.Level("db"))
+
+	cancel()
+	<-done
+}
+
+func TestNewLoggerWithLevels(t *testing.T) {
+	a := assert.New(t)
+	if val, ok := os.LookupEnv(log.LevelEnv); ok {
+		t.Cleanup(func() { os.Setenv(log.LevelEnv, val) })
+	} else {
+		t.Cleanup(func() { os.Unsetenv(log.LevelEnv) })
+	}
+
+	os.Setenv(log.LevelEnv, "error,db=debug")
+	l, levels, err := log.NewLoggerWithLevels()
+	a.NoError(err)
+	a.False(l.Desugar().Check(zap.InfoLevel, "info") != nil, "info should be disabled by default")
+	a.NotNil(l.Named("db").Desugar().Check(zap.DebugLevel, "debug"), "debug should be enabled for db")
+
+	levels.Default().SetLevel(zap.InfoLevel)
+	a.NotNil(l.Desugar().Check(zap.InfoLevel, "info"), "levels should change at runtime")
+
+	os.Setenv(log.LevelEnv, "loud")
+	_, levels, err = log.NewLoggerWithLevels()
+	a.NoError(err, "invalid levels should not fail")
+	a.Equal(zap.InfoLevel, levels.Level(""))
+}
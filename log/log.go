@@ -2,7 +2,6 @@ package log
 
 import (
 	"os"
-	"strings"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -31,32 +30,46 @@ func NewLoggerConfig(level zap.AtomicLevel) zap.Config {
 	return cfg
 }
 
-func NewLogger() (*zap.SugaredLogger, error) {
-
-	// Get log level from environment variable
-	var level zap.AtomicLevel
-	if ll, ok := os.LookupEnv("LOG_LEVEL"); ok {
-		switch strings.ToLower(ll) {
-		case "debug":
-			level = zap.NewAtomicLevelAt(zap.DebugLevel)
-		case "info":
-			level = zap.NewAtomicLevelAt(zap.InfoLevel)
-		case "warn":
-			level = zap.NewAtomicLevelAt(zap.WarnLevel)
-		case "error":
-			level = zap.NewAtomicLevelAt(zap.ErrorLevel)
-		default:
-			level = zap.NewAtomicLevelAt(zap.InfoLevel)
-		}
-	} else {
-		level = zap.NewAtomicLevelAt(zap.InfoLevel)
+// NewLogger creates a JSON logger with the levels of the LOG_LEVEL env variable. Sensitive values
+// are redacted with DefaultRedactionRules, unless changed with WithRedactionRules or
+// WithoutRedaction. The format and outputs of the logger are set by the
+// LOG_* env variables, or by `opts`. See NewLoggerWithLevels.
+func NewLogger(opts ...Option) (*zap.SugaredLogger, error) {
+	logger, _, err := NewLoggerWithLevels(opts...)
+	return logger, err
+}
+
+// NewLoggerWithLevels is NewLogger, also returning the Levels of the logger to change them at
+// runtime. LOG_LEVEL is a level spec like `info,db=debug`, see Levels. If it is invalid the info
+// level is used, and a warning is logged like for the other invalid env variables.
+func NewLoggerWithLevels(opts ...Option) (*zap.SugaredLogger, *Levels, error) {
+	levels, specErr := NewLevels(os.Getenv(LevelEnv))
+	if specErr != nil {
+		levels, _ = NewLevels("")
+	}
+
+	envOpts, envErrs := envOptions()
+	if specErr != nil {
+		envErrs = append([]error{specErr}, envErrs...)
 	}
 
-	cfg := NewLoggerConfig(level)
-	logger, err := cfg.Build()
+	var o options
+	for _, opt := range append(envOpts, opts...) {
+		opt(&o)
+	}
+
+	// the level core filters the entries, so the config enables every level
+	cfg := NewLoggerConfig(zap.NewAtomicLevelAt(zapcore.DebugLevel))
+	o.apply(&cfg)
+	logger, err := cfg.Build(o.buildOptions(levels)...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	sugar := logger.Sugar()
+	for _, err := range envErrs {
+		sugar.Warnw("invalid log env variable, using the default", "err", err)
 	}
 
-	return logger.Sugar(), nil
+	return sugar, levels, nil
 }
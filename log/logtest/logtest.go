@@ -0,0 +1,272 @@
+// Package logtest provides a logger that keeps its entries in memory, so tests can assert what a
+// handler logged. The logger can be used as the Logger of api.StoriServices.
+package logtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/credifranco/stori-utils-go/log"
+)
+
+// Option configures New
+type Option func(*options)
+
+type options struct {
+	level  zapcore.LevelEnabler
+	rules  log.RedactionRules
+	redact bool
+}
+
+// WithLevel keeps only the entries of `level` and above. All levels are kept by default.
+func WithLevel(level zapcore.LevelEnabler) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithRedactionRules redacts the entries with `rules` instead of log.DefaultRedactionRules
+func WithRedactionRules(rules log.RedactionRules) Option {
+	return func(o *options) {
+		o.rules = rules
+		o.redact = true
+	}
+}
+
+// WithoutRedaction keeps the entries as they were logged
+func WithoutRedaction() Option {
+	return func(o *options) {
+		o.redact = false
+	}
+}
+
+// New returns a logger that keeps its entries in memory, and the Logs to inspect them. Like the
+// loggers of log.NewLogger, the entries are redacted with log.DefaultRedactionRules. The logger is
+// synced when the test finishes.
+func New(t testing.TB, opts ...Option) (*zap.SugaredLogger, *Logs) {
+	o := options{level: zapcore.DebugLevel, rules: log.DefaultRedactionRules(), redact: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	core, observed := observer.New(o.level)
+	mask := ""
+	if o.redact {
+		core = log.NewRedactingCore(core, o.rules)
+		if mask = o.rules.Mask; mask == "" {
+			mask = log.DefaultMask
+		}
+	}
+
+	logger := zap.New(core, zap.AddCaller()).Sugar()
+	t.Cleanup(func() { _ = logger.Sync() })
+
+	return logger, &Logs{observed: observed, mask: mask}
+}
+
+// Logs are the entries written by a logger created with New. The filters return the matching
+// entries as new Logs, so they can be chained:
+//
+//	logs.Level(zap.ErrorLevel).Message("error creating transfer").Field("account_id", "1").Len()
+type Logs struct {
+	observed *observer.ObservedLogs
+	mask     string
+}
+
+// All returns the entries in the order they were logged
+func (l *Logs) All() []observer.LoggedEntry {
+	return l.observed.All()
+}
+
+// Len returns the number of entries
+func (l *Logs) Len() int {
+	return l.observed.Len()
+}
+
+// TakeAll returns the entries and removes them. Entries of filtered Logs are only removed from
+// the filtered Logs.
+func (l *Logs) TakeAll() []observer.LoggedEntry {
+	return l.observed.TakeAll()
+}
+
+// Messages returns the messages of the entries
+func (l *Logs) Messages() []string {
+	var msgs []string
+	for _, e := range l.All() {
+		msgs = append(msgs, e.Message)
+	}
+
+	return msgs
+}
+
+// Filter returns the entries for which `keep` returns true
+func (l *Logs) Filter(keep func(e observer.LoggedEntry) bool) *Logs {
+	return &Logs{observed: l.observed.Filter(keep), mask: l.mask}
+}
+
+// Level returns the entries of exactly `level`
+func (l *Logs) Level(level zapcore.Level) *Logs {
+	return l.Filter(func(e observer.LoggedEntry) bool { return e.Level == level })
+}
+
+// AtLeast returns the entries of `level` and above
+func (l *Logs) AtLeast(level zapcore.Level) *Logs {
+	return l.Filter(func(e observer.LoggedEntry) bool { return e.Level >= level })
+}
+
+// Message returns the entries with the message `msg`
+func (l *Logs) Message(msg string) *Logs {
+	return l.Filter(func(e observer.LoggedEntry) bool { return e.Message == msg })
+}
+
+// MessageContains returns the entries whose message contains `s`
+func (l *Logs) MessageContains(s string) *Logs {
+	return l.Filter(func(e observer.LoggedEntry) bool { return strings.Contains(e.Message, s) })
+}
+
+// Logger returns the entries of the logger named `name`
+func (l *Logs) Logger(name string) *Logs {
+	return l.Filter(func(e observer.LoggedEntry) bool { return e.LoggerName == name })
+}
+
+// HasField returns the entries with the field `key`, added when logging or to the logger
+func (l *Logs) HasField(key string) *Logs {
+	return l.Filter(func(e observer.LoggedEntry) bool {
+		_, ok := e.ContextMap()[key]
+		return ok
+	})
+}
+
+// Field returns the entries with the field `key` set to `value`. The values are compared by their
+// JSON encoding, so Field("id", 1) matches the fields logged as int, int64 or uint.
+func (l *Logs) Field(key string, value interface{}) *Logs {
+	want, err := json.Marshal(value)
+	if err != nil {
+		return l.Filter(func(observer.LoggedEntry) bool { return false })
+	}
+
+	return l.Filter(func(e observer.LoggedEntry) bool {
+		v, ok := e.ContextMap()[key]
+		if !ok {
+			return false
+		}
+		got, err := json.Marshal(v)
+		return err == nil && string(got) == string(want)
+	})
+}
+
+// AssertLogged checks that an entry with the message `msg` was logged
+func (l *Logs) AssertLogged(t testing.TB, msg string) bool {
+	t.Helper()
+
+	if l.Message(msg).Len() == 0 {
+		t.Errorf("no entry with the message %q was logged, got: %q", msg, l.Messages())
+		return false
+	}
+
+	return true
+}
+
+// AssertNotLogged checks that no entry with the message `msg` was logged
+func (l *Logs) AssertNotLogged(t testing.TB, msg string) bool {
+	t.Helper()
+
+	if n := l.Message(msg).Len(); n > 0 {
+		t.Errorf("%d entries with the message %q were logged", n, msg)
+		return false
+	}
+
+	return true
+}
+
+// AssertRedacted checks that none of the `values`, like an email or a card number, are in the
+// messages or in the strings and numbers of the fields of the entries
+func (l *Logs) AssertRedacted(t testing.TB, values ...string) bool {
+	t.Helper()
+
+	ok := true
+	for _, e := range l.All() {
+		fields, err := decodedFields(e)
+		if err != nil {
+			t.Errorf("error encoding the fields of %q: %v", e.Message, err)
+			return false
+		}
+
+		for _, v := range values {
+			if strings.Contains(e.Message, v) || containsValue(fields, v) {
+				t.Errorf("%q was not redacted from the entry %q: %v", v, e.Message, fields)
+				ok = false
+			}
+		}
+	}
+
+	return ok
+}
+
+// decodedFields returns the fields of `e` encoded and decoded as JSON, so that structs are
+// compared by the values that would be logged
+func decodedFields(e observer.LoggedEntry) (interface{}, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(e.ContextMap()); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(&buf)
+	dec.UseNumber()
+	var fields interface{}
+	return fields, dec.Decode(&fields)
+}
+
+// containsValue reports if any string or number in `v` contains `s`
+func containsValue(v interface{}, s string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, x := range v {
+			if containsValue(x, s) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, x := range v {
+			if containsValue(x, s) {
+				return true
+			}
+		}
+	case string:
+		return strings.Contains(v, s)
+	case json.Number:
+		return strings.Contains(v.String(), s)
+	}
+
+	return false
+}
+
+// AssertFieldRedacted checks that the field `key` was logged, and that it was masked in every
+// entry that has it
+func (l *Logs) AssertFieldRedacted(t testing.TB, key string) bool {
+	t.Helper()
+
+	entries := l.HasField(key).All()
+	if len(entries) == 0 {
+		t.Errorf("no entry with the field %q was logged", key)
+		return false
+	}
+
+	ok := true
+	for _, e := range entries {
+		if v := e.ContextMap()[key]; l.mask == "" || v != l.mask {
+			t.Errorf("the field %q of the entry %q was not redacted: %v", key, e.Message, v)
+			ok = false
+		}
+	}
+
+	return ok
+}
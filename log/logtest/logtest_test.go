@@ -0,0 +1,105 @@
+package logtest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/credifranco/stori-utils-go/api"
+	"github.com/credifranco/stori-utils-go/api/apitest"
+	"github.com/credifranco/stori-utils-go/log"
+	"github.com/credifranco/stori-utils-go/log/logtest"
+)
+
+// testing.TB recording the failed assertions
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// handler logs the card of the request
+func handler(s api.StoriServices) api.APIGatewayHandlerFunc {
+	return func(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		logger := s.Logger.Named("cards").With("account_id", 1)
+		logger.Debugw("request", "body", e.Body)
+		logger.Errorw("card declined", "card_number", "4111111111111111", "email", "jane@stori.mx",
+			log.ErrorField(errors.New("insufficient funds")))
+
+		return api.JSONErrResponse(http.StatusPaymentRequired, "card declined")
+	}
+}
+
+func TestLogs(t *testing.T) {
+	a := assert.New(t)
+	logger, logs := logtest.New(t)
+	s, _ := apitest.NewStoriServices(t, api.WithLogger(logger))
+
+	_, err := handler(s)(context.Background(), events.APIGatewayProxyRequest{Body: `{"pan":"4111 1111 1111 1111"}`})
+	a.NoError(err)
+
+	a.Equal(2, logs.Len())
+	a.Equal([]string{"request", "card declined"}, logs.Messages())
+	a.Equal(1, logs.Level(zap.ErrorLevel).Len())
+	a.Equal(2, logs.AtLeast(zap.DebugLevel).Len())
+	a.Equal(1, logs.Message("card declined").Field("account_id", 1).Logger("cards").Len())
+	a.Equal(0, logs.Field("account_id", "1").Len(), "values should be compared by their JSON encoding")
+	a.Equal(1, logs.MessageContains("declined").HasField("error").Len())
+	a.Equal(1, logs.Field("error", map[string]interface{}{"message": "insufficient funds", "type": "*errors.errorString"}).Len())
+
+	a.True(logs.AssertLogged(t, "card declined"))
+	a.True(logs.AssertNotLogged(t, "card approved"))
+	a.True(logs.AssertRedacted(t, "4111111111111111", "4111 1111 1111 1111", "jane@stori.mx"))
+	a.True(logs.AssertFieldRedacted(t, "card_number"))
+
+	a.Len(logs.Level(zap.DebugLevel).TakeAll(), 1)
+	a.Equal(2, logs.Len(), "taking filtered entries should keep the others")
+	a.Len(logs.TakeAll(), 2)
+	a.Equal(0, logs.Len())
+}
+
+func TestLogsAssertionsFail(t *testing.T) {
+	a := assert.New(t)
+	logger, logs := logtest.New(t, logtest.WithoutRedaction(), logtest.WithLevel(zap.InfoLevel))
+
+	logger.Debugw("ignored")
+	logger.Infow("card declined", "card_number", "4111111111111111")
+	a.Equal(1, logs.Len())
+
+	rt := &recordingT{TB: t}
+	a.False(logs.AssertLogged(rt, "card approved"))
+	a.False(logs.AssertNotLogged(rt, "card declined"))
+	a.False(logs.AssertRedacted(rt, "4111111111111111"))
+	a.False(logs.AssertFieldRedacted(rt, "card_number"))
+	a.False(logs.AssertFieldRedacted(rt, "email"))
+	a.Len(rt.errors, 5)
+
+	// values that JSON escapes, in strings and nested in structs
+	logs.TakeAll()
+	logger.Infow("profile updated", "company", "Smith & <Sons>", "profile", struct {
+		Note string `json:"note"`
+	}{`said "hi"`})
+	a.False(logs.AssertRedacted(rt, "Smith & <Sons>"))
+	a.False(logs.AssertRedacted(rt, `said "hi"`))
+	a.Len(rt.errors, 7)
+}
+
+func TestRedactionRules(t *testing.T) {
+	a := assert.New(t)
+	logger, logs := logtest.New(t, logtest.WithRedactionRules(log.RedactionRules{Keys: []string{"nickname"}, Mask: "***"}))
+
+	logger.Infow("profile updated", "nickname", "jj", "email", "jane@stori.mx")
+	a.True(logs.AssertFieldRedacted(t, "nickname"))
+	a.Equal(1, logs.Field("email", "jane@stori.mx").Len(), "only the given rules should be applied")
+}
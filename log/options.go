@@ -0,0 +1,322 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Env variables read by NewLogger. Options passed to NewLogger take precedence over them.
+const (
+	// FormatEnv is the Encoding, json or console
+	FormatEnv = "LOG_FORMAT"
+	// TimeFormatEnv is the TimeEncoding: epoch, iso8601 or rfc3339nano
+	TimeFormatEnv = "LOG_TIME_FORMAT"
+	// ServiceEnv and VersionEnv default to the name and version of the Lambda function
+	ServiceEnv = "LOG_SERVICE"
+	VersionEnv = "LOG_VERSION"
+	// SamplingEnv is `initial,thereafter`, see WithSampling
+	SamplingEnv = "LOG_SAMPLING"
+	// OutputPathsEnv is a comma separated list of paths written besides stdout
+	OutputPathsEnv = "LOG_OUTPUT_PATHS"
+	// DevelopmentEnv enables the development mode when it is true
+	DevelopmentEnv = "LOG_DEVELOPMENT"
+	// StacktraceLevelEnv is the level of the entries with stack traces, see WithStacktraceLevel
+	StacktraceLevelEnv = "LOG_STACKTRACE_LEVEL"
+)
+
+// Encoding is the format of the log entries
+type Encoding string
+
+const (
+	EncodingJSON    = Encoding("json")
+	EncodingConsole = Encoding("console")
+)
+
+// TimeEncoding is the format of the time of the log entries. Entries have no time by default, as
+// CloudWatch already adds it.
+type TimeEncoding string
+
+const (
+	TimeEpoch       = TimeEncoding("epoch")
+	TimeISO8601     = TimeEncoding("iso8601")
+	TimeRFC3339Nano = TimeEncoding("rfc3339nano")
+)
+
+// TimeKey is the key of the time of the log entries, when a TimeEncoding is set
+const TimeKey = "time"
+
+// Keys of the default fields set with WithService
+const (
+	ServiceKey = "service"
+	VersionKey = "version"
+)
+
+// Option customizes the logger created by NewLogger
+type Option func(*options)
+
+type options struct {
+	encoding     Encoding
+	timeEncoding TimeEncoding
+	service      string
+	version      string
+	sampling     *zap.SamplingConfig
+	outputPaths  []string
+	development  bool
+	stacktrace   *zapcore.Level
+	hooks        []zapcore.Core
+	rules        *RedactionRules
+	noRedaction  bool
+}
+
+// WithEncoding sets the format of the log entries. Defaults to EncodingJSON, or EncodingConsole in
+// development mode.
+func WithEncoding(e Encoding) Option {
+	return func(o *options) { o.encoding = e }
+}
+
+// WithTimeEncoding adds the time of the entries with the TimeKey, in the format `t`
+func WithTimeEncoding(t TimeEncoding) Option {
+	return func(o *options) { o.timeEncoding = t }
+}
+
+// WithService adds the name and version of the service to every entry. Empty values are not added.
+func WithService(name, version string) Option {
+	return func(o *options) {
+		o.service = name
+		o.version = version
+	}
+}
+
+// WithSampling logs the first `initial` entries with the same level and message every second, and
+// then one of every `thereafter` entries. Hooks are not sampled.
+func WithSampling(initial, thereafter int) Option {
+	return func(o *options) {
+		o.sampling = &zap.SamplingConfig{Initial: initial, Thereafter: thereafter}
+	}
+}
+
+// WithOutputPaths writes the entries to `paths` besides stdout. They are files or URLs of sinks
+// registered with zap.RegisterSink.
+func WithOutputPaths(paths ...string) Option {
+	return func(o *options) { o.outputPaths = append(o.outputPaths, paths...) }
+}
+
+// WithDevelopment enables the development mode: console encoding with colored levels and ISO8601
+// times, stack traces from the warn level, and panics on DPanic entries
+func WithDevelopment() Option {
+	return func(o *options) { o.development = true }
+}
+
+// WithStacktraceLevel adds the stack trace to the entries of level `l` and above. Defaults to the
+// error level, or warn in development mode.
+func WithStacktraceLevel(l zapcore.Level) Option {
+	return func(o *options) { o.stacktrace = &l }
+}
+
+// WithHook fires `h` with the entries of level `l` and above, like errors to forward to an alerting
+// sink. The hook receives the entries after the redaction.
+func WithHook(l zapcore.Level, h Hook) Option {
+	return func(o *options) { o.hooks = append(o.hooks, NewHookCore(l, h)) }
+}
+
+// WithRedactionRules redacts the entries with `rules` instead of DefaultRedactionRules
+func WithRedactionRules(rules RedactionRules) Option {
+	return func(o *options) {
+		o.rules = &rules
+		o.noRedaction = false
+	}
+}
+
+// WithoutRedaction writes the entries as they were logged, for loggers that never see sensitive
+// values
+func WithoutRedaction() Option {
+	return func(o *options) { o.noRedaction = true }
+}
+
+// envOptions returns the options set by the env variables, and the errors of the invalid ones
+func envOptions() ([]Option, []error) {
+	var opts []Option
+	var errs []error
+
+	if v := os.Getenv(FormatEnv); v != "" {
+		switch e := Encoding(strings.ToLower(v)); e {
+		case EncodingJSON, EncodingConsole:
+			opts = append(opts, WithEncoding(e))
+		default:
+			errs = append(errs, fmt.Errorf("invalid %s %q", FormatEnv, v))
+		}
+	}
+
+	if v := os.Getenv(TimeFormatEnv); v != "" {
+		switch t := TimeEncoding(strings.ToLower(v)); t {
+		case TimeEpoch, TimeISO8601, TimeRFC3339Nano:
+			opts = append(opts, WithTimeEncoding(t))
+		default:
+			errs = append(errs, fmt.Errorf("invalid %s %q", TimeFormatEnv, v))
+		}
+	}
+
+	service := firstEnv(ServiceEnv, "AWS_LAMBDA_FUNCTION_NAME")
+	version := firstEnv(VersionEnv, "AWS_LAMBDA_FUNCTION_VERSION")
+	if service != "" || version != "" {
+		opts = append(opts, WithService(service, version))
+	}
+
+	if v := os.Getenv(SamplingEnv); v != "" {
+		initial, thereafter, err := parseSampling(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", SamplingEnv, v, err))
+		} else {
+			opts = append(opts, WithSampling(initial, thereafter))
+		}
+	}
+
+	if v := os.Getenv(OutputPathsEnv); v != "" {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				opts = append(opts, WithOutputPaths(p))
+			}
+		}
+	}
+
+	if v := os.Getenv(DevelopmentEnv); v != "" {
+		dev, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q", DevelopmentEnv, v))
+		} else if dev {
+			opts = append(opts, WithDevelopment())
+		}
+	}
+
+	if v := os.Getenv(StacktraceLevelEnv); v != "" {
+		l, err := ParseLevel(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", StacktraceLevelEnv, err))
+		} else {
+			opts = append(opts, WithStacktraceLevel(l))
+		}
+	}
+
+	return opts, errs
+}
+
+// apply sets the options in `cfg`, except for the sampling which is set by sampler
+func (o options) apply(cfg *zap.Config) {
+	if o.development {
+		cfg.Development = true
+		cfg.Encoding = string(EncodingConsole)
+		cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		if o.timeEncoding == "" {
+			o.timeEncoding = TimeISO8601
+		}
+	}
+
+	if o.encoding != "" {
+		cfg.Encoding = string(o.encoding)
+	}
+
+	switch o.timeEncoding {
+	case TimeEpoch:
+		cfg.EncoderConfig.EncodeTime = zapcore.EpochTimeEncoder
+	case TimeISO8601:
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	case TimeRFC3339Nano:
+		cfg.EncoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	}
+	if o.timeEncoding != "" {
+		cfg.EncoderConfig.TimeKey = TimeKey
+	}
+
+	if o.service != "" || o.version != "" {
+		cfg.InitialFields = map[string]interface{}{}
+		if o.service != "" {
+			cfg.InitialFields[ServiceKey] = o.service
+		}
+		if o.version != "" {
+			cfg.InitialFields[VersionKey] = o.version
+		}
+	}
+
+	cfg.OutputPaths = append(cfg.OutputPaths, o.outputPaths...)
+
+	// set by buildOptions instead
+	if o.stacktrace != nil {
+		cfg.DisableStacktrace = true
+	}
+}
+
+// buildOptions returns the zap options of the options, to build the config set by apply. The
+// output core and the hooks are redacted, the output core is sampled, and they are all wrapped by
+// the level filter. The hooks are not sampled, so they get every entry of their level.
+func (o options) buildOptions(levels *Levels) []zap.Option {
+	var opts []zap.Option
+	if o.stacktrace != nil {
+		opts = append(opts, zap.AddStacktrace(*o.stacktrace))
+	}
+
+	return append(opts,
+		zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			cores := append([]zapcore.Core{c}, o.hooks...)
+			if !o.noRedaction {
+				rules := DefaultRedactionRules()
+				if o.rules != nil {
+					rules = *o.rules
+				}
+				r := newRedactor(rules)
+				for i, c := range cores {
+					cores[i] = &redactingCore{Core: c, r: r}
+				}
+			}
+			cores[0] = o.sampler(cores[0])
+
+			return zapcore.NewTee(cores...)
+		}),
+		zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return newLevelCore(c, levels)
+		}),
+	)
+}
+
+// sampler wraps `core` with the sampling of the options. It is applied outside of the redaction,
+// which would bypass it.
+func (o options) sampler(core zapcore.Core) zapcore.Core {
+	if o.sampling == nil {
+		return core
+	}
+
+	return zapcore.NewSamplerWithOptions(core, time.Second, o.sampling.Initial, o.sampling.Thereafter)
+}
+
+// parseSampling parses `initial,thereafter`
+func parseSampling(v string) (initial, thereafter int, err error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected initial,thereafter")
+	}
+
+	if initial, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, err
+	}
+	if thereafter, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		return 0, 0, err
+	}
+
+	return initial, thereafter, nil
+}
+
+// firstEnv returns the value of the first of `keys` that is set
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,147 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/credifranco/stori-utils-go/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var optionsSink = &MemorySink{new(bytes.Buffer)}
+
+func init() {
+	if err := zap.RegisterSink("options", func(*url.URL) (zap.Sink, error) { return optionsSink, nil }); err != nil {
+		panic(err)
+	}
+}
+
+// newTestLogger creates a logger writing to optionsSink
+func newTestLogger(t *testing.T, opts ...log.Option) *zap.SugaredLogger {
+	t.Setenv(log.LevelEnv, "info")
+	optionsSink.Reset()
+	l, err := log.NewLogger(append(opts, log.WithOutputPaths("options://"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+// entries decodes the JSON entries written to optionsSink
+func entries(t *testing.T) []map[string]interface{} {
+	var ee []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(optionsSink.String()), "\n") {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON entry %q: %v", line, err)
+		}
+		ee = append(ee, e)
+	}
+
+	return ee
+}
+
+func TestLoggerOptions(t *testing.T) {
+	a := assert.New(t)
+
+	l := newTestLogger(t, log.WithTimeEncoding(log.TimeRFC3339Nano), log.WithService("stori-payments", "1.2.0"))
+	l.Infow("created")
+
+	e := entries(t)[0]
+	a.Equal("stori-payments", e["service"])
+	a.Equal("1.2.0", e["version"])
+	_, err := time.Parse(time.RFC3339Nano, e["time"].(string))
+	a.NoError(err)
+
+	// no time by default
+	l = newTestLogger(t)
+	l.Infow("created")
+	a.NotContains(entries(t)[0], "time")
+
+	l = newTestLogger(t, log.WithSampling(2, 0))
+	for i := 0; i < 10; i++ {
+		l.Infow("sampled")
+	}
+	a.Len(entries(t), 2)
+
+	// hooks get the entries dropped by the sampling
+	h := &log.MemoryHook{}
+	l = newTestLogger(t, log.WithSampling(1, 0), log.WithHook(zap.ErrorLevel, h))
+	for i := 0; i < 3; i++ {
+		l.Errorw("failed")
+	}
+	a.Len(entries(t), 1)
+	a.Len(h.Entries(), 3)
+
+	l = newTestLogger(t, log.WithEncoding(log.EncodingConsole), log.WithTimeEncoding(log.TimeISO8601))
+	l.Infow("created", "id", 1)
+	out := optionsSink.String()
+	a.Regexp(`^\d{4}-\d{2}-\d{2}T[\d:.]+(Z|[-+]\d{4})\tinfo\t`, out)
+	a.Contains(out, `{"id": 1}`)
+
+	l = newTestLogger(t, log.WithDevelopment())
+	l.Warnw("slow")
+	out = optionsSink.String()
+	a.Contains(out, "\x1b[33mWARN\x1b[0m", "levels should be colored")
+	a.Contains(out, "TestLoggerOptions", "warnings should have a stack trace")
+}
+
+func TestLoggerRedactionOptions(t *testing.T) {
+	a := assert.New(t)
+
+	l := newTestLogger(t)
+	l.Infow("created", "email", "jane@stori.mx", "account_id", "1")
+	e := entries(t)[0]
+	a.Equal("[REDACTED]", e["email"])
+	a.Equal("1", e["account_id"])
+
+	l = newTestLogger(t, log.WithRedactionRules(log.RedactionRules{Keys: []string{"account_id"}}))
+	l.Infow("created", "email", "jane@stori.mx", "account_id", "1")
+	e = entries(t)[0]
+	a.Equal("jane@stori.mx", e["email"])
+	a.Equal("[REDACTED]", e["account_id"])
+
+	l = newTestLogger(t, log.WithoutRedaction())
+	l.Infow("sent to jane@stori.mx", "password", "hunter2")
+	e = entries(t)[0]
+	a.Equal("sent to jane@stori.mx", e["msg"])
+	a.Equal("hunter2", e["password"])
+}
+
+func TestLoggerEnv(t *testing.T) {
+	a := assert.New(t)
+	t.Setenv(log.TimeFormatEnv, "ISO8601")
+	t.Setenv(log.SamplingEnv, "1,0")
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "stori-fn")
+	t.Setenv("AWS_LAMBDA_FUNCTION_VERSION", "$LATEST")
+	t.Setenv(log.VersionEnv, "1.2.0")
+	t.Setenv(log.FormatEnv, "xml")
+	t.Setenv(log.DevelopmentEnv, "false")
+
+	l := newTestLogger(t)
+	l.Infow("created")
+	l.Infow("created")
+
+	ee := entries(t)
+	if a.Len(ee, 2, "the invalid env warning and the sampled entry should be logged") {
+		a.Equal("invalid log env variable, using the default", ee[0]["msg"])
+		a.Contains(ee[0]["err"], log.FormatEnv)
+
+		a.Equal("stori-fn", ee[1]["service"])
+		a.Equal("1.2.0", ee[1]["version"])
+		_, err := time.Parse("2006-01-02T15:04:05.000Z0700", ee[1]["time"].(string))
+		a.NoError(err)
+	}
+
+	// options take precedence over the env
+	t.Setenv(log.FormatEnv, "console")
+	l = newTestLogger(t, log.WithEncoding(log.EncodingJSON))
+	l.Infow("created")
+	a.Len(entries(t), 1)
+}
@@ -0,0 +1,380 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultMask replaces redacted values
+const DefaultMask = "[REDACTED]"
+
+// RedactionPattern detects sensitive values inside of strings
+type RedactionPattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+	// Valid filters the matches of Regexp, like the Luhn check of card numbers. Nil accepts every
+	// match.
+	Valid func(match string) bool
+	// Mask returns the replacement of a valid match. Nil replaces it with the Mask of the rules.
+	Mask func(match string) string
+}
+
+// Patterns used by DefaultRedactionRules. CLABE is before PAN as both are long numbers, and Email
+// is before Phone so the digits of emails are not taken as phone numbers.
+var (
+	EmailPattern = RedactionPattern{
+		Name:   "email",
+		Regexp: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+	// CLABEPattern detects the 18 digit Mexican bank account numbers with a valid check digit
+	CLABEPattern = RedactionPattern{
+		Name:   "clabe",
+		Regexp: regexp.MustCompile(`\b\d{18}\b`),
+		Valid:  validCLABE,
+	}
+	// PANPattern detects card numbers of 13 to 19 digits, optionally separated by spaces or dashes,
+	// that pass the Luhn check. The last 4 digits are kept.
+	PANPattern = RedactionPattern{
+		Name:   "pan",
+		Regexp: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		Valid:  func(m string) bool { return luhn(digits(m)) },
+		Mask:   maskPAN,
+	}
+	// PhonePattern detects E.164 phone numbers, like +525512345678
+	PhonePattern = RedactionPattern{
+		Name:   "phone",
+		Regexp: regexp.MustCompile(`\+[1-9]\d{7,14}\b`),
+	}
+	CURPPattern = RedactionPattern{
+		Name: "curp",
+		Regexp: regexp.MustCompile(`(?i)\b[A-Z][AEIOUX][A-Z]{2}\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])[HMX]` +
+			`(?:AS|BC|BS|CC|CL|CM|CS|CH|DF|CX|DG|GT|GR|HG|JC|MC|MN|MS|NT|NL|OC|PL|QT|QR|SP|SL|SR|TC|TS|TL|VZ|YN|ZS|NE)` +
+			`[B-DF-HJ-NP-TV-Z]{3}[A-Z\d]\d\b`),
+	}
+	// RFCPattern detects the RFC of individuals (13 characters) and companies (12 characters)
+	RFCPattern = RedactionPattern{
+		Name:   "rfc",
+		Regexp: regexp.MustCompile(`(?i)\b[A-ZÑ&]{3,4}\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])[A-Z\d]{2}[A\d]\b`),
+	}
+)
+
+// DefaultRedactionKeys are the field keys masked by DefaultRedactionRules
+var DefaultRedactionKeys = []string{
+	"password", "secret", "token", "access_token", "refresh_token", "id_token", "authorization",
+	"pan", "card_number", "cvv", "cvc", "pin", "email", "phone_number", "curp", "rfc", "clabe",
+}
+
+// RedactionRules configures NewRedactingCore
+type RedactionRules struct {
+	// Keys are the field keys whose whole value is masked, at any depth of objects and maps. They
+	// are matched ignoring case, underscores and dashes, so card_number also masks cardNumber.
+	Keys []string
+	// Patterns are applied in order to the message and the strings of every field
+	Patterns []RedactionPattern
+	// NumericKeys are the field keys whose integers are also checked with the Patterns, matched
+	// like Keys. Other integers are kept, as IDs and timestamps can pass the checks of card
+	// numbers and CLABEs.
+	NumericKeys []string
+	// Mask replaces the masked values. Defaults to DefaultMask.
+	Mask string
+}
+
+// DefaultRedactionRules masks the DefaultRedactionKeys, and card numbers, emails, E.164 phones,
+// CURPs, RFCs and CLABEs anywhere in the logs
+func DefaultRedactionRules() RedactionRules {
+	return RedactionRules{
+		Keys:     append([]string(nil), DefaultRedactionKeys...),
+		Patterns: []RedactionPattern{EmailPattern, CLABEPattern, PANPattern, PhonePattern, CURPPattern, RFCPattern},
+		Mask:     DefaultMask,
+	}
+}
+
+// redactor applies RedactionRules to messages and fields
+type redactor struct {
+	keys        map[string]bool
+	numericKeys map[string]bool
+	patterns    []RedactionPattern
+	mask        string
+}
+
+func newRedactor(rules RedactionRules) *redactor {
+	r := &redactor{
+		keys:        map[string]bool{},
+		numericKeys: map[string]bool{},
+		patterns:    rules.Patterns,
+		mask:        rules.Mask,
+	}
+	if r.mask == "" {
+		r.mask = DefaultMask
+	}
+	for _, k := range rules.Keys {
+		r.keys[normalizeKey(k)] = true
+	}
+	for _, k := range rules.NumericKeys {
+		r.numericKeys[normalizeKey(k)] = true
+	}
+
+	return r
+}
+
+// redactingCore is a zapcore.Core that redacts entries before writing them to the wrapped core
+type redactingCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+// NewRedactingCore wraps `core` so that the messages and fields written to it are redacted with
+// `rules`. Fields added with With are redacted once, when they are added. The entries are written
+// directly to `core`, so cores that filter entries in Check, like samplers and tees, should wrap
+// the redacting core instead of being wrapped by it.
+func NewRedactingCore(core zapcore.Core, rules RedactionRules) zapcore.Core {
+	return &redactingCore{Core: core, r: newRedactor(rules)}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.r.fields(fields)), r: c.r}
+}
+
+func (c *redactingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+
+	return ce
+}
+
+func (c *redactingCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	e.Message = c.r.string(e.Message)
+	return c.Core.Write(e, c.r.fields(fields))
+}
+
+// fields returns a redacted copy of `fields`
+func (r *redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		redacted[i] = r.field(f)
+	}
+
+	return redacted
+}
+
+func (r *redactor) field(f zapcore.Field) zapcore.Field {
+	if r.keys[normalizeKey(f.Key)] && f.Type != zapcore.NamespaceType && f.Type != zapcore.SkipType {
+		return zap.String(f.Key, r.mask)
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		f.String = r.string(f.String)
+	case zapcore.ByteStringType:
+		if bb, ok := f.Interface.([]byte); ok {
+			return zap.ByteString(f.Key, []byte(r.string(string(bb))))
+		}
+	case zapcore.Int64Type:
+		return r.number(f, f.Key, strconv.FormatInt(f.Integer, 10))
+	case zapcore.Uint64Type:
+		return r.number(f, f.Key, strconv.FormatUint(uint64(f.Integer), 10))
+	case zapcore.StringerType:
+		if s, ok := stringify(f.Interface); ok {
+			return zap.String(f.Key, r.string(s))
+		}
+	case zapcore.ErrorType:
+		// only replaced if redacted, to keep the errorVerbose and errorCauses of the error
+		if err, ok := f.Interface.(error); ok && err != nil {
+			if msg, ok := stringify(err); ok {
+				if redacted := r.string(msg); redacted != msg {
+					return zap.String(f.Key, redacted)
+				}
+			}
+		}
+	case zapcore.ReflectType:
+		if v, ok := jsonValue(f.Interface); ok {
+			return zap.Any(f.Key, r.value(f.Key, v))
+		}
+	case zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		if v, ok := enc.Fields[f.Key]; ok {
+			return zap.Any(f.Key, r.value(f.Key, v))
+		}
+	}
+
+	return f
+}
+
+// number replaces an integer field with a string if it is sensitive, like a card number. Only the
+// integers of the NumericKeys are checked.
+func (r *redactor) number(f zapcore.Field, key, s string) zapcore.Field {
+	if !r.numericKeys[normalizeKey(key)] {
+		return f
+	}
+
+	if redacted := r.string(s); redacted != s {
+		return zap.String(f.Key, redacted)
+	}
+
+	return f
+}
+
+// value redacts a value of the field `key`, decoded from JSON or encoded by a
+// zapcore.MapObjectEncoder. The elements of arrays belong to the key of the array.
+func (r *redactor) value(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			if r.keys[normalizeKey(k)] {
+				redacted[k] = r.mask
+				continue
+			}
+			redacted[k] = r.value(k, x)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, x := range v {
+			redacted[i] = r.value(key, x)
+		}
+		return redacted
+	case string:
+		return r.string(v)
+	case json.Number:
+		if s := v.String(); r.numericKeys[normalizeKey(key)] && r.string(s) != s {
+			return r.string(s)
+		}
+		return v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprint(v)
+		if redacted := r.string(s); r.numericKeys[normalizeKey(key)] && redacted != s {
+			return redacted
+		}
+		return v
+	case nil, bool, float32, float64, complex64, complex128, time.Time, time.Duration:
+		return v
+	default:
+		if jv, ok := jsonValue(v); ok {
+			return r.value(key, jv)
+		}
+		return v
+	}
+}
+
+// string replaces the matches of the patterns in `s`
+func (r *redactor) string(s string) string {
+	for _, p := range r.patterns {
+		s = p.Regexp.ReplaceAllStringFunc(s, func(m string) string {
+			if p.Valid != nil && !p.Valid(m) {
+				return m
+			}
+			if p.Mask != nil {
+				return p.Mask(m)
+			}
+			return r.mask
+		})
+	}
+
+	return s
+}
+
+// normalizeKey lowercases `k` and removes its separators
+func normalizeKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '_', '-', '.', ' ':
+			return -1
+		}
+		return r
+	}, strings.ToLower(k))
+}
+
+// jsonValue returns `v` encoded and decoded as JSON, so it only has maps, slices and primitives
+func jsonValue(v interface{}) (interface{}, bool) {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+
+	var jv interface{}
+	dec := json.NewDecoder(bytes.NewReader(bb))
+	dec.UseNumber()
+	if err := dec.Decode(&jv); err != nil {
+		return nil, false
+	}
+
+	return jv, true
+}
+
+// stringify returns the String of a fmt.Stringer or the Error of an error, recovering from panics
+// like zap does
+func stringify(v interface{}) (s string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	switch v := v.(type) {
+	case error:
+		return v.Error(), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+
+	return "", false
+}
+
+// digits returns the digits of `s`
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// luhn reports whether `number` has between 13 and 19 digits and a valid Luhn check digit
+func luhn(number string) bool {
+	if len(number) < 13 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if (len(number)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return sum%10 == 0
+}
+
+// validCLABE reports whether the last digit of the 18 digit `clabe` is its check digit
+func validCLABE(clabe string) bool {
+	weights := [3]int{3, 7, 1}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += (int(clabe[i]-'0') * weights[i%3]) % 10
+	}
+
+	return (10-sum%10)%10 == int(clabe[17]-'0')
+}
+
+// maskPAN masks all but the last 4 digits of a card number
+func maskPAN(pan string) string {
+	d := digits(pan)
+	return strings.Repeat("*", len(d)-4) + d[len(d)-4:]
+}
@@ -0,0 +1,135 @@
+package log_test
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/credifranco/stori-utils-go/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type customer struct {
+	Name       string `json:"name"`
+	CardNumber string `json:"cardNumber"`
+	Contact    string `json:"contact"`
+}
+
+type account struct {
+	clabe string
+}
+
+func (a account) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("clabe_number", a.clabe)
+	enc.AddString("owner", "GODE561231HDFRRN09")
+	return nil
+}
+
+func newRedactingLogger(rules log.RedactionRules) (*zap.SugaredLogger, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.DebugLevel)
+	return zap.New(log.NewRedactingCore(core, rules)).Sugar(), logs
+}
+
+func TestRedactPatterns(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"pan", "card 4111 1111 1111 1111 declined", "card ************1111 declined"},
+		{"pan without luhn", "order 4111111111111112", "order 4111111111111112"},
+		{"email", "sent to jane.doe+1@stori.mx", "sent to [REDACTED]"},
+		{"phone", "call +525512345678 now", "call [REDACTED] now"},
+		{"curp", "curp GODE561231HDFRRN09", "curp [REDACTED]"},
+		{"rfc individual", "rfc GODE561231GR8", "rfc [REDACTED]"},
+		{"rfc company", "rfc abc680524p76", "rfc [REDACTED]"},
+		{"clabe", "clabe 002010077777777771", "clabe [REDACTED]"},
+		{"clabe with bad check digit", "ref 002010077777777772", "ref 002010077777777772"},
+		{"safe", "payment 42 created at 2022-05-01", "payment 42 created at 2022-05-01"},
+	}
+
+	logger, logs := newRedactingLogger(log.DefaultRedactionRules())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			logs.TakeAll()
+
+			logger.Infow(tt.in, "value", tt.in)
+
+			entry := logs.All()[0]
+			a.Equal(tt.want, entry.Message)
+			a.Equal(tt.want, entry.ContextMap()["value"])
+		})
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	a := assert.New(t)
+	logger, logs := newRedactingLogger(log.DefaultRedactionRules())
+
+	logger.With("email", "jane@stori.mx").Infow("fields",
+		"Card-Number", "4111111111111111",
+		"id", int64(4111111111111111),
+		"customer", customer{Name: "Jane", CardNumber: "4111111111111111", Contact: "+525512345678"},
+		"params", map[string]string{"password": "hunter2", "q": "jane@stori.mx"},
+		"account", account{clabe: "002010077777777771"},
+		"err", errors.New("user jane@stori.mx not found"),
+		"amount", 10,
+	)
+
+	a.Equal(map[string]interface{}{
+		"email":       "[REDACTED]",
+		"Card-Number": "[REDACTED]",
+		"id":          int64(4111111111111111),
+		"customer":    map[string]interface{}{"name": "Jane", "cardNumber": "[REDACTED]", "contact": "[REDACTED]"},
+		"params":      map[string]interface{}{"password": "[REDACTED]", "q": "[REDACTED]"},
+		"account":     map[string]interface{}{"clabe_number": "[REDACTED]", "owner": "[REDACTED]"},
+		"err":         "user [REDACTED] not found",
+		"amount":      int64(10),
+	}, logs.All()[0].ContextMap())
+}
+
+func TestRedactCustomRules(t *testing.T) {
+	a := assert.New(t)
+	logger, logs := newRedactingLogger(log.RedactionRules{
+		Keys: []string{"account_id"},
+		Patterns: []log.RedactionPattern{{
+			Name:   "ticket",
+			Regexp: regexp.MustCompile(`TICKET-\d+`),
+			Mask:   func(string) string { return "TICKET-*" },
+		}},
+		Mask: "***",
+	})
+
+	logger.Infow("closed TICKET-123", "accountId", "1", "email", "jane@stori.mx")
+
+	entry := logs.All()[0]
+	a.Equal("closed TICKET-*", entry.Message)
+	a.Equal(map[string]interface{}{"accountId": "***", "email": "jane@stori.mx"}, entry.ContextMap())
+}
+
+func TestRedactNumericKeys(t *testing.T) {
+	a := assert.New(t)
+	rules := log.DefaultRedactionRules()
+	rules.NumericKeys = []string{"card"}
+	logger, logs := newRedactingLogger(rules)
+
+	logger.Infow("numbers",
+		"card", int64(4111111111111111),
+		"createdAt", int64(4111111111111111),
+		"payment", map[string]interface{}{"id": 4111111111111111, "card": []int64{4111111111111111}},
+	)
+
+	a.Equal(map[string]interface{}{
+		"card":      "************1111",
+		"createdAt": int64(4111111111111111),
+		"payment": map[string]interface{}{
+			"id":   json.Number("4111111111111111"),
+			"card": []interface{}{"************1111"},
+		},
+	}, logs.All()[0].ContextMap())
+}
@@ -9,13 +9,25 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// Cache is the set of redis operations used by our services. It is implemented by *RedisConn, and
+// can be faked in tests.
+type Cache interface {
+	Set(ctx context.Context, k string, d string, e time.Duration) error
+	Get(ctx context.Context, k string) (string, error)
+	Expire(ctx context.Context, k string, t time.Duration) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var _ Cache = (*RedisConn)(nil)
+
 type RedisConn struct {
 	client *redis.Client
 }
 
 // NewConn creates the new redis connection
 // - returns error on failures
-func (r RedisConn) NewConn(ctx context.Context) error {
+func (r *RedisConn) NewConn(ctx context.Context) error {
 	var h, p string
 	var ok bool
 	if h, ok = os.LookupEnv("REDIS_HOST"); !ok {
@@ -35,7 +47,8 @@ func (r RedisConn) NewConn(ctx context.Context) error {
 	}
 
 	if _, err := r.client.Ping(ctx).Result(); err != nil {
-
+		_ = r.client.Close()
+		r.client = nil
 		return err
 	}
 
@@ -74,3 +87,19 @@ func (r RedisConn) Expire(ctx context.Context, k string, t time.Duration) error
 	}
 	return r.client.Expire(ctx, k, t).Err()
 }
+
+// Ping checks that the redis server is reachable
+func (r RedisConn) Ping(ctx context.Context) error {
+	if r.client == nil {
+		return errors.New("redis connection not created")
+	}
+	return r.client.Ping(ctx).Err()
+}
+
+// Close closes the redis client, releasing any open connections
+func (r RedisConn) Close() error {
+	if r.client == nil {
+		return nil
+	}
+	return r.client.Close()
+}
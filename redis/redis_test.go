@@ -21,6 +21,13 @@ func TestNewConn(t *testing.T) {
 	var conn RedisConn
 	err := conn.NewConn(ctx)
 	assert.EqualError(t, err, "host path is missing")
+
+	// nothing listens on port 1, so the ping fails
+	t.Setenv("REDIS_HOST", "127.0.0.1")
+	t.Setenv("REDIS_PORT", "1")
+	err = conn.NewConn(ctx)
+	assert.Error(t, err)
+	assert.Nil(t, conn.client, "the client should be closed when the ping fails")
 }
 
 func TestGet(t *testing.T) {